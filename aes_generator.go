@@ -1,9 +1,6 @@
 package randomx
 
-import (
-	"crypto/aes"
-	"crypto/cipher"
-)
+import "github.com/opd-ai/go-randomx/internal/aesround"
 
 // AES round keys from RandomX specification
 
@@ -27,13 +24,33 @@ var aesGenerator4RKeys = [8][16]byte{
 	{0x09, 0xd6, 0x7c, 0x7a, 0xde, 0x39, 0x58, 0x91, 0xfd, 0xd1, 0x06, 0x0c, 0x2d, 0x76, 0xb0, 0xc0},
 }
 
+// AesHash1R initial state - generated from Hash512("RandomX AesHash1R state")
+var aesHash1RState = [4][16]byte{
+	{0x0d, 0x2c, 0xb5, 0x92, 0xde, 0x56, 0xa8, 0x9f, 0x47, 0xdb, 0x82, 0xcc, 0xad, 0x3a, 0x98, 0xd7},
+	{0x6e, 0x99, 0x8d, 0x33, 0x98, 0xb7, 0xc7, 0x15, 0x5a, 0x12, 0x9e, 0xf5, 0x57, 0x80, 0xe7, 0xac},
+	{0x17, 0x00, 0x77, 0x6a, 0xd0, 0xc7, 0x62, 0xae, 0x6b, 0x50, 0x79, 0x50, 0xe4, 0x7c, 0xa0, 0xe8},
+	{0x0c, 0x24, 0x0a, 0x63, 0x8d, 0x82, 0xad, 0x07, 0x05, 0x00, 0xa1, 0x79, 0x48, 0x49, 0x99, 0x7e},
+}
+
+// AesHash1R finalization keys - generated from Hash256("RandomX AesHash1R xkeys")
+var aesHash1RXKeys = [2][16]byte{
+	{0x89, 0x83, 0xfa, 0xf6, 0x9f, 0x94, 0x24, 0x8b, 0xbf, 0x56, 0xdc, 0x90, 0x01, 0x02, 0x89, 0x06},
+	{0xd1, 0x63, 0xb2, 0x61, 0x3c, 0xe0, 0xf4, 0x51, 0xc6, 0x43, 0x10, 0xee, 0x9b, 0xf9, 0x18, 0xed},
+}
+
+// column returns column i (0-3) of a 64-byte generator or hash state.
+func column(state *[64]byte, i int) *[16]byte {
+	return (*[16]byte)(state[16*i:])
+}
+
 // aesGenerator1R implements the RandomX AesGenerator1R pseudo-random number generator.
-// It produces a sequence of pseudo-random bytes using AES encryption/decryption.
+// Each step applies a single AES round to each of the four state columns,
+// decrypting columns 0 and 2 and encrypting columns 1 and 3, and outputs
+// the new state.
 type aesGenerator1R struct {
-	state [64]byte // 4 columns of 16 bytes each
-	enc   [2]cipher.Block
-	dec   [2]cipher.Block
-	pos   int // Position in current state (0-63)
+	state [64]byte      // 4 columns of 16 bytes each
+	aes   aesround.Impl // AES rounds; the zero value is the software implementation
+	pos   int           // Position in current state (0-63)
 }
 
 // newAesGenerator1R creates a new AesGenerator1R initialized with a 64-byte seed.
@@ -45,49 +62,16 @@ func newAesGenerator1R(seed []byte) (*aesGenerator1R, error) {
 	gen := &aesGenerator1R{}
 	copy(gen.state[:], seed)
 
-	// Initialize AES cipher blocks for encryption keys (columns 1, 3)
-	var err error
-	gen.enc[0], err = aes.NewCipher(aesGenerator1RKeys[1][:])
-	if err != nil {
-		return nil, err
-	}
-	gen.enc[1], err = aes.NewCipher(aesGenerator1RKeys[3][:])
-	if err != nil {
-		return nil, err
-	}
-
-	// Initialize AES cipher blocks for decryption keys (columns 0, 2)
-	gen.dec[0], err = aes.NewCipher(aesGenerator1RKeys[0][:])
-	if err != nil {
-		return nil, err
-	}
-	gen.dec[1], err = aes.NewCipher(aesGenerator1RKeys[2][:])
-	if err != nil {
-		return nil, err
-	}
-
 	gen.pos = 64 // Force initial generation
 	return gen, nil
 }
 
 // generate produces the next 64 bytes of pseudo-random data.
 func (g *aesGenerator1R) generate() {
-	// Create new state by applying AES to each column
-	var newState [64]byte
-
-	// Column 0 (decrypt with key0)
-	g.dec[0].Decrypt(newState[0:16], g.state[0:16])
-
-	// Column 1 (encrypt with key1)
-	g.enc[0].Encrypt(newState[16:32], g.state[16:32])
-
-	// Column 2 (decrypt with key2)
-	g.dec[1].Decrypt(newState[32:48], g.state[32:48])
-
-	// Column 3 (encrypt with key3)
-	g.enc[1].Encrypt(newState[48:64], g.state[48:64])
-
-	g.state = newState
+	g.aes.Dec(column(&g.state, 0), &aesGenerator1RKeys[0])
+	g.aes.Enc(column(&g.state, 1), &aesGenerator1RKeys[1])
+	g.aes.Dec(column(&g.state, 2), &aesGenerator1RKeys[2])
+	g.aes.Enc(column(&g.state, 3), &aesGenerator1RKeys[3])
 	g.pos = 0
 }
 
@@ -103,8 +87,13 @@ func (g *aesGenerator1R) getByte() byte {
 
 // getBytes fills the provided slice with pseudo-random bytes.
 func (g *aesGenerator1R) getBytes(dst []byte) {
-	for i := range dst {
-		dst[i] = g.getByte()
+	for len(dst) > 0 {
+		if g.pos >= 64 {
+			g.generate()
+		}
+		n := copy(dst, g.state[g.pos:])
+		g.pos += n
+		dst = dst[n:]
 	}
 }
 
@@ -122,15 +111,12 @@ func (g *aesGenerator1R) getUint32() uint32 {
 }
 
 // aesGenerator4R implements the RandomX AesGenerator4R pseudo-random number generator.
-// Similar to AesGenerator1R but uses 4 AES rounds per column for higher security.
+// Similar to AesGenerator1R but applies 4 AES rounds per column: columns 0
+// and 1 use keys 0-3, columns 2 and 3 use keys 4-7.
 type aesGenerator4R struct {
-	state [64]byte // 4 columns of 16 bytes each
-	// Cipher blocks for keys 0-7
-	enc03 [4]cipher.Block // Encryption with keys 0-3
-	dec03 [4]cipher.Block // Decryption with keys 0-3
-	enc47 [4]cipher.Block // Encryption with keys 4-7
-	dec47 [4]cipher.Block // Decryption with keys 4-7
-	pos   int              // Position in current state (0-63)
+	state [64]byte      // 4 columns of 16 bytes each
+	aes   aesround.Impl // AES rounds; the zero value is the software implementation
+	pos   int           // Position in current state (0-63)
 }
 
 // newAesGenerator4R creates a new AesGenerator4R initialized with a 64-byte seed.
@@ -142,69 +128,18 @@ func newAesGenerator4R(seed []byte) (*aesGenerator4R, error) {
 	gen := &aesGenerator4R{}
 	copy(gen.state[:], seed)
 
-	var err error
-
-	// Initialize cipher blocks for keys 0-3 (used for columns 0-1)
-	for i := 0; i < 4; i++ {
-		gen.enc03[i], err = aes.NewCipher(aesGenerator4RKeys[i][:])
-		if err != nil {
-			return nil, err
-		}
-		gen.dec03[i], err = aes.NewCipher(aesGenerator4RKeys[i][:])
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	// Initialize cipher blocks for keys 4-7 (used for columns 2-3)
-	for i := 0; i < 4; i++ {
-		gen.enc47[i], err = aes.NewCipher(aesGenerator4RKeys[4+i][:])
-		if err != nil {
-			return nil, err
-		}
-		gen.dec47[i], err = aes.NewCipher(aesGenerator4RKeys[4+i][:])
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	gen.pos = 64 // Force initial generation
 	return gen, nil
 }
 
 // generate produces the next 64 bytes of pseudo-random data.
 func (g *aesGenerator4R) generate() {
-	var temp [4][16]byte
-
-	// Column 0 (decrypt with keys 0-3, 4 rounds)
-	copy(temp[0][:], g.state[0:16])
-	for i := 0; i < 4; i++ {
-		g.dec03[i].Decrypt(temp[0][:], temp[0][:])
+	for r := 0; r < 4; r++ {
+		g.aes.Dec(column(&g.state, 0), &aesGenerator4RKeys[r])
+		g.aes.Enc(column(&g.state, 1), &aesGenerator4RKeys[r])
+		g.aes.Dec(column(&g.state, 2), &aesGenerator4RKeys[4+r])
+		g.aes.Enc(column(&g.state, 3), &aesGenerator4RKeys[4+r])
 	}
-
-	// Column 1 (encrypt with keys 0-3, 4 rounds)
-	copy(temp[1][:], g.state[16:32])
-	for i := 0; i < 4; i++ {
-		g.enc03[i].Encrypt(temp[1][:], temp[1][:])
-	}
-
-	// Column 2 (decrypt with keys 4-7, 4 rounds)
-	copy(temp[2][:], g.state[32:48])
-	for i := 0; i < 4; i++ {
-		g.dec47[i].Decrypt(temp[2][:], temp[2][:])
-	}
-
-	// Column 3 (encrypt with keys 4-7, 4 rounds)
-	copy(temp[3][:], g.state[48:64])
-	for i := 0; i < 4; i++ {
-		g.enc47[i].Encrypt(temp[3][:], temp[3][:])
-	}
-
-	// Copy results back to state
-	copy(g.state[0:16], temp[0][:])
-	copy(g.state[16:32], temp[1][:])
-	copy(g.state[32:48], temp[2][:])
-	copy(g.state[48:64], temp[3][:])
 	g.pos = 0
 }
 
@@ -220,8 +155,13 @@ func (g *aesGenerator4R) getByte() byte {
 
 // getBytes fills the provided slice with pseudo-random bytes.
 func (g *aesGenerator4R) getBytes(dst []byte) {
-	for i := range dst {
-		dst[i] = g.getByte()
+	for len(dst) > 0 {
+		if g.pos >= 64 {
+			g.generate()
+		}
+		n := copy(dst, g.state[g.pos:])
+		g.pos += n
+		dst = dst[n:]
 	}
 }
 
@@ -249,80 +189,59 @@ func (g *aesGenerator4R) setState(seed []byte) {
 }
 
 // aesHash1R implements the RandomX AesHash1R scratchpad hashing algorithm.
-// It processes the scratchpad in chunks and produces a 64-byte fingerprint.
+// Each 64-byte chunk of the scratchpad serves as the round keys of one AES
+// round per column, encrypting columns 0 and 2 and decrypting columns 1
+// and 3. Two final rounds with fixed keys produce a 64-byte fingerprint.
 type aesHash1R struct {
-	state [64]byte // 4 columns of 16 bytes each
-	enc   [2]cipher.Block
-	dec   [2]cipher.Block
+	state [64]byte      // 4 columns of 16 bytes each
+	aes   aesround.Impl // AES rounds; the zero value is the software implementation
 }
 
 // newAesHash1R creates a new AesHash1R instance.
 func newAesHash1R() (*aesHash1R, error) {
 	h := &aesHash1R{}
-
-	var err error
-
-	// Initialize AES cipher blocks for encryption keys (columns 1, 3)
-	h.enc[0], err = aes.NewCipher(aesGenerator1RKeys[1][:])
-	if err != nil {
-		return nil, err
-	}
-	h.enc[1], err = aes.NewCipher(aesGenerator1RKeys[3][:])
-	if err != nil {
-		return nil, err
-	}
-
-	// Initialize AES cipher blocks for decryption keys (columns 0, 2)
-	h.dec[0], err = aes.NewCipher(aesGenerator1RKeys[0][:])
-	if err != nil {
-		return nil, err
-	}
-	h.dec[1], err = aes.NewCipher(aesGenerator1RKeys[2][:])
-	if err != nil {
-		return nil, err
-	}
-
+	h.reset()
 	return h, nil
 }
 
-// hash processes the scratchpad and produces a 64-byte fingerprint.
-// The algorithm XORs the scratchpad data into the state using AES rounds.
+// hash processes the scratchpad and produces a 64-byte fingerprint. The
+// scratchpad length must be a multiple of 64 bytes.
 func (h *aesHash1R) hash(scratchpad []byte) [64]byte {
-	// Initialize state to zeros
-	for i := range h.state {
-		h.state[i] = 0
-	}
+	h.reset()
 
 	// Process scratchpad in 64-byte chunks
-	// XOR each chunk into state and apply AES rounds
 	for offset := 0; offset < len(scratchpad); offset += 64 {
-		// XOR this chunk into the state
-		for i := 0; i < 64 && offset+i < len(scratchpad); i++ {
-			h.state[i] ^= scratchpad[offset+i]
-		}
-
-		// Apply AES rounds to mix the state
-		h.mixState()
+		h.absorb(scratchpad[offset : offset+64])
 	}
 
-	return h.state
+	return h.sum()
 }
 
-// mixState applies one round of AES encryption/decryption to the state.
-func (h *aesHash1R) mixState() {
-	var newState [64]byte
-
-	// Column 0 (decrypt with key0)
-	h.dec[0].Decrypt(newState[0:16], h.state[0:16])
-
-	// Column 1 (encrypt with key1)
-	h.enc[0].Encrypt(newState[16:32], h.state[16:32])
-
-	// Column 2 (decrypt with key2)
-	h.dec[1].Decrypt(newState[32:48], h.state[32:48])
+// reset sets the state to its initial value before hashing a new
+// scratchpad.
+func (h *aesHash1R) reset() {
+	for i := range aesHash1RState {
+		copy(h.state[16*i:], aesHash1RState[i][:])
+	}
+}
 
-	// Column 3 (encrypt with key3)
-	h.enc[1].Encrypt(newState[48:64], h.state[48:64])
+// absorb applies one AES round per column with the 64-byte chunk as the
+// round keys.
+func (h *aesHash1R) absorb(chunk []byte) {
+	h.aes.Enc(column(&h.state, 0), (*[16]byte)(chunk[0:16]))
+	h.aes.Dec(column(&h.state, 1), (*[16]byte)(chunk[16:32]))
+	h.aes.Enc(column(&h.state, 2), (*[16]byte)(chunk[32:48]))
+	h.aes.Dec(column(&h.state, 3), (*[16]byte)(chunk[48:64]))
+}
 
-	h.state = newState
+// sum applies the two finalization rounds and returns the fingerprint.
+func (h *aesHash1R) sum() [64]byte {
+	for i := range aesHash1RXKeys {
+		key := &aesHash1RXKeys[i]
+		h.aes.Enc(column(&h.state, 0), key)
+		h.aes.Dec(column(&h.state, 1), key)
+		h.aes.Enc(column(&h.state, 2), key)
+		h.aes.Dec(column(&h.state, 3), key)
+	}
+	return h.state
 }
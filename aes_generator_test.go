@@ -0,0 +1,108 @@
+package randomx
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/opd-ai/go-randomx/internal/aesround"
+)
+
+// Known answers for the seed 00 01 02 ... 3f, computed with the AESENC and
+// AESDEC intrinsics following the reference fillAes1Rx4, fillAes4Rx4 and
+// hashAes1Rx4.
+const (
+	// First and last 64 bytes of a 2 MB scratchpad filled by AesGenerator1R
+	aesFillFirst = "40063a71277f580c3c1a4769d1f46fe501eaeb488ad327cdf79dae6d1839db32fd41d3d7f308eeb30d160fe0637559e8695cf99a0b0391a456fae2342c020d72"
+	aesFillLast  = "b28c34d84e6d9f03e52299eb180b4a5c57278102a24f10f3b9d36a6a828caf48f9d368d067f276f59a32452405fde5655c6ab6c072097022f3ee657cb478d637"
+
+	// First 128 bytes of AesGenerator4R seeded with the final fill state
+	aesGen4Output = "01c9d61b5a55c28948f81799a9bde04e93f2e1814d2d5498e6bccc5cbdab1a17de9629d27a06f098fbe48e9c510010be5dbb6e97689d9441dbea9ef64a3b2ca482f1b0da291e5411ae896b73f803fa6445995403dc11297c7273d11d20542ac0777d2de739bbf76f74e5b1a566d66eda2c0bed2d9b94582e0cb32b3fce3b41bf"
+
+	// AesHash1R of the filled scratchpad
+	aesHashOutput = "77211b4537ec1717c4812245b419976345ac120bc7f52d2cc7f20979a4518e5891c3d2ea2c23f113b0bd9aaa3ce5f282591c7f75c607561442e5fb6d7e95b36a"
+)
+
+// aesImplementations returns the AES implementations available here.
+func aesImplementations() map[string]aesround.Impl {
+	impls := map[string]aesround.Impl{"Soft": aesround.Soft}
+	if hard, ok := aesround.Hardware(); ok {
+		impls["Hardware"] = hard
+	}
+	return impls
+}
+
+// Test scratchpad fill, program generation and scratchpad hash against
+// known answers with every AES implementation
+func TestAesKnownAnswers(t *testing.T) {
+	var seed [64]byte
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+
+	for name, impl := range aesImplementations() {
+		t.Run(name, func(t *testing.T) {
+			gen1, err := newAesGenerator1R(seed[:])
+			if err != nil {
+				t.Fatalf("newAesGenerator1R() error = %v", err)
+			}
+			gen1.aes = impl
+
+			pad := make([]byte, scratchpadL3Size)
+			gen1.getBytes(pad)
+			if got := hex.EncodeToString(pad[:64]); got != aesFillFirst {
+				t.Errorf("fill first 64 bytes = %s, want %s", got, aesFillFirst)
+			}
+			if got := hex.EncodeToString(pad[len(pad)-64:]); got != aesFillLast {
+				t.Errorf("fill last 64 bytes = %s, want %s", got, aesFillLast)
+			}
+
+			gen4, err := newAesGenerator4R(gen1.state[:])
+			if err != nil {
+				t.Fatalf("newAesGenerator4R() error = %v", err)
+			}
+			gen4.aes = impl
+
+			out := make([]byte, 128)
+			gen4.getBytes(out)
+			if got := hex.EncodeToString(out); got != aesGen4Output {
+				t.Errorf("AesGenerator4R output = %s, want %s", got, aesGen4Output)
+			}
+
+			hasher, err := newAesHash1R()
+			if err != nil {
+				t.Fatalf("newAesHash1R() error = %v", err)
+			}
+			hasher.aes = impl
+
+			sum := hasher.hash(pad)
+			if got := hex.EncodeToString(sum[:]); got != aesHashOutput {
+				t.Errorf("AesHash1R = %s, want %s", got, aesHashOutput)
+			}
+		})
+	}
+}
+
+// Test that getBytes returns the same stream as getByte across chunk
+// boundaries
+func TestAesGeneratorGetBytes(t *testing.T) {
+	var seed [64]byte
+	seed[0] = 1
+
+	gen, _ := newAesGenerator1R(seed[:])
+	want := make([]byte, 200)
+	for i := range want {
+		want[i] = gen.getByte()
+	}
+
+	gen, _ = newAesGenerator1R(seed[:])
+	got := make([]byte, 0, 200)
+	for _, n := range []int{3, 61, 64, 1, 71} {
+		buf := make([]byte, n)
+		gen.getBytes(buf)
+		got = append(got, buf...)
+	}
+
+	if hex.EncodeToString(got) != hex.EncodeToString(want) {
+		t.Errorf("getBytes stream = %x, want %x", got, want)
+	}
+}
@@ -0,0 +1,406 @@
+// Package argon2 implements the Argon2 memory-hard hash function of
+// RFC 9106 in its three variants: Argon2d, Argon2i and Argon2id.
+//
+// golang.org/x/crypto/argon2 provides Argon2i and Argon2id only. RandomX
+// builds its cache with Argon2d, which uses data-dependent memory access
+// patterns; this makes it faster to compute and harder to attack with
+// time-memory tradeoffs, but unsuitable where side channels matter, such
+// as password hashing on shared machines. Argon2id is the recommended
+// variant for passwords.
+//
+// Hash takes the full set of RFC 9106 inputs, including lanes, a secret
+// and associated data. Key, DKey and IDKey mirror the x/crypto functions.
+// RandomXCache and its variants are the RandomX preset: the 256 MB Argon2d
+// memory itself rather than a tag.
+//
+// The compression function has SSSE3 and AVX2 implementations on amd64;
+// Hash uses the fastest one the CPU supports.
+package argon2
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// Version is the Argon2 version number (0x13 = 19 decimal)
+	Version = 0x13
+
+	// DefaultTagLength is the output hash length in bytes (32 for RandomX)
+	DefaultTagLength = 32
+)
+
+// Variant selects how reference blocks are chosen. The values are the type
+// field of H0.
+type Variant uint32
+
+const (
+	// Argon2d picks reference blocks from the memory contents.
+	Argon2d Variant = 0
+
+	// Argon2i picks reference blocks from a pseudo-random sequence that
+	// does not depend on the password.
+	Argon2i Variant = 1
+
+	// Argon2id uses Argon2i addressing for the first half of the first
+	// pass and Argon2d addressing afterwards.
+	Argon2id Variant = 2
+)
+
+// String returns the name of the variant.
+func (v Variant) String() string {
+	switch v {
+	case Argon2d:
+		return "Argon2d"
+	case Argon2i:
+		return "Argon2i"
+	case Argon2id:
+		return "Argon2id"
+	}
+	return fmt.Sprintf("Variant(%d)", uint32(v))
+}
+
+// dataIndependent reports whether segment slice of pass uses Argon2i
+// addressing.
+func (v Variant) dataIndependent(pass, slice uint32) bool {
+	return v == Argon2i || v == Argon2id && pass == 0 && slice < SyncPoints/2
+}
+
+// Params are the parameters of an Argon2 computation.
+type Params struct {
+	Variant Variant
+
+	// Time is the number of passes over memory, at least 1.
+	Time uint32
+
+	// Memory is the memory size in KiB, at least 8*Lanes. It is rounded
+	// down to a multiple of 4*Lanes blocks of 1 KiB.
+	Memory uint32
+
+	// Lanes is the degree of parallelism, from 1 to 2^24-1. Lanes are
+	// filled concurrently.
+	Lanes uint32
+
+	// TagLength is the length of the output in bytes, at least 4.
+	TagLength uint32
+
+	// Secret is an optional key, and AssociatedData optional data, both
+	// mixed into H0.
+	Secret         []byte
+	AssociatedData []byte
+}
+
+// ErrInvalidParams is returned by Hash for parameters outside the ranges
+// RFC 9106 allows.
+var ErrInvalidParams = errors.New("argon2: invalid parameters")
+
+// validate checks p against the limits of RFC 9106.
+func (p *Params) validate() error {
+	switch {
+	case p.Variant > Argon2id:
+		return fmt.Errorf("%w: unknown variant %v", ErrInvalidParams, p.Variant)
+	case p.Time < 1:
+		return fmt.Errorf("%w: time %d is less than 1", ErrInvalidParams, p.Time)
+	case p.Lanes < 1 || p.Lanes > 1<<24-1:
+		return fmt.Errorf("%w: lanes %d out of range", ErrInvalidParams, p.Lanes)
+	case uint64(p.Memory) < 8*uint64(p.Lanes):
+		return fmt.Errorf("%w: memory %d KiB is less than 8 KiB per lane", ErrInvalidParams, p.Memory)
+	case p.TagLength < 4:
+		return fmt.Errorf("%w: tag length %d is less than 4", ErrInvalidParams, p.TagLength)
+	}
+	return nil
+}
+
+// blocks returns the number of memory blocks, Memory rounded down to a
+// multiple of 4*Lanes.
+func (p *Params) blocks() uint32 {
+	return p.Memory / (SyncPoints * p.Lanes) * (SyncPoints * p.Lanes)
+}
+
+// fill runs Argon2 with p on password and salt up to the finalization,
+// in memory, which must hold p.blocks() blocks.
+func (p *Params) fill(ctx context.Context, password, salt []byte, memory []Block, impl Impl, progress ProgressFunc) error {
+	h0 := initialHash(p.Variant, p.Lanes, p.TagLength, p.Memory, p.Time, password, salt, p.Secret, p.AssociatedData)
+	initializeMemory(memory, p.Lanes, h0)
+	return newInstance(memory, p.Time, p.Lanes, p.Variant, impl).fill(ctx, progress)
+}
+
+// Hash computes the Argon2 tag of password and salt with parameters p.
+func Hash(password, salt []byte, p Params) ([]byte, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	memory := make([]Block, p.blocks())
+	// A background context is never cancelled, so the error is always nil.
+	_ = p.fill(context.Background(), password, salt, memory, Default(), nil)
+	return finalizeHash(memory, p.Lanes, p.TagLength), nil
+}
+
+// key is Hash for the x/crypto style functions, which panic on invalid
+// parameters.
+func key(variant Variant, password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	tag, err := Hash(password, salt, Params{
+		Variant:   variant,
+		Time:      time,
+		Memory:    memory,
+		Lanes:     uint32(threads),
+		TagLength: keyLen,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return tag
+}
+
+// DKey derives a key of keyLen bytes from password and salt with Argon2d,
+// using time passes over memory KiB and threads lanes. It panics on
+// parameters Hash rejects.
+func DKey(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	return key(Argon2d, password, salt, time, memory, threads, keyLen)
+}
+
+// Key is DKey with Argon2i, like argon2.Key in golang.org/x/crypto.
+func Key(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	return key(Argon2i, password, salt, time, memory, threads, keyLen)
+}
+
+// IDKey is DKey with Argon2id, like argon2.IDKey in golang.org/x/crypto.
+func IDKey(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	return key(Argon2id, password, salt, time, memory, threads, keyLen)
+}
+
+// initialHash computes H0, the initial hash of an Argon2 computation.
+// This hash serves as the seed for initializing the first two blocks
+// and establishes the initial state for memory filling.
+//
+// H0 = Blake2b(lanes, tagLength, memory, timeCost, version, type,
+//
+//	len(password), password, len(salt), salt,
+//	len(secret), secret, len(data), data)
+//
+// All multi-byte integers are encoded as little-endian uint32.
+//
+// Parameters:
+//   - variant: Argon2d, Argon2i or Argon2id
+//   - lanes: Number of parallel lanes (1 for RandomX)
+//   - tagLength: Output hash length in bytes (32 for RandomX)
+//   - memory: Memory size in KB (256*1024 KB = 256 MB for RandomX)
+//   - timeCost: Number of passes (3 for RandomX)
+//   - password: Input key/password
+//   - salt: Salt value
+//   - secret: Optional secret key (nil for RandomX)
+//   - data: Optional associated data (nil for RandomX)
+//
+// Returns: H0 as 64-byte Blake2b hash
+func initialHash(variant Variant, lanes, tagLength, memory, timeCost uint32,
+	password, salt, secret, data []byte) [64]byte {
+
+	// Compute total input size for Blake2b
+	// Format: 10 uint32 values + variable-length fields
+	inputSize := 10*4 + len(password) + len(salt) + len(secret) + len(data)
+	input := make([]byte, inputSize)
+
+	offset := 0
+
+	// Write fixed parameters as little-endian uint32
+	binary.LittleEndian.PutUint32(input[offset:], lanes)
+	offset += 4
+
+	binary.LittleEndian.PutUint32(input[offset:], tagLength)
+	offset += 4
+
+	binary.LittleEndian.PutUint32(input[offset:], memory)
+	offset += 4
+
+	binary.LittleEndian.PutUint32(input[offset:], timeCost)
+	offset += 4
+
+	binary.LittleEndian.PutUint32(input[offset:], Version)
+	offset += 4
+
+	binary.LittleEndian.PutUint32(input[offset:], uint32(variant))
+	offset += 4
+
+	// Write password with length prefix
+	binary.LittleEndian.PutUint32(input[offset:], uint32(len(password)))
+	offset += 4
+	copy(input[offset:], password)
+	offset += len(password)
+
+	// Write salt with length prefix
+	binary.LittleEndian.PutUint32(input[offset:], uint32(len(salt)))
+	offset += 4
+	copy(input[offset:], salt)
+	offset += len(salt)
+
+	// Write secret with length prefix (may be empty)
+	binary.LittleEndian.PutUint32(input[offset:], uint32(len(secret)))
+	offset += 4
+	if len(secret) > 0 {
+		copy(input[offset:], secret)
+		offset += len(secret)
+	}
+
+	// Write associated data with length prefix (may be empty)
+	binary.LittleEndian.PutUint32(input[offset:], uint32(len(data)))
+	offset += 4
+	if len(data) > 0 {
+		copy(input[offset:], data)
+		// offset += len(data) // Not needed, this is the last field
+	}
+
+	// Compute Blake2b-512 hash (64 bytes)
+	return blake2b.Sum512(input)
+}
+
+// initializeMemory fills the first two blocks of each lane from H0.
+// Each block is generated using Blake2bLong with H0 as input plus
+// block index and lane index.
+//
+// For each lane i:
+//
+//	Block[i][0] = Blake2bLong(H0 || 0 || i, 1024)
+//	Block[i][1] = Blake2bLong(H0 || 1 || i, 1024)
+//
+// Parameters:
+//   - memory: Pre-allocated memory blocks to initialize
+//   - lanes: Number of parallel lanes
+//   - h0: Initial hash (64 bytes) from initialHash()
+func initializeMemory(memory []Block, lanes uint32, h0 [64]byte) {
+	laneLength := uint32(len(memory)) / lanes
+
+	for lane := uint32(0); lane < lanes; lane++ {
+		// Prepare input for Blake2bLong: H0 || blockIndex || laneIndex
+		// blockIndex and laneIndex are uint32 little-endian
+		input := make([]byte, 72) // 64 + 4 + 4
+		copy(input[0:64], h0[:])
+
+		// Initialize block 0 of this lane
+		binary.LittleEndian.PutUint32(input[64:68], 0) // block index 0
+		binary.LittleEndian.PutUint32(input[68:72], lane)
+		block0Bytes := Blake2bLong(input, 1024)
+		memory[lane*laneLength].FromBytes(block0Bytes)
+
+		// Initialize block 1 of this lane
+		binary.LittleEndian.PutUint32(input[64:68], 1) // block index 1
+		// lane index stays the same
+		block1Bytes := Blake2bLong(input, 1024)
+		memory[lane*laneLength+1].FromBytes(block1Bytes)
+	}
+}
+
+// finalizeHash computes the tag from the last block of every lane.
+//
+// Algorithm per RFC 9106 Section 3.2:
+//  1. C = last block of lane 0 XOR ... XOR last block of lane p-1
+//  2. Tag = Blake2bLong(C, tagLength)
+//
+// Parameters:
+//   - memory: Memory blocks after fillMemory
+//   - lanes: Number of parallel lanes
+//   - tagLength: Desired output length in bytes
+//
+// Returns: Final hash output
+func finalizeHash(memory []Block, lanes, tagLength uint32) []byte {
+	laneLength := uint32(len(memory)) / lanes
+
+	finalBlock := memory[laneLength-1]
+	for lane := uint32(1); lane < lanes; lane++ {
+		finalBlock.XOR(&memory[lane*laneLength+laneLength-1])
+	}
+
+	return Blake2bLong(finalBlock.ToBytes(), tagLength)
+}
+
+// The RandomX preset. Files that store a cache or dataset record these
+// parameters, so they must only change together with the generated data.
+const (
+	// RandomXMemory is the Argon2d memory size in KiB (256 MB of blocks)
+	RandomXMemory = 262144
+
+	// RandomXTime is the number of Argon2d passes
+	RandomXTime = 3
+
+	// RandomXLanes is the number of Argon2d lanes (single-threaded)
+	RandomXLanes = 1
+
+	// RandomXSalt is the salt RandomX uses with the cache key as password
+	RandomXSalt = "RandomX\x03"
+)
+
+// randomX are the Params of the RandomX cache. The tag length is 0 in H0
+// because the memory, not a tag, is the result.
+var randomX = Params{
+	Variant: Argon2d,
+	Time:    RandomXTime,
+	Memory:  RandomXMemory,
+	Lanes:   RandomXLanes,
+}
+
+// RandomXCache generates the RandomX cache from key: the Argon2d memory
+// after the last pass, RandomXMemory KiB in little-endian byte order.
+func RandomXCache(key []byte) []byte {
+	// A background context is never cancelled, so the error is always nil.
+	result, _ := RandomXCacheContext(context.Background(), key, nil)
+	return result
+}
+
+// RandomXCacheContext is RandomXCache with cancellation. The context is
+// checked between segments of the memory fill; if it is cancelled the
+// partially filled memory is dropped and ctx.Err() is returned.
+// If progress is non-nil it receives periodic updates from the fill.
+// The fill uses the fastest compression implementation the CPU supports.
+func RandomXCacheContext(ctx context.Context, key []byte, progress ProgressFunc) ([]byte, error) {
+	result := make([]byte, RandomXMemory*BlockSize)
+	if err := RandomXCacheInto(ctx, key, result, Default(), progress); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RandomXCacheInto is RandomXCacheContext writing into dst, which must be
+// RandomXMemory*BlockSize bytes and 8-byte aligned. The fill runs in dst
+// itself, so no other memory of that size is needed; this lets the caller
+// place the cache outside the Go heap. Blocks are compressed with impl.
+// On error the contents of dst are undefined.
+func RandomXCacheInto(ctx context.Context, key, dst []byte, impl Impl, progress ProgressFunc) error {
+	if len(dst) != RandomXMemory*BlockSize {
+		return errCacheSize
+	}
+
+	// View dst as the memory blocks and fill them
+	memory := unsafe.Slice((*Block)(unsafe.Pointer(&dst[0])), RandomXMemory)
+	if err := randomX.fill(ctx, key, []byte(RandomXSalt), memory, impl, progress); err != nil {
+		return err
+	}
+
+	// The memory is the RandomX cache - no finalization step!
+	// Blocks hold native-endian words; the cache is defined in
+	// little-endian byte order.
+	if !littleEndian {
+		for i := range memory {
+			for j, w := range memory[i] {
+				binary.LittleEndian.PutUint64(dst[(i*QWordsInBlock+j)*8:], w)
+			}
+		}
+	}
+
+	return nil
+}
+
+// errCacheSize is returned by RandomXCacheInto for a buffer that does not
+// have the size of the cache.
+var errCacheSize = errors.New("argon2: cache buffer must be RandomXMemory KiB")
+
+// littleEndian reports whether the host stores words little-endian, in
+// which case a []Block has the same bytes as its ToBytes encoding.
+var littleEndian = func() bool {
+	w := uint16(1)
+	return *(*byte)(unsafe.Pointer(&w)) == 1
+}()
@@ -1,8 +1,13 @@
-package argon2d
+package argon2
 
 import (
 	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
 	"testing"
+
+	xargon2 "golang.org/x/crypto/argon2"
 )
 
 // TestInitialHash_Basic verifies initialHash produces consistent output.
@@ -10,7 +15,7 @@ func TestInitialHash_Basic(t *testing.T) {
 	password := []byte("password")
 	salt := []byte("somesalt")
 
-	h0 := initialHash(1, 32, 256*1024, 3, password, salt, nil, nil)
+	h0 := initialHash(Argon2d, 1, 32, 256*1024, 3, password, salt, nil, nil)
 
 	// Should produce 64-byte output
 	if len(h0) != 64 {
@@ -35,8 +40,8 @@ func TestInitialHash_Deterministic(t *testing.T) {
 	password := []byte("test-password")
 	salt := []byte("test-salt")
 
-	h1 := initialHash(1, 32, 256*1024, 3, password, salt, nil, nil)
-	h2 := initialHash(1, 32, 256*1024, 3, password, salt, nil, nil)
+	h1 := initialHash(Argon2d, 1, 32, 256*1024, 3, password, salt, nil, nil)
+	h2 := initialHash(Argon2d, 1, 32, 256*1024, 3, password, salt, nil, nil)
 
 	if h1 != h2 {
 		t.Error("initialHash is not deterministic")
@@ -49,21 +54,21 @@ func TestInitialHash_DifferentInputs(t *testing.T) {
 	password2 := []byte("password2")
 	salt := []byte("somesalt")
 
-	h1 := initialHash(1, 32, 256*1024, 3, password1, salt, nil, nil)
-	h2 := initialHash(1, 32, 256*1024, 3, password2, salt, nil, nil)
+	h1 := initialHash(Argon2d, 1, 32, 256*1024, 3, password1, salt, nil, nil)
+	h2 := initialHash(Argon2d, 1, 32, 256*1024, 3, password2, salt, nil, nil)
 
 	if h1 == h2 {
 		t.Error("Different passwords produced identical hashes")
 	}
 
 	// Try different salt
-	h3 := initialHash(1, 32, 256*1024, 3, password1, []byte("othersalt"), nil, nil)
+	h3 := initialHash(Argon2d, 1, 32, 256*1024, 3, password1, []byte("othersalt"), nil, nil)
 	if h1 == h3 {
 		t.Error("Different salts produced identical hashes")
 	}
 
 	// Try different parameters
-	h4 := initialHash(1, 32, 512*1024, 3, password1, salt, nil, nil)
+	h4 := initialHash(Argon2d, 1, 32, 512*1024, 3, password1, salt, nil, nil)
 	if h1 == h4 {
 		t.Error("Different memory sizes produced identical hashes")
 	}
@@ -75,8 +80,8 @@ func TestInitialHash_WithSecret(t *testing.T) {
 	salt := []byte("salt")
 	secret := []byte("secret-key")
 
-	h1 := initialHash(1, 32, 256*1024, 3, password, salt, nil, nil)
-	h2 := initialHash(1, 32, 256*1024, 3, password, salt, secret, nil)
+	h1 := initialHash(Argon2d, 1, 32, 256*1024, 3, password, salt, nil, nil)
+	h2 := initialHash(Argon2d, 1, 32, 256*1024, 3, password, salt, secret, nil)
 
 	if h1 == h2 {
 		t.Error("Secret key did not affect hash")
@@ -89,8 +94,8 @@ func TestInitialHash_WithData(t *testing.T) {
 	salt := []byte("salt")
 	data := []byte("associated-data")
 
-	h1 := initialHash(1, 32, 256*1024, 3, password, salt, nil, nil)
-	h2 := initialHash(1, 32, 256*1024, 3, password, salt, nil, data)
+	h1 := initialHash(Argon2d, 1, 32, 256*1024, 3, password, salt, nil, nil)
+	h2 := initialHash(Argon2d, 1, 32, 256*1024, 3, password, salt, nil, data)
 
 	if h1 == h2 {
 		t.Error("Associated data did not affect hash")
@@ -100,7 +105,7 @@ func TestInitialHash_WithData(t *testing.T) {
 // TestInitialHash_EmptyInputs verifies handling of empty inputs.
 func TestInitialHash_EmptyInputs(t *testing.T) {
 	// Empty password and salt should still work
-	h := initialHash(1, 32, 256*1024, 3, []byte{}, []byte{}, nil, nil)
+	h := initialHash(Argon2d, 1, 32, 256*1024, 3, []byte{}, []byte{}, nil, nil)
 
 	// Should not be all zeros (parameters still contribute)
 	allZero := true
@@ -121,7 +126,7 @@ func TestInitialHash_LargeInputs(t *testing.T) {
 	password := bytes.Repeat([]byte("a"), 1024)
 	salt := bytes.Repeat([]byte("b"), 1024)
 
-	h := initialHash(1, 32, 256*1024, 3, password, salt, nil, nil)
+	h := initialHash(Argon2d, 1, 32, 256*1024, 3, password, salt, nil, nil)
 
 	// Should handle large inputs without panic
 	if len(h) != 64 {
@@ -134,7 +139,7 @@ func TestInitialHash_ParameterSensitivity(t *testing.T) {
 	password := []byte("password")
 	salt := []byte("salt")
 
-	base := initialHash(1, 32, 256*1024, 3, password, salt, nil, nil)
+	base := initialHash(Argon2d, 1, 32, 256*1024, 3, password, salt, nil, nil)
 
 	tests := []struct {
 		name   string
@@ -151,7 +156,7 @@ func TestInitialHash_ParameterSensitivity(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			h := initialHash(tt.lanes, tt.tag, tt.memory, tt.time, password, salt, nil, nil)
+			h := initialHash(Argon2d, tt.lanes, tt.tag, tt.memory, tt.time, password, salt, nil, nil)
 			if h == base {
 				t.Errorf("%s did not affect hash", tt.name)
 			}
@@ -166,7 +171,7 @@ func BenchmarkInitialHash(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = initialHash(1, 32, 256*1024, 3, password, salt, nil, nil)
+		_ = initialHash(Argon2d, 1, 32, 256*1024, 3, password, salt, nil, nil)
 	}
 }
 
@@ -177,7 +182,7 @@ func BenchmarkInitialHash_LargeInputs(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = initialHash(1, 32, 256*1024, 3, password, salt, nil, nil)
+		_ = initialHash(Argon2d, 1, 32, 256*1024, 3, password, salt, nil, nil)
 	}
 }
 
@@ -186,7 +191,7 @@ func TestInitializeMemory_Basic(t *testing.T) {
 	// Generate H0
 	password := []byte("password")
 	salt := []byte("salt")
-	h0 := initialHash(1, 32, 256*1024, 3, password, salt, nil, nil)
+	h0 := initialHash(Argon2d, 1, 32, 256*1024, 3, password, salt, nil, nil)
 
 	// Create memory (32 blocks for testing)
 	const numBlocks = 32
@@ -242,7 +247,7 @@ func TestInitializeMemory_Basic(t *testing.T) {
 func TestInitializeMemory_Deterministic(t *testing.T) {
 	password := []byte("test")
 	salt := []byte("salt")
-	h0 := initialHash(1, 32, 256*1024, 3, password, salt, nil, nil)
+	h0 := initialHash(Argon2d, 1, 32, 256*1024, 3, password, salt, nil, nil)
 
 	// Initialize two separate memory arrays
 	memory1 := make([]Block, 32)
@@ -262,8 +267,8 @@ func TestInitializeMemory_Deterministic(t *testing.T) {
 
 // TestInitializeMemory_DifferentH0 verifies different H0 produces different blocks.
 func TestInitializeMemory_DifferentH0(t *testing.T) {
-	h0_1 := initialHash(1, 32, 256*1024, 3, []byte("password1"), []byte("salt"), nil, nil)
-	h0_2 := initialHash(1, 32, 256*1024, 3, []byte("password2"), []byte("salt"), nil, nil)
+	h0_1 := initialHash(Argon2d, 1, 32, 256*1024, 3, []byte("password1"), []byte("salt"), nil, nil)
+	h0_2 := initialHash(Argon2d, 1, 32, 256*1024, 3, []byte("password2"), []byte("salt"), nil, nil)
 
 	memory1 := make([]Block, 32)
 	memory2 := make([]Block, 32)
@@ -282,7 +287,7 @@ func TestInitializeMemory_DifferentH0(t *testing.T) {
 
 // TestInitializeMemory_MultiLane verifies multi-lane initialization.
 func TestInitializeMemory_MultiLane(t *testing.T) {
-	h0 := initialHash(2, 32, 256*1024, 3, []byte("password"), []byte("salt"), nil, nil)
+	h0 := initialHash(Argon2d, 2, 32, 256*1024, 3, []byte("password"), []byte("salt"), nil, nil)
 
 	// Create memory for 2 lanes (64 blocks total, 32 per lane)
 	const numBlocks = 64
@@ -314,7 +319,7 @@ func TestInitializeMemory_MultiLane(t *testing.T) {
 
 // Benchmark initializeMemory.
 func BenchmarkInitializeMemory(b *testing.B) {
-	h0 := initialHash(1, 32, 256*1024, 3, []byte("password"), []byte("salt"), nil, nil)
+	h0 := initialHash(Argon2d, 1, 32, 256*1024, 3, []byte("password"), []byte("salt"), nil, nil)
 	memory := make([]Block, 262144) // 256 MB
 
 	b.ResetTimer()
@@ -446,8 +451,8 @@ func TestFinalizeHash_SingleBlockChange(t *testing.T) {
 		}
 	}
 
-	// Change single bit in memory2
-	memory2[15][63] ^= 1
+	// Change single bit in the last block, which is the one finalized
+	memory2[numBlocks-1][63] ^= 1
 
 	result1 := finalizeHash(memory1, 1, 32)
 	result2 := finalizeHash(memory2, 1, 32)
@@ -493,7 +498,7 @@ func TestArgon2d_Basic(t *testing.T) {
 	salt := []byte("somesalt")
 
 	// Use small parameters for testing (256 blocks = 256 KB)
-	result := Argon2d(password, salt, 1, 256, 1, 32)
+	result := DKey(password, salt, 1, 256, 1, 32)
 
 	if len(result) != 32 {
 		t.Errorf("Argon2d produced %d bytes, expected 32", len(result))
@@ -517,8 +522,8 @@ func TestArgon2d_Deterministic(t *testing.T) {
 	password := []byte("test-password")
 	salt := []byte("test-salt")
 
-	result1 := Argon2d(password, salt, 1, 256, 1, 32)
-	result2 := Argon2d(password, salt, 1, 256, 1, 32)
+	result1 := DKey(password, salt, 1, 256, 1, 32)
+	result2 := DKey(password, salt, 1, 256, 1, 32)
 
 	if !bytes.Equal(result1, result2) {
 		t.Error("Argon2d is not deterministic")
@@ -529,8 +534,8 @@ func TestArgon2d_Deterministic(t *testing.T) {
 func TestArgon2d_DifferentPasswords(t *testing.T) {
 	salt := []byte("salt")
 
-	result1 := Argon2d([]byte("password1"), salt, 1, 256, 1, 32)
-	result2 := Argon2d([]byte("password2"), salt, 1, 256, 1, 32)
+	result1 := DKey([]byte("password1"), salt, 1, 256, 1, 32)
+	result2 := DKey([]byte("password2"), salt, 1, 256, 1, 32)
 
 	if bytes.Equal(result1, result2) {
 		t.Error("Different passwords produced identical hashes")
@@ -541,8 +546,8 @@ func TestArgon2d_DifferentPasswords(t *testing.T) {
 func TestArgon2d_DifferentSalts(t *testing.T) {
 	password := []byte("password")
 
-	result1 := Argon2d(password, []byte("salt1"), 1, 256, 1, 32)
-	result2 := Argon2d(password, []byte("salt2"), 1, 256, 1, 32)
+	result1 := DKey(password, []byte("salt1"), 1, 256, 1, 32)
+	result2 := DKey(password, []byte("salt2"), 1, 256, 1, 32)
 
 	if bytes.Equal(result1, result2) {
 		t.Error("Different salts produced identical hashes")
@@ -554,9 +559,9 @@ func TestArgon2d_DifferentParameters(t *testing.T) {
 	password := []byte("password")
 	salt := []byte("salt")
 
-	result1 := Argon2d(password, salt, 1, 256, 1, 32)
-	result2 := Argon2d(password, salt, 2, 256, 1, 32) // Different time cost
-	result3 := Argon2d(password, salt, 1, 512, 1, 32) // Different memory
+	result1 := DKey(password, salt, 1, 256, 1, 32)
+	result2 := DKey(password, salt, 2, 256, 1, 32) // Different time cost
+	result3 := DKey(password, salt, 1, 512, 1, 32) // Different memory
 
 	if bytes.Equal(result1, result2) {
 		t.Error("Different time costs produced identical hashes")
@@ -571,9 +576,9 @@ func TestArgon2d_VariableOutputLength(t *testing.T) {
 	password := []byte("password")
 	salt := []byte("salt")
 
-	result16 := Argon2d(password, salt, 1, 256, 1, 16)
-	result32 := Argon2d(password, salt, 1, 256, 1, 32)
-	result64 := Argon2d(password, salt, 1, 256, 1, 64)
+	result16 := DKey(password, salt, 1, 256, 1, 16)
+	result32 := DKey(password, salt, 1, 256, 1, 32)
+	result64 := DKey(password, salt, 1, 256, 1, 64)
 
 	if len(result16) != 16 {
 		t.Errorf("Tag length 16 produced %d bytes", len(result16))
@@ -591,8 +596,8 @@ func TestArgon2d_MultiPass(t *testing.T) {
 	password := []byte("password")
 	salt := []byte("salt")
 
-	result1 := Argon2d(password, salt, 1, 256, 1, 32)
-	result3 := Argon2d(password, salt, 3, 256, 1, 32)
+	result1 := DKey(password, salt, 1, 256, 1, 32)
+	result3 := DKey(password, salt, 3, 256, 1, 32)
 
 	// Different number of passes should produce different results
 	if bytes.Equal(result1, result3) {
@@ -600,20 +605,20 @@ func TestArgon2d_MultiPass(t *testing.T) {
 	}
 }
 
-// TestArgon2dCache_Basic verifies the RandomX cache generation wrapper.
-func TestArgon2dCache_Basic(t *testing.T) {
+// TestRandomXCache_Basic verifies the RandomX cache generation wrapper.
+func TestRandomXCache_Basic(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping Argon2d cache test in short mode")
 	}
 
 	key := []byte("RandomX test key")
 
-	cache := Argon2dCache(key)
+	cache := RandomXCache(key)
 
 	// RandomX cache should be 256 MB = 262144 blocks * 1024 bytes = 268435456 bytes
 	expectedSize := 262144 * 1024
 	if len(cache) != expectedSize {
-		t.Errorf("Argon2dCache produced %d bytes, expected %d", len(cache), expectedSize)
+		t.Errorf("RandomXCache produced %d bytes, expected %d", len(cache), expectedSize)
 	}
 
 	// Should not be all zeros
@@ -625,34 +630,34 @@ func TestArgon2dCache_Basic(t *testing.T) {
 		}
 	}
 	if allZero {
-		t.Error("Argon2dCache produced all zeros")
+		t.Error("RandomXCache produced all zeros")
 	}
 }
 
-// TestArgon2dCache_Deterministic verifies cache generation is deterministic.
-func TestArgon2dCache_Deterministic(t *testing.T) {
+// TestRandomXCache_Deterministic verifies cache generation is deterministic.
+func TestRandomXCache_Deterministic(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping Argon2d cache test in short mode")
 	}
 
 	key := []byte("test-key")
 
-	cache1 := Argon2dCache(key)
-	cache2 := Argon2dCache(key)
+	cache1 := RandomXCache(key)
+	cache2 := RandomXCache(key)
 
 	if !bytes.Equal(cache1, cache2) {
-		t.Error("Argon2dCache is not deterministic")
+		t.Error("RandomXCache is not deterministic")
 	}
 }
 
-// TestArgon2dCache_DifferentKeys verifies different keys produce different caches.
-func TestArgon2dCache_DifferentKeys(t *testing.T) {
+// TestRandomXCache_DifferentKeys verifies different keys produce different caches.
+func TestRandomXCache_DifferentKeys(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping Argon2d cache test in short mode")
 	}
 
-	cache1 := Argon2dCache([]byte("key1"))
-	cache2 := Argon2dCache([]byte("key2"))
+	cache1 := RandomXCache([]byte("key1"))
+	cache2 := RandomXCache([]byte("key2"))
 
 	if bytes.Equal(cache1, cache2) {
 		t.Error("Different keys produced identical caches")
@@ -666,17 +671,133 @@ func BenchmarkArgon2d_Small(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = Argon2d(password, salt, 1, 256, 1, 32)
+		_ = DKey(password, salt, 1, 256, 1, 32)
 	}
 }
 
-// Benchmark Argon2dCache (full RandomX parameters).
+// Benchmark RandomXCache (full RandomX parameters).
 // This is expensive - 256 MB memory, 3 passes.
-func BenchmarkArgon2dCache(b *testing.B) {
+func BenchmarkRandomXCache(b *testing.B) {
 	key := []byte("benchmark-key")
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = Argon2dCache(key)
+		_ = RandomXCache(key)
+	}
+}
+
+// TestHash_RFC9106 verifies the test vectors of RFC 9106 Section 5.
+func TestHash_RFC9106(t *testing.T) {
+	params := Params{
+		Time:           3,
+		Memory:         32,
+		Lanes:          4,
+		TagLength:      32,
+		Secret:         bytes.Repeat([]byte{0x03}, 8),
+		AssociatedData: bytes.Repeat([]byte{0x04}, 12),
+	}
+	password := bytes.Repeat([]byte{0x01}, 32)
+	salt := bytes.Repeat([]byte{0x02}, 16)
+
+	tests := []struct {
+		variant Variant
+		tag     string
+	}{
+		{Argon2d, "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb"},
+		{Argon2i, "c814d9d1dc7f37aa13f0d77f2494bda1c8de6b016dd388d29952a4c4672b6ce8"},
+		{Argon2id, "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.variant.String(), func(t *testing.T) {
+			p := params
+			p.Variant = tt.variant
+			tag, err := Hash(password, salt, p)
+			if err != nil {
+				t.Fatalf("Hash() error = %v", err)
+			}
+			if got := hex.EncodeToString(tag); got != tt.tag {
+				t.Errorf("Hash() = %s, want %s", got, tt.tag)
+			}
+		})
+	}
+}
+
+// TestKey_MatchesXCrypto verifies Key and IDKey give the tags of
+// golang.org/x/crypto/argon2, across lanes, memory sizes that are not a
+// multiple of the lanes and tags longer than 64 bytes.
+func TestKey_MatchesXCrypto(t *testing.T) {
+	tests := []struct {
+		time, memory uint32
+		threads      uint8
+		keyLen       uint32
+	}{
+		{1, 64, 1, 32},
+		{3, 256, 1, 16},
+		{2, 100, 3, 64},
+		{1, 1024, 4, 100},
+		{4, 37, 2, 32},
+	}
+
+	password, salt := []byte("password"), []byte("somesalt")
+	for _, tt := range tests {
+		if got, want := Key(password, salt, tt.time, tt.memory, tt.threads, tt.keyLen),
+			xargon2.Key(password, salt, tt.time, tt.memory, tt.threads, tt.keyLen); !bytes.Equal(got, want) {
+			t.Errorf("Key(%+v) = %x, want %x", tt, got, want)
+		}
+		if got, want := IDKey(password, salt, tt.time, tt.memory, tt.threads, tt.keyLen),
+			xargon2.IDKey(password, salt, tt.time, tt.memory, tt.threads, tt.keyLen); !bytes.Equal(got, want) {
+			t.Errorf("IDKey(%+v) = %x, want %x", tt, got, want)
+		}
+	}
+}
+
+// TestHash_Lanes verifies concurrent lanes give the tag of a sequential
+// fill.
+func TestHash_Lanes(t *testing.T) {
+	p := Params{Variant: Argon2d, Time: 2, Memory: 256, Lanes: 4, TagLength: 32}
+	tag, err := Hash([]byte("password"), []byte("somesalt"), p)
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+
+	// A progress function forces the sequential path.
+	memory := make([]Block, p.blocks())
+	h0 := initialHash(p.Variant, p.Lanes, p.TagLength, p.Memory, p.Time, []byte("password"), []byte("somesalt"), nil, nil)
+	initializeMemory(memory, p.Lanes, h0)
+	progress := func(pass, slice uint32, done, total uint64) {}
+	if err := newInstance(memory, p.Time, p.Lanes, p.Variant, Generic).fill(context.Background(), progress); err != nil {
+		t.Fatalf("fill() error = %v", err)
+	}
+	if want := finalizeHash(memory, p.Lanes, p.TagLength); !bytes.Equal(tag, want) {
+		t.Errorf("Hash() = %x, sequential fill = %x", tag, want)
+	}
+}
+
+// TestHash_InvalidParams verifies parameters outside RFC 9106 limits are
+// rejected.
+func TestHash_InvalidParams(t *testing.T) {
+	valid := Params{Variant: Argon2id, Time: 1, Memory: 64, Lanes: 2, TagLength: 32}
+	if _, err := Hash(nil, nil, valid); err != nil {
+		t.Fatalf("Hash() with %+v error = %v", valid, err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(p *Params)
+	}{
+		{"variant", func(p *Params) { p.Variant = 3 }},
+		{"time", func(p *Params) { p.Time = 0 }},
+		{"lanes", func(p *Params) { p.Lanes = 0 }},
+		{"too many lanes", func(p *Params) { p.Lanes = 1 << 24 }},
+		{"memory", func(p *Params) { p.Memory = 15 }},
+		{"tag length", func(p *Params) { p.TagLength = 3 }},
+	}
+	for _, tt := range tests {
+		p := valid
+		tt.change(&p)
+		if _, err := Hash(nil, nil, p); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("Hash() with bad %s error = %v, want ErrInvalidParams", tt.name, err)
+		}
 	}
 }
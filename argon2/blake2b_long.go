@@ -1,12 +1,4 @@
-// Package argon2d implements the Argon2d (data-dependent) variant
-// required by RandomX. This is a pure-Go port from the RandomX C
-// implementation.
-//
-// Argon2d differs from Argon2i/Argon2id (available in golang.org/x/crypto/argon2)
-// in that it uses data-dependent memory access patterns, making it faster
-// but vulnerable to side-channel attacks. RandomX specifically requires
-// Argon2d for cache generation.
-package argon2d
+package argon2
 
 import (
 	"encoding/binary"
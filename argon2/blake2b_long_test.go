@@ -1,4 +1,4 @@
-package argon2d
+package argon2
 
 import (
 	"bytes"
@@ -259,6 +259,6 @@ func TestBlake2bLong_KnownVector(t *testing.T) {
 	// Per Argon2 spec, Blake2bLong prepends the output length to input
 	// So Blake2bLong([], 32) = Blake2b-256(uint32_le(32) || [])
 	// We'll just verify it produces 32 bytes (the exact value depends on the implementation)
-	// The actual correctness is verified by TestArgon2dCache_RandomXReference
+	// The actual correctness is verified by TestRandomXCache_RandomXReference
 	t.Logf("Blake2bLong([], 32) = %x", result)
 }
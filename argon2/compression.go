@@ -1,12 +1,58 @@
-// Package argon2d implements Argon2d (data-dependent mode) for RandomX.
 // This file contains block compression functions using Blake2b mixing.
-package argon2d
+
+package argon2
 
 const (
 	// BlockSize128 is the number of uint64 values in a Block (128 = 1024 bytes / 8)
 	BlockSize128 = 128
 )
 
+// Impl is an implementation of the compression function. The zero Impl is
+// the portable Go implementation. All implementations give the same
+// blocks; they differ only in speed.
+type Impl struct {
+	fill func(prev, ref, next *Block, withXOR bool)
+}
+
+// Generic is the portable Go implementation.
+var Generic = Impl{}
+
+// SSSE3 returns the implementation using SSSE3 instructions, and whether
+// the CPU has them. Where it does not, SSSE3 returns Generic.
+func SSSE3() (Impl, bool) {
+	if !hasSSSE3 {
+		return Generic, false
+	}
+	return Impl{fill: fillBlockSSSE3}, true
+}
+
+// AVX2 returns the implementation using AVX2 instructions, and whether
+// the CPU has them. Where it does not, AVX2 returns Generic.
+func AVX2() (Impl, bool) {
+	if !hasAVX2 {
+		return Generic, false
+	}
+	return Impl{fill: fillBlockAVX2}, true
+}
+
+// Default returns the fastest implementation the CPU supports.
+func Default() Impl {
+	if impl, ok := AVX2(); ok {
+		return impl
+	}
+	impl, _ := SSSE3()
+	return impl
+}
+
+// fillBlock is the package-level fillBlock with implementation i.
+func (i Impl) fillBlock(prevBlock, refBlock, nextBlock *Block, withXOR bool) {
+	if i.fill == nil {
+		fillBlock(prevBlock, refBlock, nextBlock, withXOR)
+		return
+	}
+	i.fill(prevBlock, refBlock, nextBlock, withXOR)
+}
+
 // fillBlock performs Argon2 block compression using Blake2b rounds.
 // It mixes prevBlock and refBlock into nextBlock using Blake2b-style compression.
 //
@@ -0,0 +1,22 @@
+//go:build amd64
+
+package argon2
+
+import "golang.org/x/sys/cpu"
+
+var (
+	hasSSSE3 = cpu.X86.HasSSSE3
+	hasAVX2  = cpu.X86.HasAVX2
+)
+
+// fillBlockSSSE3 is fillBlock with SSSE3 instructions, two words per
+// register.
+//
+//go:noescape
+func fillBlockSSSE3(prev, ref, next *Block, withXOR bool)
+
+// fillBlockAVX2 is fillBlock with AVX2 instructions, permuting two
+// Blake2b states of four words per register at a time.
+//
+//go:noescape
+func fillBlockAVX2(prev, ref, next *Block, withXOR bool)
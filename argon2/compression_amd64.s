@@ -0,0 +1,336 @@
+//go:build amd64
+
+#include "textflag.h"
+
+// PSHUFB masks that rotate each 64-bit word right by 24 and 16 bits,
+// repeated for both 128-bit lanes of a YMM register.
+DATA rot24<>+0x00(SB)/8, $0x0201000706050403
+DATA rot24<>+0x08(SB)/8, $0x0a09080f0e0d0c0b
+DATA rot24<>+0x10(SB)/8, $0x0201000706050403
+DATA rot24<>+0x18(SB)/8, $0x0a09080f0e0d0c0b
+GLOBL rot24<>(SB), RODATA|NOPTR, $32
+
+DATA rot16<>+0x00(SB)/8, $0x0100070605040302
+DATA rot16<>+0x08(SB)/8, $0x09080f0e0d0c0b0a
+DATA rot16<>+0x10(SB)/8, $0x0100070605040302
+DATA rot16<>+0x18(SB)/8, $0x09080f0e0d0c0b0a
+GLOBL rot16<>(SB), RODATA|NOPTR, $32
+
+// The SSSE3 permutation holds the 16 words of a Blake2b state in X0-X7,
+// two words per register: a in X0-X1, b in X2-X3, c in X4-X5 and d in
+// X6-X7. X8 and X9 are scratch, X10 and X11 hold the rotation masks.
+
+// a = a + b + 2*lo(a)*lo(b), the BlaMka addition
+#define BLAMKA_SSE(a, b) \
+	MOVO    a, X8; \
+	PMULULQ b, X8; \
+	PADDQ   b, a;  \
+	PADDQ   X8, a; \
+	PADDQ   X8, a
+
+// First half of G: rotations by 32 and 24
+#define G1_SSE(a, b, c, d) \
+	BLAMKA_SSE(a, b);     \
+	PXOR   a, d;          \
+	PSHUFD $0xB1, d, d;   \
+	BLAMKA_SSE(c, d);     \
+	PXOR   c, b;          \
+	PSHUFB X10, b
+
+// Second half of G: rotations by 16 and 63
+#define G2_SSE(a, b, c, d) \
+	BLAMKA_SSE(a, b); \
+	PXOR   a, d;      \
+	PSHUFB X11, d;    \
+	BLAMKA_SSE(c, d); \
+	PXOR   c, b;      \
+	MOVO   b, X8;     \
+	PADDQ  b, X8;     \
+	PSRLQ  $63, b;    \
+	PXOR   X8, b
+
+// Rotate b left by one word and d by three, so that the diagonals line up
+// in the columns. c is rotated by two words by swapping X4 and X5 in the
+// diagonal G calls instead.
+#define DIAGONALIZE_SSE \
+	MOVO    X3, X8;     \
+	PALIGNR $8, X2, X8; \
+	MOVO    X2, X9;     \
+	PALIGNR $8, X3, X9; \
+	MOVO    X8, X2;     \
+	MOVO    X9, X3;     \
+	MOVO    X6, X8;     \
+	PALIGNR $8, X7, X8; \
+	MOVO    X7, X9;     \
+	PALIGNR $8, X6, X9; \
+	MOVO    X8, X6;     \
+	MOVO    X9, X7
+
+#define UNDIAGONALIZE_SSE \
+	MOVO    X2, X8;     \
+	PALIGNR $8, X3, X8; \
+	MOVO    X3, X9;     \
+	PALIGNR $8, X2, X9; \
+	MOVO    X8, X2;     \
+	MOVO    X9, X3;     \
+	MOVO    X7, X8;     \
+	PALIGNR $8, X6, X8; \
+	MOVO    X6, X9;     \
+	PALIGNR $8, X7, X9; \
+	MOVO    X8, X6;     \
+	MOVO    X9, X7
+
+// gRound on X0-X7
+#define ROUND_SSE \
+	G1_SSE(X0, X2, X4, X6); \
+	G1_SSE(X1, X3, X5, X7); \
+	G2_SSE(X0, X2, X4, X6); \
+	G2_SSE(X1, X3, X5, X7); \
+	DIAGONALIZE_SSE;        \
+	G1_SSE(X0, X2, X5, X6); \
+	G1_SSE(X1, X3, X4, X7); \
+	G2_SSE(X0, X2, X5, X6); \
+	G2_SSE(X1, X3, X4, X7); \
+	UNDIAGONALIZE_SSE
+
+#define LOAD_SSE(base, o0, o1, o2, o3, o4, o5, o6, o7) \
+	MOVOU o0(base), X0; \
+	MOVOU o1(base), X1; \
+	MOVOU o2(base), X2; \
+	MOVOU o3(base), X3; \
+	MOVOU o4(base), X4; \
+	MOVOU o5(base), X5; \
+	MOVOU o6(base), X6; \
+	MOVOU o7(base), X7
+
+#define STORE_SSE(base, o0, o1, o2, o3, o4, o5, o6, o7) \
+	MOVOU X0, o0(base); \
+	MOVOU X1, o1(base); \
+	MOVOU X2, o2(base); \
+	MOVOU X3, o3(base); \
+	MOVOU X4, o4(base); \
+	MOVOU X5, o5(base); \
+	MOVOU X6, o6(base); \
+	MOVOU X7, o7(base)
+
+// func fillBlockSSSE3(prev, ref, next *Block, withXOR bool)
+//
+// next is used as the working block: it receives R = prev ^ ref and is
+// permuted in place, while the feed-forward value R (^ old next with
+// withXOR) is kept in the 1 KB frame.
+TEXT ·fillBlockSSSE3(SB), 0, $1024-25
+	MOVQ    prev+0(FP), AX
+	MOVQ    ref+8(FP), BX
+	MOVQ    next+16(FP), CX
+	MOVBLZX withXOR+24(FP), DX
+	MOVQ    SP, DI
+	MOVOU   rot24<>(SB), X10
+	MOVOU   rot16<>(SB), X11
+
+	XORQ SI, SI
+
+prepare:
+	MOVOU (AX)(SI*1), X0
+	MOVOU (BX)(SI*1), X1
+	PXOR  X1, X0
+	MOVO  X0, X1
+	TESTQ DX, DX
+	JZ    store
+	MOVOU (CX)(SI*1), X2
+	PXOR  X2, X1
+
+store:
+	MOVOU X0, (CX)(SI*1)
+	MOVOU X1, (DI)(SI*1)
+	ADDQ  $16, SI
+	CMPQ  SI, $1024
+	JB    prepare
+
+	// Columns: words 16i to 16i+15
+	MOVQ CX, SI
+	MOVQ $8, R8
+
+columns:
+	LOAD_SSE(SI, 0, 16, 32, 48, 64, 80, 96, 112)
+	ROUND_SSE
+	STORE_SSE(SI, 0, 16, 32, 48, 64, 80, 96, 112)
+	ADDQ $128, SI
+	DECQ R8
+	JNZ  columns
+
+	// Rows: words 2i and 2i+1 of every column
+	MOVQ CX, SI
+	MOVQ $8, R8
+
+rows:
+	LOAD_SSE(SI, 0, 128, 256, 384, 512, 640, 768, 896)
+	ROUND_SSE
+	STORE_SSE(SI, 0, 128, 256, 384, 512, 640, 768, 896)
+	ADDQ $16, SI
+	DECQ R8
+	JNZ  rows
+
+	XORQ SI, SI
+
+finish:
+	MOVOU (CX)(SI*1), X0
+	MOVOU (DI)(SI*1), X1
+	PXOR  X1, X0
+	MOVOU X0, (CX)(SI*1)
+	ADDQ  $16, SI
+	CMPQ  SI, $1024
+	JB    finish
+	RET
+
+// The AVX2 permutation works on two Blake2b states at once, four words
+// per register: a, b, c and d of the first in Y0-Y3 and of the second in
+// Y4-Y7. Y8 and Y9 are scratch, Y10 and Y11 hold the rotation masks.
+
+#define BLAMKA_AVX2(a, b, t) \
+	VPMULUDQ b, a, t; \
+	VPADDQ   b, a, a; \
+	VPADDQ   t, a, a; \
+	VPADDQ   t, a, a
+
+#define G1_AVX2(a, b, c, d, t) \
+	BLAMKA_AVX2(a, b, t);  \
+	VPXOR   a, d, d;       \
+	VPSHUFD $0xB1, d, d;   \
+	BLAMKA_AVX2(c, d, t);  \
+	VPXOR   c, b, b;       \
+	VPSHUFB Y10, b, b
+
+#define G2_AVX2(a, b, c, d, t) \
+	BLAMKA_AVX2(a, b, t); \
+	VPXOR   a, d, d;      \
+	VPSHUFB Y11, d, d;    \
+	BLAMKA_AVX2(c, d, t); \
+	VPXOR   c, b, b;      \
+	VPADDQ  b, b, t;      \
+	VPSRLQ  $63, b, b;    \
+	VPXOR   t, b, b
+
+// Rotate b, c and d left by one, two and three words, or back with
+// 0x93, 0x4E and 0x39.
+#define PERMUTE_AVX2(b, c, d, pb, pc, pd) \
+	VPERMQ $pb, b, b; \
+	VPERMQ $pc, c, c; \
+	VPERMQ $pd, d, d
+
+// gRound on both states
+#define ROUND_AVX2 \
+	G1_AVX2(Y0, Y1, Y2, Y3, Y8);                \
+	G1_AVX2(Y4, Y5, Y6, Y7, Y9);                \
+	G2_AVX2(Y0, Y1, Y2, Y3, Y8);                \
+	G2_AVX2(Y4, Y5, Y6, Y7, Y9);                \
+	PERMUTE_AVX2(Y1, Y2, Y3, 0x39, 0x4E, 0x93); \
+	PERMUTE_AVX2(Y5, Y6, Y7, 0x39, 0x4E, 0x93); \
+	G1_AVX2(Y0, Y1, Y2, Y3, Y8);                \
+	G1_AVX2(Y4, Y5, Y6, Y7, Y9);                \
+	G2_AVX2(Y0, Y1, Y2, Y3, Y8);                \
+	G2_AVX2(Y4, Y5, Y6, Y7, Y9);                \
+	PERMUTE_AVX2(Y1, Y2, Y3, 0x93, 0x4E, 0x39); \
+	PERMUTE_AVX2(Y5, Y6, Y7, 0x93, 0x4E, 0x39)
+
+// Load a register from two 16-byte halves, and store it back.
+#define LOAD_HALVES(lo, hi, base, y, x) \
+	VMOVDQU     lo(base), x; \
+	VINSERTI128 $1, hi(base), y, y
+
+#define STORE_HALVES(lo, hi, base, y, x) \
+	VMOVDQU      x, lo(base); \
+	VEXTRACTI128 $1, y, hi(base)
+
+// func fillBlockAVX2(prev, ref, next *Block, withXOR bool)
+//
+// The same as fillBlockSSSE3 with twice the width.
+TEXT ·fillBlockAVX2(SB), 0, $1024-25
+	MOVQ    prev+0(FP), AX
+	MOVQ    ref+8(FP), BX
+	MOVQ    next+16(FP), CX
+	MOVBLZX withXOR+24(FP), DX
+	MOVQ    SP, DI
+	VMOVDQU rot24<>(SB), Y10
+	VMOVDQU rot16<>(SB), Y11
+
+	XORQ SI, SI
+
+prepare:
+	VMOVDQU (AX)(SI*1), Y0
+	VPXOR   (BX)(SI*1), Y0, Y0
+	VMOVDQA Y0, Y1
+	TESTQ   DX, DX
+	JZ      store
+	VPXOR   (CX)(SI*1), Y1, Y1
+
+store:
+	VMOVDQU Y0, (CX)(SI*1)
+	VMOVDQU Y1, (DI)(SI*1)
+	ADDQ    $32, SI
+	CMPQ    SI, $1024
+	JB      prepare
+
+	// Columns: two runs of 16 consecutive words per iteration
+	MOVQ CX, SI
+	MOVQ $4, R8
+
+columns:
+	VMOVDQU 0(SI), Y0
+	VMOVDQU 32(SI), Y1
+	VMOVDQU 64(SI), Y2
+	VMOVDQU 96(SI), Y3
+	VMOVDQU 128(SI), Y4
+	VMOVDQU 160(SI), Y5
+	VMOVDQU 192(SI), Y6
+	VMOVDQU 224(SI), Y7
+	ROUND_AVX2
+	VMOVDQU Y0, 0(SI)
+	VMOVDQU Y1, 32(SI)
+	VMOVDQU Y2, 64(SI)
+	VMOVDQU Y3, 96(SI)
+	VMOVDQU Y4, 128(SI)
+	VMOVDQU Y5, 160(SI)
+	VMOVDQU Y6, 192(SI)
+	VMOVDQU Y7, 224(SI)
+	ADDQ    $256, SI
+	DECQ    R8
+	JNZ     columns
+
+	// Rows: words 2i, 2i+1 and 2i+2, 2i+3 of every column per iteration
+	MOVQ CX, SI
+	MOVQ $4, R8
+
+rows:
+	LOAD_HALVES(0, 128, SI, Y0, X0)
+	LOAD_HALVES(256, 384, SI, Y1, X1)
+	LOAD_HALVES(512, 640, SI, Y2, X2)
+	LOAD_HALVES(768, 896, SI, Y3, X3)
+	LOAD_HALVES(16, 144, SI, Y4, X4)
+	LOAD_HALVES(272, 400, SI, Y5, X5)
+	LOAD_HALVES(528, 656, SI, Y6, X6)
+	LOAD_HALVES(784, 912, SI, Y7, X7)
+	ROUND_AVX2
+	STORE_HALVES(0, 128, SI, Y0, X0)
+	STORE_HALVES(256, 384, SI, Y1, X1)
+	STORE_HALVES(512, 640, SI, Y2, X2)
+	STORE_HALVES(768, 896, SI, Y3, X3)
+	STORE_HALVES(16, 144, SI, Y4, X4)
+	STORE_HALVES(272, 400, SI, Y5, X5)
+	STORE_HALVES(528, 656, SI, Y6, X6)
+	STORE_HALVES(784, 912, SI, Y7, X7)
+	ADDQ $32, SI
+	DECQ R8
+	JNZ  rows
+
+	XORQ SI, SI
+
+finish:
+	VMOVDQU (CX)(SI*1), Y0
+	VPXOR   (DI)(SI*1), Y0, Y0
+	VMOVDQU Y0, (CX)(SI*1)
+	ADDQ    $32, SI
+	CMPQ    SI, $1024
+	JB      finish
+
+	VZEROUPPER
+	RET
@@ -0,0 +1,18 @@
+//go:build !amd64
+
+package argon2
+
+// hasSSSE3 and hasAVX2 are false where there is no assembly
+// implementation.
+const (
+	hasSSSE3 = false
+	hasAVX2  = false
+)
+
+func fillBlockSSSE3(prev, ref, next *Block, withXOR bool) {
+	panic("argon2d: no SSSE3 implementation")
+}
+
+func fillBlockAVX2(prev, ref, next *Block, withXOR bool) {
+	panic("argon2d: no AVX2 implementation")
+}
@@ -1,6 +1,7 @@
-package argon2d
+package argon2
 
 import (
+	"math/rand"
 	"testing"
 )
 
@@ -257,6 +258,122 @@ func TestApplyBlake2bRound_Invertibility(t *testing.T) {
 	}
 }
 
+// implementations returns the implementations the CPU supports, by name.
+func implementations() map[string]Impl {
+	impls := map[string]Impl{"Generic": Generic}
+	if impl, ok := SSSE3(); ok {
+		impls["SSSE3"] = impl
+	}
+	if impl, ok := AVX2(); ok {
+		impls["AVX2"] = impl
+	}
+	return impls
+}
+
+// randomBlock fills b with random words.
+func randomBlock(rng *rand.Rand, b *Block) {
+	for i := range b {
+		b[i] = rng.Uint64()
+	}
+}
+
+// TestImpl_MatchesGeneric verifies every supported implementation gives
+// the blocks of the generic fillBlock, with and without XOR.
+func TestImpl_MatchesGeneric(t *testing.T) {
+	for name, impl := range implementations() {
+		rng := rand.New(rand.NewSource(1))
+		for n := 0; n < 200; n++ {
+			var prev, ref, next Block
+			randomBlock(rng, &prev)
+			randomBlock(rng, &ref)
+			randomBlock(rng, &next)
+			withXOR := n%2 == 1
+
+			got, want := next, next
+			impl.fillBlock(&prev, &ref, &got, withXOR)
+			fillBlock(&prev, &ref, &want, withXOR)
+			if got != want {
+				t.Fatalf("%s: block %d with withXOR = %v differs from fillBlock", name, n, withXOR)
+			}
+		}
+	}
+}
+
+// TestImpl_Aliasing verifies implementations handle the output block
+// being one of the inputs.
+func TestImpl_Aliasing(t *testing.T) {
+	for name, impl := range implementations() {
+		rng := rand.New(rand.NewSource(2))
+		var a, b Block
+		randomBlock(rng, &a)
+		randomBlock(rng, &b)
+
+		for _, withXOR := range []bool{false, true} {
+			got, want := a, a
+			impl.fillBlock(&got, &b, &got, withXOR)
+			fillBlock(&want, &b, &want, withXOR)
+			if got != want {
+				t.Errorf("%s: next == prev with withXOR = %v differs from fillBlock", name, withXOR)
+			}
+
+			got, want = a, a
+			impl.fillBlock(&b, &got, &got, withXOR)
+			fillBlock(&b, &want, &want, withXOR)
+			if got != want {
+				t.Errorf("%s: next == ref with withXOR = %v differs from fillBlock", name, withXOR)
+			}
+		}
+	}
+}
+
+// TestDefault verifies Default picks a supported implementation.
+func TestDefault(t *testing.T) {
+	want := Generic
+	if impl, ok := SSSE3(); ok {
+		want = impl
+	}
+	if impl, ok := AVX2(); ok {
+		want = impl
+	}
+	var prev, ref, got, expected Block
+	randomBlock(rand.New(rand.NewSource(3)), &prev)
+	Default().fillBlock(&prev, &ref, &got, false)
+	want.fillBlock(&prev, &ref, &expected, false)
+	if got != expected {
+		t.Error("Default() does not compress like the best supported implementation")
+	}
+}
+
+func benchmarkImpl(b *testing.B, impl Impl, ok bool) {
+	if !ok {
+		b.Skip("not supported by this CPU")
+	}
+	var prev, ref, next Block
+	rng := rand.New(rand.NewSource(1))
+	randomBlock(rng, &prev)
+	randomBlock(rng, &ref)
+
+	b.SetBytes(BlockSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		impl.fillBlock(&prev, &ref, &next, true)
+	}
+}
+
+func BenchmarkImplGeneric(b *testing.B) {
+	benchmarkImpl(b, Generic, true)
+}
+
+func BenchmarkImplSSSE3(b *testing.B) {
+	impl, ok := SSSE3()
+	benchmarkImpl(b, impl, ok)
+}
+
+func BenchmarkImplAVX2(b *testing.B) {
+	impl, ok := AVX2()
+	benchmarkImpl(b, impl, ok)
+}
+
 // Benchmark fillBlock performance.
 func BenchmarkFillBlock(b *testing.B) {
 	var prev, ref, next Block
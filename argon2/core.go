@@ -0,0 +1,235 @@
+// This file contains the main memory filling algorithm.
+
+package argon2
+
+import (
+	"context"
+	"sync"
+)
+
+// fillMemory implements the Argon2d memory filling algorithm.
+// It performs multiple passes over memory, using data-dependent addressing
+// to select reference blocks and compress them into current blocks.
+//
+// This is the main algorithm that makes Argon2d memory-hard and ASIC-resistant.
+//
+// Parameters:
+//   - memory: Pre-allocated slice of blocks to fill
+//   - passes: Number of passes to make over memory (3 for RandomX)
+//   - lanes: Number of parallel lanes (1 for RandomX - single-threaded)
+//
+// Algorithm per Argon2 specification:
+//
+//	For each pass (0 to passes-1):
+//	  For each slice (0 to SyncPoints-1):
+//	    For each block in segment:
+//	      1. Get pseudo-random from previous block (data-dependent!)
+//	      2. Compute reference index using indexAlpha
+//	      3. Mix prev, ref → current using fillBlock
+//	      4. Use XOR mode after first pass
+func fillMemory(memory []Block, passes, lanes uint32) {
+	// A background context is never cancelled, so the error is always nil.
+	_ = fillMemoryContext(context.Background(), memory, passes, lanes, Generic, nil)
+}
+
+// ProgressFunc receives periodic progress updates from the memory fill:
+// the current pass and slice, and the number of blocks processed so far
+// out of the total across all passes.
+type ProgressFunc func(pass, slice uint32, done, total uint64)
+
+// progressInterval is the number of blocks fillSegment processes between
+// progress reports. It must be a power of two.
+const progressInterval = 4096
+
+// instance is one Argon2 memory fill: the memory, its shape and how
+// blocks are addressed and compressed.
+type instance struct {
+	memory        []Block
+	passes        uint32
+	lanes         uint32
+	laneLength    uint32
+	segmentLength uint32
+	variant       Variant
+	impl          Impl
+}
+
+// newInstance returns the fill of memory, which holds lanes lanes of
+// equal length, with passes passes.
+func newInstance(memory []Block, passes, lanes uint32, variant Variant, impl Impl) *instance {
+	laneLength := uint32(len(memory)) / lanes
+	return &instance{
+		memory:        memory,
+		passes:        passes,
+		lanes:         lanes,
+		laneLength:    laneLength,
+		segmentLength: laneLength / SyncPoints,
+		variant:       variant,
+		impl:          impl,
+	}
+}
+
+// fillMemoryContext is fillMemory with cancellation and optional progress
+// reporting. The context is checked before every segment, so a cancelled
+// fill stops within one segment (1/4 of a lane) and returns ctx.Err().
+// The memory contents are undefined after a cancelled fill. Blocks are
+// compressed with impl.
+func fillMemoryContext(ctx context.Context, memory []Block, passes, lanes uint32, impl Impl, progress ProgressFunc) error {
+	return newInstance(memory, passes, lanes, Argon2d, impl).fill(ctx, progress)
+}
+
+// fill fills the memory, checking ctx before every slice and, without
+// several lanes, before every segment. With several lanes and no progress
+// function, the segments of a slice are filled concurrently; progress is
+// always called from one goroutine at a time.
+func (in *instance) fill(ctx context.Context, progress ProgressFunc) error {
+	total := uint64(in.passes) * uint64(len(in.memory))
+
+	for pass := uint32(0); pass < in.passes; pass++ {
+		for slice := uint32(0); slice < SyncPoints; slice++ {
+			if in.lanes > 1 && progress == nil {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				// Segments of a slice only reference blocks outside
+				// the slice or in their own lane, so they are
+				// independent.
+				var wg sync.WaitGroup
+				for lane := uint32(0); lane < in.lanes; lane++ {
+					wg.Add(1)
+					go func(lane uint32) {
+						defer wg.Done()
+						in.fillSegment(pass, lane, slice, nil)
+					}(lane)
+				}
+				wg.Wait()
+				continue
+			}
+
+			for lane := uint32(0); lane < in.lanes; lane++ {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				var report func(i uint32)
+				if progress != nil {
+					base := (uint64(pass*SyncPoints+slice)*uint64(in.lanes) + uint64(lane)) * uint64(in.segmentLength)
+					report = func(i uint32) {
+						progress(pass, slice, base+uint64(i), total)
+					}
+				}
+
+				// Process each block in the segment
+				in.fillSegment(pass, lane, slice, report)
+			}
+		}
+	}
+
+	if progress != nil {
+		progress(in.passes-1, SyncPoints-1, total, total)
+	}
+
+	return nil
+}
+
+// fillSegment processes one segment of memory in a lane.
+// A segment is 1/4 of the lane (SyncPoints = 4).
+//
+// This function implements the inner loop of Argon2, where:
+//   - Each block is filled by mixing previous and reference blocks
+//   - Reference blocks are selected from the previous block (Argon2d) or
+//     from address blocks (Argon2i, and the first half pass of Argon2id)
+//   - First pass initializes, later passes use XOR mode
+//
+// If report is non-nil it is called every progressInterval blocks with the
+// index of the block about to be processed.
+func (in *instance) fillSegment(pass, lane, slice uint32, report func(i uint32)) {
+	memory, laneLength, segmentLength := in.memory, in.laneLength, in.segmentLength
+
+	// Argon2i addressing takes pseudo-random values from address blocks,
+	// 128 at a time, generated from the position and a counter.
+	var addresses, input Block
+	dataIndependent := in.variant.dataIndependent(pass, slice)
+	if dataIndependent {
+		input[0] = uint64(pass)
+		input[1] = uint64(lane)
+		input[2] = uint64(slice)
+		input[3] = uint64(len(memory))
+		input[4] = uint64(in.passes)
+		input[5] = uint64(in.variant)
+	}
+
+	// Compute starting index for this segment
+	startIndex := slice * segmentLength
+
+	// Process each block in the segment
+	for i := uint32(0); i < segmentLength; i++ {
+		if report != nil && i&(progressInterval-1) == 0 {
+			report(i)
+		}
+
+		// The address block is generated before skipping the first two
+		// blocks, which the reference implementation does up front.
+		if dataIndependent && i%QWordsInBlock == 0 {
+			in.nextAddresses(&addresses, &input)
+		}
+
+		currentIndex := startIndex + i
+
+		// Special case: skip first two blocks in first segment of first pass
+		// (they are initialized separately from H0)
+		if pass == 0 && slice == 0 && currentIndex < 2 {
+			continue
+		}
+
+		// Compute current block offset in memory
+		currOffset := lane*laneLength + currentIndex
+
+		// Compute previous block offset (wraps around lane)
+		prevOffset := currOffset - 1
+		if currentIndex == 0 {
+			// First block of lane references last block
+			prevOffset = lane*laneLength + laneLength - 1
+		}
+
+		// Get the pseudo-random value: from the previous block's first
+		// uint64 for data-dependent addressing (the key to Argon2d),
+		// from the address block otherwise
+		pseudoRand := memory[prevOffset][0]
+		if dataIndependent {
+			pseudoRand = addresses[i%QWordsInBlock]
+		}
+
+		// The high half selects the reference lane, except in the first
+		// slice of the first pass, which only references its own lane
+		refLane := uint32(pseudoRand>>32) % in.lanes
+		if pass == 0 && slice == 0 {
+			refLane = lane
+		}
+
+		// Create position for indexAlpha
+		pos := Position{
+			Pass:  pass,
+			Lane:  lane,
+			Slice: slice,
+			Index: i, // Index within the segment
+		}
+
+		// Compute reference block index from the low half
+		refIndex := indexAlpha(&pos, pseudoRand, segmentLength, laneLength, refLane == lane)
+		refOffset := refLane*laneLength + refIndex
+
+		// Mix blocks: prev XOR ref → current
+		// Use XOR mode after first pass (withXOR = pass != 0)
+		in.impl.fillBlock(&memory[prevOffset], &memory[refOffset], &memory[currOffset], pass != 0)
+	}
+}
+
+// nextAddresses increments the counter in input and computes the next
+// address block, G(0, G(0, input)).
+func (in *instance) nextAddresses(addresses, input *Block) {
+	var zero Block
+	input[6]++
+	in.impl.fillBlock(&zero, input, addresses, false)
+	in.impl.fillBlock(&zero, addresses, addresses, false)
+}
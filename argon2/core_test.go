@@ -1,9 +1,24 @@
-package argon2d
+package argon2
 
 import (
+	"context"
+	"errors"
 	"testing"
 )
 
+// segmentInstance returns a single-lane, single-pass Argon2d fill of
+// memory with the given segment and lane lengths.
+func segmentInstance(memory []Block, segmentLength, laneLength uint32) *instance {
+	return &instance{
+		memory:        memory,
+		passes:        1,
+		lanes:         1,
+		laneLength:    laneLength,
+		segmentLength: segmentLength,
+		variant:       Argon2d,
+	}
+}
+
 // TestFillMemory_Basic verifies fillMemory processes memory correctly.
 func TestFillMemory_Basic(t *testing.T) {
 	// Create small memory for testing (32 blocks = 32 KB)
@@ -16,7 +31,7 @@ func TestFillMemory_Basic(t *testing.T) {
 	salt := []byte("test salt")
 	lanes := uint32(1)
 
-	h0 := initialHash(lanes, 32, numBlocks, 1, password, salt, nil, nil)
+	h0 := initialHash(Argon2d, lanes, 32, numBlocks, 1, password, salt, nil, nil)
 	initializeMemory(memory, lanes, h0)
 
 	// Fill memory with 1 pass
@@ -43,6 +58,63 @@ func TestFillMemory_Basic(t *testing.T) {
 	}
 }
 
+// TestFillMemoryContext_Canceled verifies a cancelled context stops the fill
+// and that an uncancelled one matches fillMemory.
+func TestFillMemoryContext_Canceled(t *testing.T) {
+	const numBlocks = 32
+	lanes := uint32(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	memory := make([]Block, numBlocks)
+	err := fillMemoryContext(ctx, memory, 1, lanes, Generic, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("fillMemoryContext() error = %v, want context.Canceled", err)
+	}
+
+	memory1 := make([]Block, numBlocks)
+	memory2 := make([]Block, numBlocks)
+	h0 := initialHash(Argon2d, lanes, 32, numBlocks, 1, []byte("password"), []byte("saltsalt"), nil, nil)
+	initializeMemory(memory1, lanes, h0)
+	initializeMemory(memory2, lanes, h0)
+
+	fillMemory(memory1, 1, lanes)
+	if err := fillMemoryContext(context.Background(), memory2, 1, lanes, Generic, nil); err != nil {
+		t.Fatalf("fillMemoryContext() error = %v", err)
+	}
+	for i := range memory1 {
+		if memory1[i] != memory2[i] {
+			t.Fatalf("block %d differs between fillMemory and fillMemoryContext", i)
+		}
+	}
+}
+
+// TestFillMemoryContext_Impls verifies every supported implementation
+// fills memory like fillMemory over several passes and lanes.
+func TestFillMemoryContext_Impls(t *testing.T) {
+	const numBlocks = 256
+	const passes, lanes = 3, 4
+
+	h0 := initialHash(Argon2d, lanes, 32, numBlocks, passes, []byte("password"), []byte("saltsalt"), nil, nil)
+	want := make([]Block, numBlocks)
+	initializeMemory(want, lanes, h0)
+	fillMemory(want, passes, lanes)
+
+	for name, impl := range implementations() {
+		memory := make([]Block, numBlocks)
+		initializeMemory(memory, lanes, h0)
+		if err := fillMemoryContext(context.Background(), memory, passes, lanes, impl, nil); err != nil {
+			t.Fatalf("%s: fillMemoryContext() error = %v", name, err)
+		}
+		for i := range want {
+			if memory[i] != want[i] {
+				t.Fatalf("%s: block %d differs from fillMemory", name, i)
+			}
+		}
+	}
+}
+
 // TestFillMemory_Deterministic verifies fillMemory is deterministic.
 func TestFillMemory_Deterministic(t *testing.T) {
 	const numBlocks = 32
@@ -85,7 +157,7 @@ func TestFillMemory_MultiPass(t *testing.T) {
 	// Initialize first two blocks using proper initialization
 	password := []byte("test password")
 	salt := []byte("test salt")
-	h0 := initialHash(lanes, 32, numBlocks, 1, password, salt, nil, nil)
+	h0 := initialHash(Argon2d, lanes, 32, numBlocks, 1, password, salt, nil, nil)
 	initializeMemory(memory, lanes, h0)
 
 	// Save initial state of block 2
@@ -163,7 +235,7 @@ func TestFillSegment_Basic(t *testing.T) {
 	}
 
 	// Fill first segment (blocks 0-7, but skips 0-1)
-	fillSegment(memory, 0, 0, 0, segmentLength, numBlocks)
+	segmentInstance(memory, segmentLength, numBlocks).fillSegment(0, 0, 0, nil)
 
 	// Blocks 2-7 should be modified
 	for i := uint32(2); i < segmentLength; i++ {
@@ -207,7 +279,7 @@ func TestFillSegment_FirstPassSkipsFirstTwo(t *testing.T) {
 	}
 
 	// Fill first segment
-	fillSegment(memory, 0, 0, 0, segmentLength, numBlocks)
+	segmentInstance(memory, segmentLength, numBlocks).fillSegment(0, 0, 0, nil)
 
 	// Blocks 0 and 1 should be unchanged
 	for i := range memory[0] {
@@ -235,7 +307,7 @@ func TestFillSegment_LaterSegments(t *testing.T) {
 
 	// Fill second segment (blocks 8-15)
 	slice := uint32(1)
-	fillSegment(memory, 0, 0, slice, segmentLength, numBlocks)
+	segmentInstance(memory, segmentLength, numBlocks).fillSegment(0, 0, slice, nil)
 
 	// All blocks in segment should be modified
 	// (we can't easily verify exact values, but check they changed)
@@ -274,8 +346,8 @@ func TestFillSegment_UsesDataDependentIndexing(t *testing.T) {
 	memory2[1][0] = 0xFFFFFFFFFFFFFFFF // Different pseudoRand source!
 
 	// Fill both
-	fillSegment(memory1, 0, 0, 0, segmentLength, numBlocks)
-	fillSegment(memory2, 0, 0, 0, segmentLength, numBlocks)
+	segmentInstance(memory1, segmentLength, numBlocks).fillSegment(0, 0, 0, nil)
+	segmentInstance(memory2, segmentLength, numBlocks).fillSegment(0, 0, 0, nil)
 
 	// Results should differ because pseudoRand was different
 	different := false
@@ -351,6 +423,6 @@ func BenchmarkFillSegment(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		fillSegment(memory, 0, 0, 0, segmentLength, numBlocks)
+		segmentInstance(memory, segmentLength, numBlocks).fillSegment(0, 0, 0, nil)
 	}
 }
@@ -0,0 +1,33 @@
+package argon2_test
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/opd-ai/go-randomx/argon2"
+)
+
+// Example of the RFC 9106 Argon2id test vector
+func ExampleHash() {
+	tag, err := argon2.Hash(bytes.Repeat([]byte{0x01}, 32), bytes.Repeat([]byte{0x02}, 16), argon2.Params{
+		Variant:        argon2.Argon2id,
+		Time:           3,
+		Memory:         32,
+		Lanes:          4,
+		TagLength:      32,
+		Secret:         bytes.Repeat([]byte{0x03}, 8),
+		AssociatedData: bytes.Repeat([]byte{0x04}, 12),
+	})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%x\n", tag)
+	// Output: 0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659
+}
+
+// Example of a drop-in replacement for x/crypto/argon2.IDKey
+func ExampleIDKey() {
+	key := argon2.IDKey([]byte("password"), []byte("somesalt"), 1, 64*1024, 4, 32)
+	fmt.Println(len(key))
+	// Output: 32
+}
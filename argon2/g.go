@@ -1,4 +1,4 @@
-package argon2d
+package argon2
 
 // g implements the Blake2b G mixing function used in Argon2 compression.
 //
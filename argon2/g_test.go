@@ -1,4 +1,4 @@
-package argon2d
+package argon2
 
 import (
 	"testing"
@@ -1,6 +1,6 @@
-// Package argon2d implements Argon2d (data-dependent mode) for RandomX.
-// This file contains data-dependent indexing logic for block selection.
-package argon2d
+// This file contains the indexing logic for reference block selection.
+
+package argon2
 
 const (
 	// SyncPoints is the number of segments per pass in Argon2.
@@ -21,9 +21,10 @@ type Position struct {
 	Index uint32 // Current index within slice
 }
 
-// indexAlpha computes the reference block index using data-dependent addressing.
+// indexAlpha computes the reference block index within the reference lane.
 //
-// This is the KEY DIFFERENCE between Argon2d and Argon2i:
+// The pseudo-random value comes from the previous block in Argon2d and
+// from an address block in Argon2i:
 // - Argon2i uses pseudo-random counter (data-independent)
 // - Argon2d uses pseudo-random from current block data (data-dependent)
 //
@@ -32,19 +33,22 @@ type Position struct {
 //
 // Parameters:
 //   - pos: Current position in memory
-//   - pseudoRand: Pseudo-random value from current block's first uint64
+//   - pseudoRand: Pseudo-random value; only the lower 32 bits are used
 //   - segmentLength: Number of blocks per segment
 //   - laneLength: Total blocks in the lane
+//   - sameLane: Whether the reference lane is the current lane
 //
 // Returns: Absolute block index to reference
 //
 // Algorithm per Argon2 specification (RFC 9106):
-//  1. Compute reference area size based on pass and slice
+//  1. Compute reference area size based on pass, slice and lane
 //  2. Map pseudoRand to relative position using quadratic distribution
 //  3. Convert relative position to absolute block index
-func indexAlpha(pos *Position, pseudoRand uint64, segmentLength, laneLength uint32) uint32 {
+func indexAlpha(pos *Position, pseudoRand uint64, segmentLength, laneLength uint32, sameLane bool) uint32 {
 	// Step 1: Determine the reference area size
-	// This is the number of blocks we can reference from current position
+	// This is the number of blocks we can reference from current position.
+	// Another lane can only be referenced in finished segments, and not
+	// at its last block while the first block of a segment is computed.
 	var referenceAreaSize uint32
 
 	if pos.Pass == 0 {
@@ -53,16 +57,24 @@ func indexAlpha(pos *Position, pseudoRand uint64, segmentLength, laneLength uint
 			// First slice of first pass: only previous blocks in same slice
 			// CRITICAL: Use pos.Index - 1 to exclude the previous block being written
 			referenceAreaSize = pos.Index - 1
-		} else {
+		} else if sameLane {
 			// Later slices: can reference all previous slices + current progress
 			referenceAreaSize = pos.Slice*segmentLength + pos.Index - 1
+		} else {
+			referenceAreaSize = pos.Slice * segmentLength
+			if pos.Index == 0 {
+				referenceAreaSize--
+			}
 		}
 	} else {
 		// Later passes: can reference all blocks except current segment
-		if pos.Slice == 0 {
+		if sameLane {
 			referenceAreaSize = laneLength - segmentLength + pos.Index - 1
 		} else {
-			referenceAreaSize = laneLength - segmentLength + pos.Index - 1
+			referenceAreaSize = laneLength - segmentLength
+			if pos.Index == 0 {
+				referenceAreaSize--
+			}
 		}
 	}
 
@@ -1,4 +1,4 @@
-package argon2d
+package argon2
 
 import (
 	"testing"
@@ -46,7 +46,7 @@ func TestIndexAlpha_FirstPassFirstSlice(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			refIndex := indexAlpha(&pos, tt.pseudoRand, segmentLength, laneLength)
+			refIndex := indexAlpha(&pos, tt.pseudoRand, segmentLength, laneLength, true)
 
 			// Must reference a block before current index (0 to Index-1)
 			if refIndex >= pos.Index {
@@ -70,7 +70,7 @@ func TestIndexAlpha_FirstPassLaterSlice(t *testing.T) {
 	laneLength := uint32(400)
 
 	pseudoRand := uint64(0x12345678)
-	refIndex := indexAlpha(&pos, pseudoRand, segmentLength, laneLength)
+	refIndex := indexAlpha(&pos, pseudoRand, segmentLength, laneLength, true)
 
 	// Maximum reference: slice*segmentLength + index - 1
 	maxRef := pos.Slice*segmentLength + pos.Index
@@ -93,7 +93,7 @@ func TestIndexAlpha_LaterPass(t *testing.T) {
 	laneLength := uint32(400)
 
 	pseudoRand := uint64(0xABCDEF01)
-	refIndex := indexAlpha(&pos, pseudoRand, segmentLength, laneLength)
+	refIndex := indexAlpha(&pos, pseudoRand, segmentLength, laneLength, true)
 
 	// Must be within lane bounds
 	if refIndex >= laneLength {
@@ -117,7 +117,7 @@ func TestIndexAlpha_Deterministic(t *testing.T) {
 	// Call multiple times with same inputs
 	results := make([]uint32, 10)
 	for i := 0; i < 10; i++ {
-		results[i] = indexAlpha(&pos, pseudoRand, segmentLength, laneLength)
+		results[i] = indexAlpha(&pos, pseudoRand, segmentLength, laneLength, true)
 	}
 
 	// All results should be identical
@@ -139,7 +139,7 @@ func TestIndexAlpha_DifferentPseudoRand(t *testing.T) {
 	results := make(map[uint32]bool)
 	for i := uint64(0); i < 100; i++ {
 		pseudoRand := i * uint64(0x123456789ABCDEF)
-		refIndex := indexAlpha(&pos, pseudoRand, segmentLength, laneLength)
+		refIndex := indexAlpha(&pos, pseudoRand, segmentLength, laneLength, true)
 		results[refIndex] = true
 	}
 
@@ -163,7 +163,7 @@ func TestIndexAlpha_QuadraticDistribution(t *testing.T) {
 
 	for i := 0; i < samples; i++ {
 		pseudoRand := uint64(i) * uint64(0x9E3779B97F4A7C15) // Good mixing multiplier
-		refIndex := indexAlpha(&pos, pseudoRand, segmentLength, laneLength)
+		refIndex := indexAlpha(&pos, pseudoRand, segmentLength, laneLength, true)
 
 		// Place into bin (0=oldest, 9=most recent)
 		bin := int(refIndex * 10 / pos.Index)
@@ -229,7 +229,7 @@ func TestIndexAlpha_BoundaryConditions(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			refIndex := indexAlpha(&tt.pos, tt.pseudoRand, tt.segmentLength, tt.laneLength)
+			refIndex := indexAlpha(&tt.pos, tt.pseudoRand, tt.segmentLength, tt.laneLength, true)
 
 			// Basic validation: must be within lane
 			if refIndex >= tt.laneLength {
@@ -263,7 +263,7 @@ func TestIndexAlpha_NoSelfReference(t *testing.T) {
 		// Try many pseudo-random values
 		for i := uint64(0); i < 100; i++ {
 			pseudoRand := i * uint64(0x123456789)
-			refIndex := indexAlpha(&tt.pos, pseudoRand, tt.segmentLength, tt.laneLength)
+			refIndex := indexAlpha(&tt.pos, pseudoRand, tt.segmentLength, tt.laneLength, true)
 
 			// Reference should not be current block
 			if refIndex == currentBlock {
@@ -291,7 +291,7 @@ func BenchmarkIndexAlpha(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = indexAlpha(&pos, pseudoRand, segmentLength, laneLength)
+		_ = indexAlpha(&pos, pseudoRand, segmentLength, laneLength, true)
 	}
 }
 
@@ -304,6 +304,6 @@ func BenchmarkIndexAlpha_VaryingInput(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		pseudoRand := uint64(i) * uint64(0x9E3779B97F4A7C15)
-		_ = indexAlpha(&pos, pseudoRand, segmentLength, laneLength)
+		_ = indexAlpha(&pos, pseudoRand, segmentLength, laneLength, true)
 	}
 }
@@ -1,4 +1,4 @@
-package argon2d
+package argon2
 
 import (
 	"encoding/binary"
@@ -6,19 +6,19 @@ import (
 	"testing"
 )
 
-// TestArgon2dCache_RandomXReference tests against known RandomX cache output.
+// TestRandomXCache_RandomXReference tests against known RandomX cache output.
 // The RandomX reference implementation generates cache with "test key 000".
 // The first uint64 at cache[0] should be 0x191e0e1d23c02186.
 //
 // Note: RandomX cache is the entire 256 MB Argon2 memory, not a finalized hash.
-func TestArgon2dCache_RandomXReference(t *testing.T) {
+func TestRandomXCache_RandomXReference(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping Argon2d cache test in short mode")
 	}
 
 	key := []byte("test key 000")
 
-	cache := Argon2dCache(key)
+	cache := RandomXCache(key)
 
 	// RandomX cache is 256 MB (262144 blocks * 1024 bytes = 268435456 bytes)
 	expectedSize := 262144 * 1024
@@ -54,7 +54,7 @@ func TestArgon2dParameters(t *testing.T) {
 	t.Logf("  Lanes: 1")
 	t.Logf("  Output: 262144 bytes (256 KB)")
 
-	cache := Argon2dCache(key)
+	cache := RandomXCache(key)
 	t.Logf("  Generated cache size: %d bytes", len(cache))
 	t.Logf("  First 32 bytes: %s", hex.EncodeToString(cache[:32]))
 }
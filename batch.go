@@ -0,0 +1,179 @@
+package randomx
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/opd-ai/go-randomx/internal"
+)
+
+// BatchResult is the hash of one input read by HashStream.
+type BatchResult struct {
+	// Index is the position of the input in the stream, starting at 0.
+	Index int
+
+	// Hash is the RandomX hash of the input. It is zero if Err is set.
+	Hash [32]byte
+
+	// Err is ErrClosed if the hasher was closed, or the context error if
+	// the stream was cancelled while the input was being hashed.
+	Err error
+}
+
+// batchWorkers returns the number of workers to use for n inputs, or for
+// an unknown number of inputs if n is negative. Hashing is CPU bound, so
+// there is one worker per processor the scheduler may use.
+func batchWorkers(n int) int {
+	workers := runtime.GOMAXPROCS(0)
+	if n >= 0 && n < workers {
+		workers = n
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
+
+// HashBatch computes the RandomX hash of every input in parallel and
+// returns the hashes in input order.
+//
+// The work is spread over one worker per available processor, each of
+// which keeps a single VM for all the inputs it hashes. If ctx is done or
+// the hasher is closed part-way through, HashBatch stops every worker
+// within one VM program and returns a nil slice with the error.
+func (h *Hasher) HashBatch(ctx context.Context, inputs [][]byte) ([][32]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([][32]byte, len(inputs))
+
+	var (
+		next     atomic.Int64
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	workers := batchWorkers(len(inputs))
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			vm := h.getVM()
+			defer h.putVM(vm)
+
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= len(inputs) {
+					return
+				}
+
+				hash, err := h.hashWithVM(ctx, vm, internal.Blake2b512(inputs[i]))
+				if err != nil {
+					// Keep the first error; the others are just the
+					// cancellation it triggers.
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+				results[i] = hash
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+// HashStream hashes inputs as they arrive on the channel and delivers the
+// results on the returned channel in input order. Inputs are hashed in
+// parallel by one worker per available processor; only a few inputs are
+// read ahead of the consumer, so a slow consumer slows the stream down
+// rather than buffering results without bound.
+//
+// The returned channel is closed once inputs is closed and every result
+// has been delivered, or as soon as ctx is done. Inputs that were being
+// hashed when ctx was cancelled may be reported with Err set.
+func (h *Hasher) HashStream(ctx context.Context, inputs <-chan []byte) <-chan BatchResult {
+	type job struct {
+		index  int
+		input  []byte
+		result chan BatchResult
+	}
+
+	workers := batchWorkers(-1)
+	jobs := make(chan job)
+	// pending holds the result channel of each dispatched input in input
+	// order. Its capacity bounds how far hashing runs ahead of the consumer.
+	pending := make(chan chan BatchResult, workers)
+	out := make(chan BatchResult)
+
+	// Dispatcher: number the inputs and hand them to the workers.
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+
+		for i := 0; ; i++ {
+			var input []byte
+			select {
+			case <-ctx.Done():
+				return
+			case in, ok := <-inputs:
+				if !ok {
+					return
+				}
+				input = in
+			}
+
+			result := make(chan BatchResult, 1)
+			select {
+			case <-ctx.Done():
+				return
+			case pending <- result:
+			}
+			jobs <- job{index: i, input: input, result: result}
+		}
+	}()
+
+	// Workers: each keeps one VM for the lifetime of the stream.
+	for w := 0; w < workers; w++ {
+		go func() {
+			vm := h.getVM()
+			defer h.putVM(vm)
+
+			for j := range jobs {
+				hash, err := h.hashWithVM(ctx, vm, internal.Blake2b512(j.input))
+				j.result <- BatchResult{Index: j.index, Hash: hash, Err: err}
+			}
+		}()
+	}
+
+	// Collector: deliver results in the order the inputs arrived.
+	go func() {
+		defer close(out)
+
+		for result := range pending {
+			r := <-result
+			select {
+			case <-ctx.Done():
+				return
+			case out <- r:
+			}
+		}
+	}()
+
+	return out
+}
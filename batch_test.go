@@ -0,0 +1,128 @@
+package randomx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Test that batch results are in input order and match Hash
+func TestHashBatch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping hasher test in short mode")
+	}
+
+	hasher, err := New(Config{
+		Mode:     LightMode,
+		CacheKey: []byte("batch test"),
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer hasher.Close()
+
+	inputs := make([][]byte, 5)
+	for i := range inputs {
+		inputs[i] = []byte(fmt.Sprintf("input %d", i))
+	}
+
+	got, err := hasher.HashBatch(context.Background(), inputs)
+	if err != nil {
+		t.Fatalf("HashBatch() error = %v", err)
+	}
+	if len(got) != len(inputs) {
+		t.Fatalf("HashBatch() returned %d hashes, want %d", len(got), len(inputs))
+	}
+	for i, input := range inputs {
+		if want := hasher.Hash(input); got[i] != want {
+			t.Errorf("hash %d = %x, want %x", i, got[i], want)
+		}
+	}
+
+	// Streaming variant
+	in := make(chan []byte)
+	go func() {
+		defer close(in)
+		for _, input := range inputs {
+			in <- input
+		}
+	}()
+
+	n := 0
+	for r := range hasher.HashStream(context.Background(), in) {
+		if r.Err != nil {
+			t.Fatalf("HashStream() result %d error = %v", r.Index, r.Err)
+		}
+		if r.Index != n {
+			t.Errorf("HashStream() result %d has Index %d", n, r.Index)
+		}
+		if r.Hash != got[n] {
+			t.Errorf("HashStream() result %d = %x, want %x", n, r.Hash, got[n])
+		}
+		n++
+	}
+	if n != len(inputs) {
+		t.Errorf("HashStream() delivered %d results, want %d", n, len(inputs))
+	}
+}
+
+// Test cancelling a batch and a stream part-way through
+func TestHashBatchCancel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping hasher test in short mode")
+	}
+
+	hasher, err := New(Config{
+		Mode:     LightMode,
+		CacheKey: []byte("batch cancel test"),
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer hasher.Close()
+
+	inputs := make([][]byte, 1000)
+	for i := range inputs {
+		inputs[i] = []byte(fmt.Sprintf("input %d", i))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan []byte)
+	go func() {
+		defer close(in)
+		for _, input := range inputs {
+			select {
+			case in <- input:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	n := 0
+	for range hasher.HashStream(ctx, in) {
+		n++
+		if n == 1 {
+			cancel()
+		}
+	}
+	if n >= len(inputs) {
+		t.Errorf("HashStream() delivered all %d results after cancellation", n)
+	}
+
+	// The batch is cancelled from another goroutine while it runs
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		hasher.Hash([]byte("let the batch start"))
+		cancel()
+	}()
+	if _, err := hasher.HashBatch(ctx, inputs); !errors.Is(err, context.Canceled) {
+		t.Errorf("HashBatch() error = %v, want context.Canceled", err)
+	}
+
+	hasher.Close()
+	if _, err := hasher.HashBatch(context.Background(), inputs[:2]); !errors.Is(err, ErrClosed) {
+		t.Errorf("HashBatch() after Close error = %v, want ErrClosed", err)
+	}
+}
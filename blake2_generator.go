@@ -1,59 +1,67 @@
 package randomx
 
 import (
+	"encoding/binary"
+
 	"github.com/opd-ai/go-randomx/internal"
 )
 
+// blake2GeneratorMaxSeedSize is the number of seed bytes the generator
+// uses. The 4 bytes after them hold the nonce.
+const blake2GeneratorMaxSeedSize = 60
+
 // blake2Generator is a deterministic pseudo-random number generator
 // based on Blake2b. It's used to generate superscalar programs.
 //
-// The generator maintains a 64-byte state that is repeatedly hashed
-// with Blake2b to produce a stream of pseudo-random bytes.
+// The generator maintains a 64-byte buffer that is replaced by its own
+// Blake2b-512 hash whenever a read needs more bytes than remain.
 type blake2Generator struct {
 	data [64]byte // Current Blake2b-512 output
-	pos  int      // Position in current output (0-63)
+	pos  int      // Position in current output (0-64)
 }
 
 // newBlake2Generator creates a new Blake2Generator initialized with a seed.
-// The seed is hashed with Blake2b-512 to create the initial state.
+// As in the reference implementation, the buffer starts as the first 60
+// bytes of the seed followed by the nonce, which is 0 for the cache, and
+// is hashed before the first read.
 func newBlake2Generator(seed []byte) *blake2Generator {
 	g := &blake2Generator{
 		pos: 64, // Force initial generation
 	}
-	
-	// Hash the seed to get initial state
-	hash := internal.Blake2b512(seed)
-	copy(g.data[:], hash[:])
-	
+
+	n := len(seed)
+	if n > blake2GeneratorMaxSeedSize {
+		n = blake2GeneratorMaxSeedSize
+	}
+	copy(g.data[:], seed[:n])
+	binary.LittleEndian.PutUint32(g.data[blake2GeneratorMaxSeedSize:], 0)
+
 	return g
 }
 
-// generate produces the next 64 bytes of pseudo-random data.
-// This is called automatically when the current buffer is exhausted.
-func (g *blake2Generator) generate() {
-	// Hash the current state to get the next state
-	hash := internal.Blake2b512(g.data[:])
-	copy(g.data[:], hash[:])
-	g.pos = 0
+// checkData rehashes the buffer if fewer than n bytes remain in it.
+func (g *blake2Generator) checkData(n int) {
+	if g.pos+n > len(g.data) {
+		hash := internal.Blake2b512(g.data[:])
+		copy(g.data[:], hash[:])
+		g.pos = 0
+	}
 }
 
 // getByte returns the next pseudo-random byte.
 func (g *blake2Generator) getByte() byte {
-	if g.pos >= 64 {
-		g.generate()
-	}
+	g.checkData(1)
 	b := g.data[g.pos]
 	g.pos++
 	return b
 }
 
 // getUint32 returns the next pseudo-random uint32 in little-endian format.
+// The 4 bytes always come from the same buffer: if fewer remain, they are
+// skipped.
 func (g *blake2Generator) getUint32() uint32 {
-	// Get 4 bytes and combine into uint32
-	b0 := uint32(g.getByte())
-	b1 := uint32(g.getByte())
-	b2 := uint32(g.getByte())
-	b3 := uint32(g.getByte())
-	
-	return b0 | (b1 << 8) | (b2 << 16) | (b3 << 24)
+	g.checkData(4)
+	v := binary.LittleEndian.Uint32(g.data[g.pos:])
+	g.pos += 4
+	return v
 }
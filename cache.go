@@ -1,8 +1,10 @@
 package randomx
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/opd-ai/go-randomx/argon2"
 	"github.com/opd-ai/go-randomx/internal"
 )
 
@@ -23,33 +25,61 @@ type cache struct {
 	key         []byte                 // Cache key (seed) used to generate this cache
 	programs    []*superscalarProgram  // Superscalar programs for dataset generation (8 programs)
 	reciprocals []uint64               // Pre-computed reciprocals for IMUL_RCP instructions
+	superscalar *superscalarCode       // Programs compiled to native code, or nil to interpret them
+	unmap       func() error           // Unmaps data if it is mapped memory, or nil
+	pages       PageKind               // Kind of pages backing data
 }
 
 // newCache creates a new RandomX cache from the given seed.
 func newCache(seed []byte) (*cache, error) {
+	return newCacheContext(context.Background(), seed, false, argon2.Default(), nil)
+}
+
+// newCacheContext creates a new RandomX cache from the given seed, aborting
+// with ctx.Err() if the context is cancelled. The context is checked during
+// the Argon2d fill and before each superscalar program is generated.
+// With largePages the cache is backed by huge pages if possible. The
+// Argon2d fill compresses blocks with argon2Impl. Progress updates go to
+// progress, which may be nil.
+func newCacheContext(ctx context.Context, seed []byte, largePages bool, argon2Impl argon2.Impl, progress *progressReporter) (*cache, error) {
 	if len(seed) == 0 {
 		return nil, fmt.Errorf("cache seed must not be empty")
 	}
 
 	c := &cache{
-		key:  append([]byte(nil), seed...), // Copy seed
-		data: make([]byte, cacheSize),
+		key: append([]byte(nil), seed...), // Copy seed
 	}
 
-	// Generate cache using Argon2d
-	cacheData := internal.Argon2dCache(seed)
-	if len(cacheData) != cacheSize {
-		return nil, fmt.Errorf("argon2 output size mismatch: got %d, want %d",
-			len(cacheData), cacheSize)
+	// Generate cache using Argon2d, filling the cache memory in place
+	c.data, c.pages, c.unmap = allocateAlignedDataset(cacheSize, largePages)
+	progress.begin(PhaseArgon2d)
+	if err := internal.Argon2dCacheInto(ctx, seed, c.data, argon2Impl, progress.argon2d()); err != nil {
+		c.release()
+		return nil, err
 	}
 
-	copy(c.data, cacheData)
+	if err := c.generatePrograms(ctx, progress); err != nil {
+		c.release()
+		return nil, err
+	}
+
+	return c, nil
+}
 
-	// Generate superscalar programs for dataset item generation
-	gen := newBlake2Generator(seed)
+// generatePrograms generates the superscalar programs for dataset item
+// generation from the cache key. It is separate from the Argon2d fill so
+// that a cache loaded from disk can rebuild its programs.
+func (c *cache) generatePrograms(ctx context.Context, progress *progressReporter) error {
+	gen := newBlake2Generator(c.key)
 	c.programs = make([]*superscalarProgram, cacheAccesses)
+	c.reciprocals = nil
+	progress.begin(PhaseSuperscalar)
 	
 	for i := 0; i < cacheAccesses; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		c.programs[i] = generateSuperscalarProgram(gen)
 		
 		// Pre-compute reciprocals for IMUL_RCP instructions in this program
@@ -62,20 +92,44 @@ func newCache(seed []byte) (*cache, error) {
 				c.reciprocals = append(c.reciprocals, rcp)
 			}
 		}
+
+		progress.report(0, 0, uint64(i+1), cacheAccesses)
 	}
 
-	return c, nil
+	// Compile the programs where the JIT is supported. If that fails,
+	// dataset items are computed by the interpreter as elsewhere.
+	c.releaseSuperscalar()
+	if jitSupported {
+		c.superscalar, _ = compileSuperscalar(c.programs, c.reciprocals)
+	}
+
+	return nil
 }
 
-// release frees the cache resources.
+// releaseSuperscalar unmaps the compiled superscalar programs.
+func (c *cache) releaseSuperscalar() {
+	if c.superscalar != nil {
+		c.superscalar.release()
+		c.superscalar = nil
+	}
+}
+
+// release frees the cache resources. Mapped memory is returned to the
+// operating system; heap memory is cleared and left to the garbage
+// collector.
 func (c *cache) release() {
 	if c.data != nil {
-		zeroBytes(c.data)
+		if c.unmap == nil {
+			zeroBytes(c.data)
+		}
+		releaseDataset(c.data, c.unmap)
+		c.unmap = nil
 		c.data = nil
 	}
 	c.key = nil
 	c.programs = nil
 	c.reciprocals = nil
+	c.releaseSuperscalar()
 }
 
 // getItem returns the cache item at the specified index.
@@ -87,3 +141,75 @@ func (c *cache) getItem(index uint32) []byte {
 	offset := index * 64
 	return c.data[offset : offset+64]
 }
+
+// Cache is a RandomX cache that can be shared by several datasets and
+// VMs, like the cache returned by randomx_alloc_cache and filled by
+// randomx_init_cache in the reference implementation.
+//
+// A Cache is reference counted. NewCache returns it with one reference,
+// owned by the caller; every VM that uses it takes its own reference. The
+// 256 MB of cache memory is freed when the last reference is released,
+// so the caller may Release its reference as soon as it has handed the
+// cache to the VMs that need it.
+type Cache struct {
+	c     *cache
+	refs  refCount
+	flags Flags // Flags the cache was created with
+}
+
+// NewCache builds a cache for key, like randomx_alloc_cache and
+// randomx_init_cache. This takes a few seconds and uses about 256 MB of
+// memory. Of the flags, FlagLargePages and the Argon2 flags apply, as they
+// do for New; NewCache fails with ErrUnsupportedFlags if a flag is not
+// supported on this machine.
+func NewCache(key []byte, flags Flags) (*Cache, error) {
+	return NewCacheContext(context.Background(), key, flags)
+}
+
+// NewCacheContext is like NewCache but stops as soon as ctx is done,
+// returning an error that wraps ctx.Err().
+func NewCacheContext(ctx context.Context, key []byte, flags Flags) (*Cache, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+	if err := checkFlags(flags); err != nil {
+		return nil, err
+	}
+
+	c, err := newCacheContext(ctx, key, flags.largePages(), flags.argon2Impl(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("randomx: cache initialization: %w", err)
+	}
+
+	cache := &Cache{c: c, flags: flags}
+	cache.refs.init()
+	return cache, nil
+}
+
+// Key returns a copy of the key the cache was built from.
+func (c *Cache) Key() []byte {
+	return append([]byte(nil), c.c.key...)
+}
+
+// Pages reports the kind of pages backing the cache memory.
+func (c *Cache) Pages() PageKind {
+	return c.c.pages
+}
+
+// Retain adds a reference to the cache. It returns ErrClosed if the cache
+// has already been freed.
+func (c *Cache) Retain() error {
+	if !c.refs.retain() {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Release drops a reference to the cache and frees its memory when the
+// last reference is gone. Releasing more references than were taken
+// panics.
+func (c *Cache) Release() {
+	if c.refs.release("Cache") {
+		c.c.release()
+	}
+}
@@ -1,10 +1,13 @@
 package randomx
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
+	"math/bits"
 	"runtime"
 	"sync"
+	"sync/atomic"
 
 	"github.com/opd-ai/go-randomx/internal"
 )
@@ -15,38 +18,76 @@ const (
 
 	// Number of dataset items (each item is 64 bytes)
 	datasetItems = datasetSize / 64
+
+	// Size of the part of the dataset addressed by ma and mx
+	datasetBaseSize = 2147483648
+
+	// Number of items past the base size that a program's datasetOffset
+	// can reach (RANDOMX_DATASET_EXTRA_SIZE / 64)
+	datasetExtraItems = 33554368 / 64
+
+	// Mask aligning ma and mx to an item within the base size
+	cacheLineAlignMask = (datasetBaseSize - 1) &^ (cacheLineSize - 1)
 )
 
 // dataset holds the full RandomX dataset for fast mode operation.
 // The dataset is ~2 GB and is generated from the cache.
 type dataset struct {
-	data []byte // Full dataset (2+ GB)
+	data     []byte       // Full dataset (2+ GB)
+	unmap    func() error // Unmaps data if it is mapped memory, or nil
+	readOnly bool         // Set if data is mapped without write access
+	pages    PageKind     // Kind of pages backing data
 }
 
 // newDataset creates and initializes a new RandomX dataset from the cache.
 // This is an expensive operation taking 20-30 seconds.
 func newDataset(c *cache) (*dataset, error) {
+	return newDatasetContext(context.Background(), c, false, nil)
+}
+
+// newDatasetContext creates and initializes a new RandomX dataset from the
+// cache, aborting with ctx.Err() if the context is cancelled. A cancelled
+// build releases the partially generated dataset before returning. With
+// largePages the dataset is backed by huge pages if possible. Progress
+// updates go to progress, which may be nil.
+func newDatasetContext(ctx context.Context, c *cache, largePages bool, progress *progressReporter) (*dataset, error) {
 	if c == nil || len(c.data) == 0 {
 		return nil, fmt.Errorf("invalid cache")
 	}
 
-	ds := &dataset{
-		data: make([]byte, datasetSize),
-	}
+	ds := newDatasetMemory(largePages)
 
 	// Generate dataset items in parallel
-	if err := ds.generate(c); err != nil {
+	if err := ds.generate(ctx, c, progress); err != nil {
+		ds.release()
 		return nil, err
 	}
 
 	return ds, nil
 }
 
+// datasetChunkItems is the number of items a worker generates between
+// context checks and progress reports. Cancellation takes effect within
+// one chunk per worker, and the shared progress counter stays off the hot
+// path.
+const datasetChunkItems = 1024
+
 // generate creates all dataset items from the cache using parallel workers.
-func (ds *dataset) generate(c *cache) error {
-	numWorkers := runtime.NumCPU()
+// Each worker checks ctx between chunks of items and stops early once it
+// is cancelled; the first error observed is returned. Completed chunks are
+// added to a shared counter and reported to progress.
+func (ds *dataset) generate(ctx context.Context, c *cache, progress *progressReporter) error {
+	return ds.generateWorkers(ctx, c, progress, runtime.NumCPU())
+}
+
+// generateWorkers is generate with an explicit number of workers, each
+// filling one contiguous share of the items.
+func (ds *dataset) generateWorkers(ctx context.Context, c *cache, progress *progressReporter, numWorkers int) error {
 	itemsPerWorker := datasetItems / uint64(numWorkers)
 
+	progress.begin(PhaseDataset)
+	var done atomic.Uint64
+
 	var wg sync.WaitGroup
 	errChan := make(chan error, numWorkers)
 
@@ -61,9 +102,15 @@ func (ds *dataset) generate(c *cache) error {
 				end = datasetItems
 			}
 
-			for item := start; item < end; item++ {
-				offset := item * 64
-				ds.generateItem(c, item, ds.data[offset:offset+64])
+			var onChunk func()
+			if progress != nil {
+				onChunk = func() {
+					progress.report(0, 0, done.Add(datasetChunkItems), datasetItems)
+				}
+			}
+
+			if err := ds.generateRange(ctx, c, start, ds.data[start*64:end*64], onChunk); err != nil {
+				errChan <- err
 			}
 		}(w)
 	}
@@ -76,13 +123,51 @@ func (ds *dataset) generate(c *cache) error {
 	case err := <-errChan:
 		return err
 	default:
+		progress.report(0, 0, datasetItems, datasetItems)
 		return nil
 	}
 }
 
+// generateRange fills dst with the len(dst)/64 dataset items starting at
+// item start, on the calling goroutine. It checks ctx between chunks of
+// datasetChunkItems items and calls onChunk, if non-nil, after each full
+// chunk except the last.
+func (ds *dataset) generateRange(ctx context.Context, c *cache, start uint64, dst []byte, onChunk func()) error {
+	count := uint64(len(dst)) / 64
+	for n := uint64(0); n < count; n += datasetChunkItems {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if n > 0 && onChunk != nil {
+			onChunk()
+		}
+
+		end := n + datasetChunkItems
+		if end > count {
+			end = count
+		}
+		chunk := dst[n*64 : end*64]
+		if c.superscalar != nil {
+			c.superscalar.run(c.data, start+n, chunk)
+			continue
+		}
+		for i := uint64(0); i < end-n; i++ {
+			generateItem(c, start+n+i, chunk[i*64:i*64+64])
+		}
+	}
+	return nil
+}
+
 // generateItem creates a single dataset item using superscalar hash.
 // This implements the RandomX initDatasetItem function from the C++ reference.
-func (ds *dataset) generateItem(c *cache, itemNumber uint64, output []byte) {
+// If the cache has compiled superscalar programs, they are used instead of
+// the interpreter.
+func generateItem(c *cache, itemNumber uint64, output []byte) {
+	if c.superscalar != nil {
+		c.superscalar.run(c.data, itemNumber, output[:64])
+		return
+	}
+
 	// Superscalar constants (from RandomX C++ reference)
 	const (
 		superscalarMul0 = 6364136223846793005
@@ -135,10 +220,19 @@ func (ds *dataset) generateItem(c *cache, itemNumber uint64, output []byte) {
 	}
 }
 
-// release frees the dataset resources.
+// newDatasetMemory returns an uninitialized dataset backed by memory from
+// allocateAlignedDataset.
+func newDatasetMemory(largePages bool) *dataset {
+	data, pages, free := allocateAlignedDataset(datasetSize, largePages)
+	return &dataset{data: data, unmap: free, pages: pages}
+}
+
+// release frees the dataset resources. Mapped memory, whether anonymous
+// or from a file, is unmapped at once.
 func (ds *dataset) release() {
 	if ds.data != nil {
-		releaseDataset(ds.data)
+		releaseDataset(ds.data, ds.unmap)
+		ds.unmap = nil
 		ds.data = nil
 	}
 }
@@ -158,3 +252,274 @@ func hashBlake2b(input []byte) []byte {
 	hash := internal.Blake2b512(input)
 	return hash[:]
 }
+
+// Dataset is a RandomX fast mode dataset that can be shared by several
+// VMs, like the dataset returned by randomx_alloc_dataset and filled by
+// randomx_init_dataset in the reference implementation.
+//
+// A Dataset is reference counted in the same way as Cache: NewDataset
+// returns it with one reference owned by the caller, every VM that uses
+// it takes its own reference, and the 2 GB of dataset memory is freed
+// when the last reference is released. The dataset does not keep a
+// reference to the cache it was built from.
+type Dataset struct {
+	ds   *dataset
+	refs refCount
+
+	mu      sync.Mutex // Protects key and pending while ranges are initialized concurrently
+	key     []byte
+	pending *itemSet // Items initialized so far, or nil once all are
+}
+
+// NewDataset builds the dataset for c. This is expensive: it takes tens
+// of seconds and uses about 2 GB of memory. The dataset is backed by huge
+// pages if the cache was created with FlagLargePages.
+func NewDataset(c *Cache) (*Dataset, error) {
+	return NewDatasetContext(context.Background(), c)
+}
+
+// NewDatasetContext is like NewDataset but stops as soon as ctx is done,
+// returning an error that wraps ctx.Err(). The cache must stay retained
+// until NewDatasetContext returns.
+func NewDatasetContext(ctx context.Context, c *Cache) (*Dataset, error) {
+	if err := c.Retain(); err != nil {
+		return nil, err
+	}
+	defer c.Release()
+
+	ds, err := newDatasetContext(ctx, c.c, c.flags.largePages(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("randomx: dataset initialization: %w", err)
+	}
+
+	d := &Dataset{ds: ds, key: c.Key()}
+	d.refs.init()
+	return d, nil
+}
+
+// Key returns a copy of the key of the cache the dataset was built from,
+// or nil for a dataset from AllocDataset that has not been initialized.
+func (d *Dataset) Key() []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]byte(nil), d.key...)
+}
+
+// Pages reports the kind of pages backing the dataset memory. It is
+// PagesFile for a dataset mapped by LoadDatasetFile.
+func (d *Dataset) Pages() PageKind {
+	return d.ds.pages
+}
+
+// DatasetItemCount returns the number of 64-byte items in a dataset, like
+// randomx_dataset_item_count. Item ranges passed to InitRange and
+// GenerateDatasetItems must lie within [0, DatasetItemCount()).
+func DatasetItemCount() uint64 {
+	return datasetItems
+}
+
+// AllocDataset allocates an uninitialized dataset with one reference, like
+// randomx_alloc_dataset. Fill it with InitRange, or with SetItems from
+// ranges generated elsewhere, before handing it to a VM. The dataset
+// keeps track of the items that have been filled in; NewVM and WriteTo
+// return ErrIncomplete until all of them have. Of the flags, only
+// FlagLargePages applies; AllocDataset fails with ErrUnsupportedFlags if a
+// flag is not supported on this machine.
+func AllocDataset(flags Flags) (*Dataset, error) {
+	if err := checkFlags(flags); err != nil {
+		return nil, err
+	}
+
+	d := &Dataset{
+		ds:      newDatasetMemory(flags.largePages()),
+		pending: newItemSet(),
+	}
+	d.refs.init()
+	return d, nil
+}
+
+// InitRange generates itemCount dataset items starting at startItem from
+// c, like randomx_init_dataset. It runs on the calling goroutine, so the
+// caller decides how to split the work: disjoint ranges may be
+// initialized concurrently, and the result is byte-identical to a dataset
+// built by NewDataset however the ranges are divided.
+//
+// All ranges of a dataset must come from caches with the same key;
+// InitRange returns ErrKeyMismatch otherwise.
+func (d *Dataset) InitRange(c *Cache, startItem, itemCount uint64) error {
+	return d.InitRangeContext(context.Background(), c, startItem, itemCount)
+}
+
+// InitRangeContext is like InitRange but stops as soon as ctx is done,
+// returning ctx.Err(). The items of a cancelled range are undefined and
+// are not counted as initialized.
+//
+// A dataset loaded with LoadDatasetFile may be mapped read-only; its
+// items cannot be changed and InitRange returns ErrReadOnly.
+func (d *Dataset) InitRangeContext(ctx context.Context, c *Cache, startItem, itemCount uint64) error {
+	if err := checkItemRange(startItem, itemCount); err != nil {
+		return err
+	}
+	if err := d.Retain(); err != nil {
+		return err
+	}
+	defer d.Release()
+	if d.ds.readOnly {
+		return ErrReadOnly
+	}
+	if err := c.Retain(); err != nil {
+		return err
+	}
+	defer c.Release()
+
+	if err := d.setKey(c.c.key); err != nil {
+		return err
+	}
+
+	dst := d.ds.data[startItem*64 : (startItem+itemCount)*64]
+	if err := d.ds.generateRange(ctx, c.c, startItem, dst, nil); err != nil {
+		return err
+	}
+
+	d.markInitialized(startItem, itemCount)
+	return nil
+}
+
+// SetItems copies items generated by GenerateDatasetItems, possibly in
+// another process, into the dataset starting at startItem. The caller is
+// responsible for the items coming from a cache with the dataset's key.
+// Like InitRange, it returns ErrReadOnly for a read-only mapped dataset.
+func (d *Dataset) SetItems(startItem uint64, items []byte) error {
+	if len(items)%64 != 0 {
+		return fmt.Errorf("randomx: item data length %d is not a multiple of 64", len(items))
+	}
+	if err := checkItemRange(startItem, uint64(len(items))/64); err != nil {
+		return err
+	}
+	if err := d.Retain(); err != nil {
+		return err
+	}
+	defer d.Release()
+	if d.ds.readOnly {
+		return ErrReadOnly
+	}
+
+	copy(d.ds.data[startItem*64:], items)
+	d.markInitialized(startItem, uint64(len(items))/64)
+	return nil
+}
+
+// GenerateDatasetItems fills dst with the len(dst)/64 dataset items
+// starting at startItem, without needing a whole dataset. It lets a
+// process build its share of a distributed dataset and send the bytes to
+// the process that assembles it with SetItems.
+func GenerateDatasetItems(ctx context.Context, c *Cache, startItem uint64, dst []byte) error {
+	if len(dst)%64 != 0 {
+		return fmt.Errorf("randomx: item buffer length %d is not a multiple of 64", len(dst))
+	}
+	if err := checkItemRange(startItem, uint64(len(dst))/64); err != nil {
+		return err
+	}
+	if err := c.Retain(); err != nil {
+		return err
+	}
+	defer c.Release()
+
+	return new(dataset).generateRange(ctx, c.c, startItem, dst, nil)
+}
+
+// checkItemRange reports an error if the item range is out of bounds.
+func checkItemRange(startItem, itemCount uint64) error {
+	if startItem > datasetItems || itemCount > datasetItems-startItem {
+		return fmt.Errorf("randomx: item range [%d, %d) outside dataset of %d items",
+			startItem, startItem+itemCount, uint64(datasetItems))
+	}
+	return nil
+}
+
+// setKey records the key of the cache a range was generated from, and
+// checks that every range uses the same key.
+func (d *Dataset) setKey(key []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.key == nil {
+		d.key = append([]byte(nil), key...)
+		return nil
+	}
+	if !bytesEqual(d.key, key) {
+		return ErrKeyMismatch
+	}
+	return nil
+}
+
+// markInitialized records that itemCount items starting at startItem
+// have been filled in.
+func (d *Dataset) markInitialized(startItem, itemCount uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.pending != nil && d.pending.add(startItem, itemCount) {
+		d.pending = nil
+	}
+}
+
+// complete reports whether every item of the dataset has been
+// initialized.
+func (d *Dataset) complete() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pending == nil
+}
+
+// itemSet records which items of a dataset from AllocDataset have been
+// initialized, one bit per item.
+type itemSet struct {
+	bits  []uint64
+	count uint64
+}
+
+// newItemSet returns an empty set covering every dataset item.
+func newItemSet() *itemSet {
+	return &itemSet{bits: make([]uint64, (datasetItems+63)/64)}
+}
+
+// add marks n items starting at start and reports whether all dataset
+// items are now marked.
+func (s *itemSet) add(start, n uint64) bool {
+	end := start + n
+	for i := start; i < end; {
+		w, b := i/64, i%64
+		if b == 0 && end-i >= 64 {
+			// Whole word at once
+			s.count += 64 - uint64(bits.OnesCount64(s.bits[w]))
+			s.bits[w] = ^uint64(0)
+			i += 64
+			continue
+		}
+		if mask := uint64(1) << b; s.bits[w]&mask == 0 {
+			s.bits[w] |= mask
+			s.count++
+		}
+		i++
+	}
+	return s.count == datasetItems
+}
+
+// Retain adds a reference to the dataset. It returns ErrClosed if the
+// dataset has already been freed.
+func (d *Dataset) Retain() error {
+	if !d.refs.retain() {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Release drops a reference to the dataset and frees its memory when the
+// last reference is gone. Releasing more references than were taken
+// panics.
+func (d *Dataset) Release() {
+	if d.refs.release("Dataset") {
+		d.ds.release()
+	}
+}
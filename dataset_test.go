@@ -0,0 +1,230 @@
+package randomx
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// Test item range bounds checking
+func TestCheckItemRange(t *testing.T) {
+	n := DatasetItemCount()
+	tests := []struct {
+		start, count uint64
+		ok           bool
+	}{
+		{0, 0, true},
+		{0, n, true},
+		{n - 1, 1, true},
+		{n, 0, true},
+		{n, 1, false},
+		{1, n, false},
+		{^uint64(0), 2, false},
+	}
+
+	for _, tt := range tests {
+		if err := checkItemRange(tt.start, tt.count); (err == nil) != tt.ok {
+			t.Errorf("checkItemRange(%d, %d) error = %v, want ok %v", tt.start, tt.count, err, tt.ok)
+		}
+	}
+}
+
+// Test dataset items against the values in the reference tests.cpp, with
+// both the compiled programs and the interpreter
+func TestDatasetItemVectors(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping cache initialization test in short mode")
+	}
+
+	c, err := NewCache([]byte("test key 000"), FlagDefault)
+	if err != nil {
+		t.Fatalf("NewCache() error = %v", err)
+	}
+	defer c.Release()
+
+	// A copy of the cache without the compiled programs
+	interpreted := *c.c
+	interpreted.superscalar = nil
+	vm := &virtualMachine{c: &interpreted}
+
+	tests := []struct {
+		item uint64
+		want uint64 // first word
+	}{
+		{0, 0x680588a85ae222db},
+		{10000000, 0x7943a1f6186ffb72},
+		{20000000, 0x9035244d718095e1},
+		{30000000, 0x145a5091f7853099},
+	}
+	for _, tt := range tests {
+		item := make([]byte, 64)
+		if err := GenerateDatasetItems(context.Background(), c, tt.item, item); err != nil {
+			t.Fatalf("GenerateDatasetItems(%d) error = %v", tt.item, err)
+		}
+		if got := binary.LittleEndian.Uint64(item); got != tt.want {
+			t.Errorf("item %d = %#016x, want %#016x", tt.item, got, tt.want)
+		}
+
+		vm.computeDatasetItem(tt.item, item)
+		if got := binary.LittleEndian.Uint64(item); got != tt.want {
+			t.Errorf("interpreted item %d = %#016x, want %#016x", tt.item, got, tt.want)
+		}
+	}
+}
+
+// Test that ranges built concurrently match a single pass
+func TestDatasetInitRange(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping cache initialization test in short mode")
+	}
+
+	c, err := NewCache([]byte("range test"), FlagDefault)
+	if err != nil {
+		t.Fatalf("NewCache() error = %v", err)
+	}
+	defer c.Release()
+
+	const start, count = 5000, 3000
+
+	// Single pass
+	want := make([]byte, count*64)
+	if err := GenerateDatasetItems(context.Background(), c, start, want); err != nil {
+		t.Fatalf("GenerateDatasetItems() error = %v", err)
+	}
+
+	// The same items split into uneven ranges on several goroutines
+	d, err := AllocDataset(FlagDefault)
+	if err != nil {
+		t.Fatalf("AllocDataset() error = %v", err)
+	}
+	defer d.Release()
+
+	bounds := []uint64{start, start + 1, start + 1100, start + 2047, start + count}
+	var wg sync.WaitGroup
+	errs := make([]error, len(bounds)-1)
+	for i := 0; i+1 < len(bounds); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = d.InitRange(c, bounds[i], bounds[i+1]-bounds[i])
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("InitRange() range %d error = %v", i, err)
+		}
+	}
+
+	if got := d.ds.data[start*64 : (start+count)*64]; !bytes.Equal(got, want) {
+		t.Error("dataset built from ranges differs from a single pass")
+	}
+
+	// Spot check against the item generator used by NewDataset
+	item := make([]byte, 64)
+	generateItem(c.c, start+1234, item)
+	if !bytes.Equal(item, want[1234*64:1235*64]) {
+		t.Error("range item differs from generateItem")
+	}
+
+	if !bytes.Equal(d.Key(), c.Key()) {
+		t.Errorf("Key() = %q, want %q", d.Key(), c.Key())
+	}
+
+	// Items built elsewhere can be copied in
+	if err := d.SetItems(0, want[:128]); err != nil {
+		t.Fatalf("SetItems() error = %v", err)
+	}
+	if !bytes.Equal(d.ds.data[:128], want[:128]) {
+		t.Error("SetItems() did not copy the items")
+	}
+	if err := d.SetItems(0, want[:100]); err == nil {
+		t.Error("SetItems() with a partial item should fail")
+	}
+
+	// Only a few items are set, so the dataset is not usable yet
+	if _, err := d.WriteTo(io.Discard); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("WriteTo() of a partial dataset error = %v, want ErrIncomplete", err)
+	}
+	if _, err := NewVM(nil, d, FlagDefault); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("NewVM() with a partial dataset error = %v, want ErrIncomplete", err)
+	}
+
+	other, err := NewCache([]byte("another range key"), FlagDefault)
+	if err != nil {
+		t.Fatalf("NewCache() error = %v", err)
+	}
+	defer other.Release()
+	if err := d.InitRange(other, 0, 1); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("InitRange() with another key error = %v, want ErrKeyMismatch", err)
+	}
+}
+
+// Test that InitRange matches the parallel dataset build around the
+// boundaries between the workers' shares
+func TestDatasetInitRangeWorkerBoundaries(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping dataset initialization test in short mode")
+	}
+
+	c, err := NewCache([]byte("boundary test"), FlagDefault)
+	if err != nil {
+		t.Fatalf("NewCache() error = %v", err)
+	}
+	defer c.Release()
+
+	const workers = 3
+	ds := newDatasetMemory(false)
+	if err := ds.generateWorkers(context.Background(), c.c, nil, workers); err != nil {
+		t.Fatalf("generateWorkers() error = %v", err)
+	}
+	defer ds.release()
+
+	d, err := AllocDataset(FlagDefault)
+	if err != nil {
+		t.Fatalf("AllocDataset() error = %v", err)
+	}
+	defer d.Release()
+
+	// Ranges straddling each share boundary, and the first and last items
+	share := uint64(datasetItems / workers)
+	starts := []uint64{0, share - 100, 2*share - 100, datasetItems - 200}
+	for _, start := range starts {
+		if err := d.InitRange(c, start, 200); err != nil {
+			t.Fatalf("InitRange(%d) error = %v", start, err)
+		}
+		if got, want := d.ds.data[start*64:(start+200)*64], ds.data[start*64:(start+200)*64]; !bytes.Equal(got, want) {
+			t.Errorf("InitRange(%d) differs from the parallel build", start)
+		}
+	}
+}
+
+// Test tracking of initialized items
+func TestItemSet(t *testing.T) {
+	s := newItemSet()
+	n := uint64(datasetItems)
+
+	if s.add(0, 0) {
+		t.Fatal("empty set reports complete")
+	}
+	// Unaligned and overlapping ranges, including partial words
+	if s.add(3, 200) || s.add(100, 1000) || s.add(0, 5) {
+		t.Fatal("set reports complete after a few ranges")
+	}
+	if s.count != 1100 {
+		t.Errorf("count = %d, want 1100", s.count)
+	}
+	if s.add(1100, n-1101) {
+		t.Fatal("set reports complete with the last item missing")
+	}
+	if !s.add(n-1, 1) {
+		t.Error("set does not report complete after every item was added")
+	}
+	if s.count != n {
+		t.Errorf("count = %d, want %d", s.count, n)
+	}
+}
@@ -165,7 +165,9 @@ func TestRegisterInitialization(t *testing.T) {
 	input := []byte("This is a test")
 
 	// Initialize VM
-	vm.initialize(input)
+	if err := vm.initialize(input); err != nil {
+		t.Fatalf("initialize() error = %v", err)
+	}
 
 	// Check that scratchpad is filled
 	if len(vm.mem) != scratchpadL3Size {
@@ -196,43 +198,57 @@ func TestRegisterInitialization(t *testing.T) {
 func TestConfigurationParsing(t *testing.T) {
 	vm := &virtualMachine{}
 
-	// Create test configuration data
+	// Create test configuration data: 16 little-endian words
 	configData := make([]byte, 128)
-	// Set readReg values (individual bytes, masked with 7)
-	configData[0] = 3  // readReg0 = 3 & 7 = 3
-	configData[1] = 10 // readReg1 = 10 & 7 = 2
-	configData[2] = 15 // readReg2 = 15 & 7 = 7
-	configData[3] = 22 // readReg3 = 22 & 7 = 6
-
-	// Set E masks (consecutive uint64 values starting at byte 8)
-	// Set with high bit (bit 62) set to avoid default mask substitution
-	for i := 0; i < 4; i++ {
-		offset := 8 + i*8
-		val := uint64(i*1000) | (1 << 62) // Set bit 62 to use parsed value
-		binary.LittleEndian.PutUint64(configData[offset:offset+8], val)
+	words := map[int]uint64{
+		0:  0x0800000000000001, // a0 low: exponent 1, mantissa 1
+		1:  0,                  // a0 high: 1.0
+		7:  0xFFFFFFFFFFFFFFFF, // a3 high: exponent 31, full mantissa
+		8:  0xFFFFFFFFFFFFFFFF, // ma
+		9:  0xFFFFFFFFFFFFFFFF, // unused
+		10: 0x123456789ABCDEF0, // mx
+		12: 0xFFFFFFFFFFFFFFFA, // readReg bits 0101 (low bit first)
+		13: 524288 + 5,         // datasetOffset wraps to item 5
+		14: 0xFFFFFFFFFFFFFFFF, // eMask[0]
+		15: 0,                  // eMask[1]
+	}
+	for i, w := range words {
+		binary.LittleEndian.PutUint64(configData[i*8:], w)
 	}
 
 	vm.parseConfiguration(configData)
 
 	// Verify
-	if vm.config.readReg0 != 3 {
-		t.Errorf("readReg0: got %d, expected 3", vm.config.readReg0)
+	regA := map[[2]int]uint64{
+		{0, 0}: 0x4000000000000001,
+		{0, 1}: 0x3FF0000000000000,
+		{1, 0}: 0x3FF0000000000000,
+		{3, 1}: 0x41EFFFFFFFFFFFFF,
+	}
+	for i, want := range regA {
+		if got := floatToUint64(vm.regA[i[0]][i[1]]); got != want {
+			t.Errorf("a%d[%d]: got 0x%016X, expected 0x%016X", i[0], i[1], got, want)
+		}
 	}
-	if vm.config.readReg1 != 2 {
-		t.Errorf("readReg1: got %d, expected 2", vm.config.readReg1)
+	if vm.ma != 0x7FFFFFC0 {
+		t.Errorf("ma: got 0x%X, expected 0x7FFFFFC0", vm.ma)
 	}
-	if vm.config.readReg2 != 7 {
-		t.Errorf("readReg2: got %d, expected 7", vm.config.readReg2)
+	if vm.mx != 0x123456789ABCDEF0 {
+		t.Errorf("mx: got 0x%X, expected 0x123456789ABCDEF0", vm.mx)
 	}
-	if vm.config.readReg3 != 6 {
-		t.Errorf("readReg3: got %d, expected 6", vm.config.readReg3)
+
+	readRegs := [4]uint8{vm.config.readReg0, vm.config.readReg1, vm.config.readReg2, vm.config.readReg3}
+	if readRegs != [4]uint8{0, 3, 4, 7} {
+		t.Errorf("readRegs: got %v, expected [0 3 4 7]", readRegs)
 	}
 
-	for i := 0; i < 4; i++ {
-		expected := uint64(i*1000) | (1 << 62) // Expected has bit 62 set
-		if vm.config.eMask[i] != expected {
-			t.Errorf("eMask[%d]: got %d, expected %d", i, vm.config.eMask[i], expected)
-		}
+	if vm.config.datasetOffset != 5*64 {
+		t.Errorf("datasetOffset: got %d, expected %d", vm.config.datasetOffset, 5*64)
+	}
+
+	eMask := [2]uint64{0x3F000000003FFFFF, 0x3000000000000000}
+	if vm.config.eMask != eMask {
+		t.Errorf("eMask: got %#x, expected %#x", vm.config.eMask, eMask)
 	}
 
 	t.Logf("✅ Configuration parsing correct")
@@ -0,0 +1,83 @@
+package randomx
+
+import (
+	"context"
+	"hash"
+
+	"github.com/opd-ai/go-randomx/internal"
+)
+
+// Size is the size of a RandomX hash in bytes.
+const Size = 32
+
+// BlockSize is the block size of the Blake2b-512 function that absorbs
+// RandomX input, in bytes.
+const BlockSize = 128
+
+// Digest implements hash.Hash on top of a Hasher. Input written to a Digest
+// is absorbed into the initial Blake2b-512 state as it arrives, so large
+// inputs assembled from several buffers never need to be concatenated.
+//
+// A Digest is not safe for concurrent use, but any number of digests may
+// share one Hasher.
+type Digest struct {
+	h *Hasher
+	b *internal.Blake2bStream
+}
+
+var _ hash.Hash = (*Digest)(nil)
+
+// NewDigest returns a Digest that computes RandomX hashes with h.
+// It can be used as a hash.Hash factory:
+//
+//	newHash := func() hash.Hash { return hasher.NewDigest() }
+func (h *Hasher) NewDigest() *Digest {
+	b, err := internal.NewBlake2bStream(64, nil)
+	if err != nil {
+		// Blake2b-512 without a key is always a valid configuration.
+		panic(err)
+	}
+	return &Digest{h: h, b: b}
+}
+
+// Write adds more input to the hash. It never returns an error.
+func (d *Digest) Write(p []byte) (int, error) {
+	return d.b.Write(p)
+}
+
+// Sum appends the RandomX hash of the input written so far to b and
+// returns the resulting slice. It does not change the underlying state.
+//
+// Like Hasher.Hash, Sum panics if the hasher is closed; use SumE to get
+// an error instead.
+func (d *Digest) Sum(b []byte) []byte {
+	sum, err := d.SumE()
+	if err != nil {
+		panic(err)
+	}
+	return append(b, sum[:]...)
+}
+
+// SumE returns the RandomX hash of the input written so far.
+// It returns ErrClosed if the hasher has been closed.
+func (d *Digest) SumE() ([32]byte, error) {
+	var seed [64]byte
+	copy(seed[:], d.b.Sum())
+	return d.h.hashSeed(context.Background(), seed)
+}
+
+// Reset discards all input written so far.
+func (d *Digest) Reset() {
+	d.b.Reset()
+}
+
+// Size returns the number of bytes Sum appends, Size.
+func (d *Digest) Size() int {
+	return Size
+}
+
+// BlockSize returns the Blake2b block size, BlockSize. Writes that are a
+// multiple of the block size are absorbed without internal buffering.
+func (d *Digest) BlockSize() int {
+	return BlockSize
+}
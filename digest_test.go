@@ -0,0 +1,69 @@
+package randomx
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"testing"
+)
+
+// Test that streaming input through a Digest matches Hasher.Hash
+func TestDigest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping hasher test in short mode")
+	}
+
+	hasher, err := New(Config{
+		Mode:     LightMode,
+		CacheKey: []byte("digest test"),
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer hasher.Close()
+
+	input := bytes.Repeat([]byte("block blob "), 40)
+	want := hasher.Hash(input)
+
+	var newHash func() hash.Hash = func() hash.Hash { return hasher.NewDigest() }
+	d := newHash()
+
+	if d.Size() != 32 {
+		t.Errorf("Size() = %d, want 32", d.Size())
+	}
+	if d.BlockSize() != 128 {
+		t.Errorf("BlockSize() = %d, want 128", d.BlockSize())
+	}
+
+	// Write in uneven pieces that straddle Blake2b block boundaries
+	for _, n := range []int{1, 127, 130, 0, 42} {
+		d.Write(input[:n])
+		input = input[n:]
+	}
+	d.Write(input)
+
+	prefix := []byte("prefix")
+	got := d.Sum(prefix)
+	if !bytes.Equal(got[:len(prefix)], prefix) {
+		t.Errorf("Sum() did not append to its argument")
+	}
+	if !bytes.Equal(got[len(prefix):], want[:]) {
+		t.Errorf("Sum() = %x, want %x", got[len(prefix):], want)
+	}
+
+	// Sum must not change the state
+	if again := d.Sum(nil); !bytes.Equal(again, want[:]) {
+		t.Errorf("second Sum() = %x, want %x", again, want)
+	}
+
+	d.Reset()
+	d.Write([]byte("test"))
+	if got, want := d.Sum(nil), hasher.Hash([]byte("test")); !bytes.Equal(got, want[:]) {
+		t.Errorf("Sum() after Reset = %x, want %x", got, want)
+	}
+
+	hasher.Close()
+	if _, err := hasher.NewDigest().SumE(); !errors.Is(err, ErrClosed) {
+		t.Errorf("SumE() after Close error = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,46 @@
+package randomx
+
+import "errors"
+
+// Sentinel errors returned by the package. They may be wrapped with
+// additional context, so compare them with errors.Is.
+var (
+	// ErrClosed is returned when a Hasher is used after Close.
+	ErrClosed = errors.New("randomx: hasher is closed")
+
+	// ErrEmptyKey is returned when a cache key is nil or empty.
+	ErrEmptyKey = errors.New("randomx: cache key must not be empty")
+
+	// ErrInvalidMode is returned when Config.Mode is not LightMode, FastMode or AutoMode.
+	ErrInvalidMode = errors.New("randomx: invalid mode")
+
+	// ErrUnsupportedFlags is returned when Config.Flags requests a feature
+	// that the machine or this build cannot provide. See GetFlags.
+	ErrUnsupportedFlags = errors.New("randomx: flags not supported on this machine")
+
+	// ErrInvalidFile is returned when a cache or dataset file is not in the
+	// expected format, was built with different RandomX parameters, or
+	// fails its checksum.
+	ErrInvalidFile = errors.New("randomx: invalid cache or dataset file")
+
+	// ErrKeyMismatch is returned when a cache or dataset file was built
+	// from a different key than the one it is loaded for, or when a
+	// dataset is combined with a cache or range of another key.
+	ErrKeyMismatch = errors.New("randomx: built for a different cache key")
+
+	// ErrNoPendingHash is returned by Pipeline.Next and Pipeline.Last when
+	// no input has been started with Pipeline.First.
+	ErrNoPendingHash = errors.New("randomx: pipeline has no pending hash")
+
+	// ErrNoPendingKey is returned by Hasher.SwapNextKey when no key is
+	// being prepared with Hasher.PrepareNextKey.
+	ErrNoPendingKey = errors.New("randomx: no next key is being prepared")
+
+	// ErrReadOnly is returned when items are written to a Dataset that is
+	// mapped read-only from a file by LoadDatasetFile.
+	ErrReadOnly = errors.New("randomx: dataset is mapped read-only")
+
+	// ErrIncomplete is returned when a Dataset from AllocDataset is saved
+	// or given to a VM before every item has been initialized.
+	ErrIncomplete = errors.New("randomx: dataset is not fully initialized")
+)
@@ -0,0 +1,82 @@
+package randomx
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// Test that configuration errors match the exported sentinels
+func TestConfigValidationSentinels(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   error
+	}{
+		{"nil cache key", Config{Mode: LightMode}, ErrEmptyKey},
+		{"empty cache key", Config{Mode: FastMode, CacheKey: []byte{}}, ErrEmptyKey},
+		{"invalid mode", Config{Mode: Mode(7), CacheKey: []byte("key")}, ErrInvalidMode},
+		{"unknown flag", Config{Flags: 1 << 20, CacheKey: []byte("key")}, ErrUnsupportedFlags},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.want)
+			}
+			if _, err := New(tt.config); !errors.Is(err, tt.want) {
+				t.Errorf("New() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// Test that a closed hasher reports ErrClosed instead of panicking
+func TestHasherErrorsAfterClose(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping hasher test in short mode")
+	}
+
+	hasher, err := New(Config{
+		Mode:     LightMode,
+		CacheKey: []byte("error test"),
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := hasher.UpdateCacheKey(nil); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("UpdateCacheKey(nil) error = %v, want ErrEmptyKey", err)
+	}
+
+	// A cancelled context stops the hash before any work is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := hasher.HashContext(ctx, []byte("test")); !errors.Is(err, context.Canceled) {
+		t.Errorf("HashContext() error = %v, want context.Canceled", err)
+	}
+
+	want := hasher.Hash([]byte("test"))
+	got, err := hasher.HashE([]byte("test"))
+	if err != nil {
+		t.Fatalf("HashE() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("HashE() = %x, want %x", got, want)
+	}
+
+	if err := hasher.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if _, err := hasher.HashE([]byte("test")); !errors.Is(err, ErrClosed) {
+		t.Errorf("HashE() after Close error = %v, want ErrClosed", err)
+	}
+	if _, err := hasher.HashContext(context.Background(), []byte("test")); !errors.Is(err, ErrClosed) {
+		t.Errorf("HashContext() after Close error = %v, want ErrClosed", err)
+	}
+	if err := hasher.UpdateCacheKey([]byte("new key")); !errors.Is(err, ErrClosed) {
+		t.Errorf("UpdateCacheKey() after Close error = %v, want ErrClosed", err)
+	}
+}
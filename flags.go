@@ -0,0 +1,159 @@
+package randomx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opd-ai/go-randomx/argon2"
+	"github.com/opd-ai/go-randomx/internal/aesround"
+)
+
+// Flags selects optional features and CPU-specific implementations. The
+// values match the reference implementation's randomx_flags.
+type Flags uint32
+
+const (
+	// FlagDefault uses the portable implementations, which work on every
+	// platform.
+	FlagDefault Flags = 0
+
+	// FlagLargePages backs the cache, the dataset and the VM scratchpads
+	// with huge pages where possible. Explicit huge pages (MAP_HUGETLB)
+	// are tried first, which must have been reserved, e.g. with
+	// vm.nr_hugepages on Linux; then transparent huge pages
+	// (MADV_HUGEPAGE); then regular pages. Use Hasher.Pages to see what
+	// each allocation got.
+	FlagLargePages Flags = 1 << 0
+
+	// FlagHardAES uses the CPU's AES instructions (AES-NI on amd64) for
+	// the AES rounds instead of the portable table-driven implementation.
+	// It requires hardware AES support.
+	FlagHardAES Flags = 1 << 1
+
+	// FlagFullMem hashes from the full dataset. With LightMode it selects
+	// FastMode; FastMode and AutoMode build the dataset anyway.
+	FlagFullMem Flags = 1 << 2
+
+	// FlagJIT compiles each RandomX program to x86-64 machine code
+	// instead of interpreting it. It is supported on amd64 Unix systems
+	// and gives the same hashes as the interpreter.
+	FlagJIT Flags = 1 << 3
+
+	// FlagSecure maps JIT-compiled code either writable or executable,
+	// never both at once, at the cost of two mprotect calls per program.
+	// Without it the code stays mapped writable and executable. It only
+	// has an effect with FlagJIT.
+	FlagSecure Flags = 1 << 4
+
+	// FlagArgon2SSSE3 uses the SSSE3 implementation of the Argon2
+	// compression function for the cache fill. It is supported on amd64
+	// CPUs with SSSE3.
+	FlagArgon2SSSE3 Flags = 1 << 5
+
+	// FlagArgon2AVX2 uses the AVX2 implementation of the Argon2
+	// compression function for the cache fill. It is supported on amd64
+	// CPUs with AVX2 and takes precedence over FlagArgon2SSSE3. Without
+	// either flag the portable implementation is used; all three build
+	// the same cache.
+	FlagArgon2AVX2 Flags = 1 << 6
+
+	// FlagArgon2 is the mask of the Argon2 implementation flags.
+	FlagArgon2 = FlagArgon2SSSE3 | FlagArgon2AVX2
+
+	// FlagAES is the former name of FlagHardAES.
+	//
+	// Deprecated: Use FlagHardAES.
+	FlagAES = FlagHardAES
+)
+
+// portableFlags need no CPU support and are always accepted.
+const portableFlags = FlagLargePages | FlagFullMem | FlagSecure
+
+// flagNames lists the flags in bit order for Flags.String.
+var flagNames = []struct {
+	flag Flags
+	name string
+}{
+	{FlagLargePages, "FlagLargePages"},
+	{FlagHardAES, "FlagHardAES"},
+	{FlagFullMem, "FlagFullMem"},
+	{FlagJIT, "FlagJIT"},
+	{FlagSecure, "FlagSecure"},
+	{FlagArgon2SSSE3, "FlagArgon2SSSE3"},
+	{FlagArgon2AVX2, "FlagArgon2AVX2"},
+}
+
+// String returns the names of the flags that are set, separated by "|".
+func (f Flags) String() string {
+	if f == FlagDefault {
+		return "FlagDefault"
+	}
+
+	var names []string
+	for _, n := range flagNames {
+		if f&n.flag != 0 {
+			names = append(names, n.name)
+			f &^= n.flag
+		}
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("Flags(%#x)", uint32(f)))
+	}
+	return strings.Join(names, "|")
+}
+
+// GetFlags returns the CPU-specific flags the current machine supports,
+// like randomx_get_flags. FlagLargePages, FlagFullMem and FlagSecure
+// need no CPU support and are never included; add them as needed.
+func GetFlags() Flags {
+	var flags Flags
+	if _, ok := aesround.Hardware(); ok {
+		flags |= FlagHardAES
+	}
+	if jitSupported {
+		flags |= FlagJIT
+	}
+	if _, ok := argon2.SSSE3(); ok {
+		flags |= FlagArgon2SSSE3
+	}
+	if _, ok := argon2.AVX2(); ok {
+		flags |= FlagArgon2AVX2
+	}
+	return flags
+}
+
+// checkFlags returns an error wrapping ErrUnsupportedFlags if f requests
+// a CPU-specific implementation the machine lacks.
+func checkFlags(f Flags) error {
+	if unsupported := f &^ (GetFlags() | portableFlags); unsupported != 0 {
+		return fmt.Errorf("%w: %v", ErrUnsupportedFlags, unsupported)
+	}
+	return nil
+}
+
+// aesImpl returns the AES rounds selected by FlagHardAES, or the portable
+// implementation.
+func (f Flags) aesImpl() aesround.Impl {
+	if f&FlagHardAES != 0 {
+		return aesround.Default()
+	}
+	return aesround.Soft
+}
+
+// argon2Impl returns the Argon2 compression selected by FlagArgon2AVX2 or
+// FlagArgon2SSSE3, or nil for the portable implementation.
+func (f Flags) argon2Impl() argon2.Impl {
+	var impl argon2.Impl
+	switch {
+	case f&FlagArgon2AVX2 != 0:
+		impl, _ = argon2.AVX2()
+	case f&FlagArgon2SSSE3 != 0:
+		impl, _ = argon2.SSSE3()
+	}
+	return impl
+}
+
+// largePages reports whether f asks for memory backed by huge pages.
+func (f Flags) largePages() bool {
+	return f&FlagLargePages != 0
+}
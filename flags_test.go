@@ -0,0 +1,106 @@
+package randomx
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// Test Flags.String()
+func TestFlagsString(t *testing.T) {
+	tests := []struct {
+		flags Flags
+		want  string
+	}{
+		{FlagDefault, "FlagDefault"},
+		{FlagHardAES, "FlagHardAES"},
+		{FlagLargePages | FlagJIT | FlagSecure, "FlagLargePages|FlagJIT|FlagSecure"},
+		{FlagArgon2, "FlagArgon2SSSE3|FlagArgon2AVX2"},
+		{FlagFullMem | 1<<20, "FlagFullMem|Flags(0x100000)"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.flags.String(); got != tt.want {
+			t.Errorf("Flags.String() = %v, want %v", got, tt.want)
+		}
+	}
+}
+
+// Test that flags the machine supports are accepted and all others rejected
+func TestFlagsValidation(t *testing.T) {
+	supported := GetFlags() | portableFlags
+	t.Logf("GetFlags() = %v", GetFlags())
+
+	config := Config{Flags: supported, CacheKey: []byte("test key")}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate() with %v error = %v", supported, err)
+	}
+
+	for _, n := range flagNames {
+		if supported&n.flag != 0 {
+			continue
+		}
+		config := Config{Flags: n.flag, CacheKey: []byte("test key")}
+		if err := config.Validate(); !errors.Is(err, ErrUnsupportedFlags) {
+			t.Errorf("Validate() with unsupported %v error = %v, want ErrUnsupportedFlags", n.flag, err)
+		}
+	}
+}
+
+// Test that GetFlags only reports CPU-specific flags
+func TestGetFlags(t *testing.T) {
+	if flags := GetFlags(); flags&portableFlags != 0 {
+		t.Errorf("GetFlags() = %v, includes flags that need no CPU support", flags)
+	}
+}
+
+// Test that FlagFullMem selects the dataset
+func TestFlagFullMemMode(t *testing.T) {
+	tests := []struct {
+		mode  Mode
+		flags Flags
+		want  Mode
+	}{
+		{LightMode, FlagDefault, LightMode},
+		{LightMode, FlagFullMem, FastMode},
+		{FastMode, FlagDefault, FastMode},
+		{FastMode, FlagFullMem, FastMode},
+		{AutoMode, FlagFullMem, AutoMode},
+	}
+
+	for _, tt := range tests {
+		config := Config{Mode: tt.mode, Flags: tt.flags}
+		if got := config.effectiveMode(); got != tt.want {
+			t.Errorf("effectiveMode() of %v with %v = %v, want %v", tt.mode, tt.flags, got, tt.want)
+		}
+	}
+}
+
+// Test that the Argon2 flags build the same cache as the portable fill
+func TestArgon2Flags(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping cache initialization test in short mode")
+	}
+
+	key := []byte("argon2 flags")
+	plain, err := New(Config{Mode: LightMode, CacheKey: key})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer plain.Close()
+
+	for _, flags := range []Flags{FlagArgon2SSSE3, FlagArgon2AVX2, FlagArgon2} {
+		if flags&^GetFlags() != 0 {
+			t.Logf("%v not supported, skipping", flags)
+			continue
+		}
+		hasher, err := New(Config{Mode: LightMode, Flags: flags, CacheKey: key})
+		if err != nil {
+			t.Fatalf("New(%v) error = %v", flags, err)
+		}
+		if !bytes.Equal(hasher.cache.data, plain.cache.data) {
+			t.Errorf("cache with %v differs from the portable fill", flags)
+		}
+		hasher.Close()
+	}
+}
@@ -0,0 +1,70 @@
+//go:build linux
+
+package randomx
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// hugePageSize returns the default size of explicit huge pages, or 0 if it
+// cannot be determined. Mappings with MAP_HUGETLB must be a multiple of it
+// to be unmapped again.
+var hugePageSize = sync.OnceValue(func() int {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// Hugepagesize:       2048 kB
+		fields := bytes.Fields(s.Bytes())
+		if len(fields) == 3 && string(fields[0]) == "Hugepagesize:" && string(fields[2]) == "kB" {
+			kb, err := strconv.Atoi(string(fields[1]))
+			if err != nil {
+				return 0
+			}
+			return kb * 1024
+		}
+	}
+	return 0
+})
+
+// transparentHugePages reports whether the kernel honours MADV_HUGEPAGE,
+// that is whether transparent huge pages are not disabled outright.
+var transparentHugePages = sync.OnceValue(func() bool {
+	enabled, err := os.ReadFile("/sys/kernel/mm/transparent_hugepage/enabled")
+	if err != nil {
+		return false
+	}
+	return !bytes.Contains(enabled, []byte("[never]"))
+})
+
+// mapHugeTLB maps at least size bytes of explicit huge pages. It fails
+// unless huge pages have been reserved, e.g. through vm.nr_hugepages.
+// The returned mapping is rounded up to whole huge pages.
+func mapHugeTLB(size int) ([]byte, error) {
+	pageSize := hugePageSize()
+	if pageSize == 0 {
+		return nil, errNoHugePages
+	}
+	size = (size + pageSize - 1) / pageSize * pageSize
+	return unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE,
+		unix.MAP_PRIVATE|unix.MAP_ANON|unix.MAP_HUGETLB)
+}
+
+// adviseHugePages asks the kernel to back data with transparent huge
+// pages and reports whether it will.
+func adviseHugePages(data []byte) bool {
+	if !transparentHugePages() {
+		return false
+	}
+	return unix.Madvise(data, unix.MADV_HUGEPAGE) == nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package randomx
+
+// mapHugeTLB always fails outside Linux, so large page allocations fall
+// back to regular pages.
+func mapHugeTLB(size int) ([]byte, error) {
+	return nil, errNoHugePages
+}
+
+// adviseHugePages does nothing outside Linux.
+func adviseHugePages(data []byte) bool {
+	return false
+}
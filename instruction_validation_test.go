@@ -1,6 +1,7 @@
 package randomx
 
 import (
+	"math"
 	"testing"
 )
 
@@ -17,11 +18,16 @@ func TestInstructionTypeMapping(t *testing.T) {
 		{22, instrIADD_M, "IADD_M_last"},
 		{23, instrISUB_R, "ISUB_R_first"},
 		{38, instrISUB_R, "ISUB_R_last"},
-		{130, instrFADD_R, "FADD_R_first"},
-		{142, instrFADD_R, "FADD_R_at_142"},
-		{145, instrFADD_R, "FADD_R_last"},
-		{220, instrCBRANCH, "CBRANCH_first"},
-		{244, instrCBRANCH, "CBRANCH_last"},
+		{70, instrIMULH_M, "IMULH_M_only"},
+		{75, instrISMULH_M, "ISMULH_M_only"},
+		{76, instrIMUL_RCP, "IMUL_RCP_first"},
+		{124, instrFADD_R, "FADD_R_first"},
+		{139, instrFADD_R, "FADD_R_last"},
+		{214, instrCBRANCH, "CBRANCH_first"},
+		{238, instrCBRANCH, "CBRANCH_last"},
+		{239, instrCFROUND, "CFROUND_only"},
+		{240, instrISTORE, "ISTORE_first"},
+		{255, instrISTORE, "ISTORE_last"},
 	}
 
 	for _, tt := range tests {
@@ -37,47 +43,162 @@ func TestInstructionTypeMapping(t *testing.T) {
 // TestMemoryAddressing validates L1/L2/L3 addressing
 func TestMemoryAddressing(t *testing.T) {
 	vm := &virtualMachine{
-		reg: [8]uint64{0x1234567890ABCDEF, 0, 0, 0, 0, 0, 0, 0},
+		reg: [8]uint64{0x1234567890ABCDEF, 0x1F4010, 0, 0, 0, 0, 0, 0},
 		mem: make([]byte, scratchpadL3Size),
 	}
 
 	tests := []struct {
+		name     string
+		typ      instructionType
+		dst, src uint8
 		mod      uint8
-		expected string
+		imm      uint32
+		expected uint32
 	}{
-		{0, "L3"},  // mod % 4 == 0
-		{1, "L2"},  // mod % 4 == 1
-		{2, "L1"},  // mod % 4 == 2
-		{3, "L2"},  // mod % 4 == 3
-		{4, "L3"},  // mod % 4 == 0
-		{5, "L2"},  // mod % 4 == 1
+		// 0x1234567890ABCDEF + 0x11 = ...90ABCE00
+		{"load mod.mem 0: L2", instrIADD_M, 1, 0, 0x00, 0x11, 0x3CE00},
+		{"load mod.mem 1: L1", instrIADD_M, 1, 0, 0x01, 0x11, 0x0E00},
+		{"load mod.mem 2: L1", instrIXOR_M, 1, 0, 0xF2, 0x11, 0x0E00},
+		{"load mod.mem 3: L1", instrISMULH_M, 1, 0, 0x03, 0x11, 0x0E00},
+		// With src == dst the immediate alone addresses L3.
+		{"load src == dst: L3", instrIMUL_M, 1, 1, 0x01, 0x1FFFFF, 0x1FFFF8},
+		{"load src == dst, negative imm", instrISUB_M, 0, 0, 0x00, 0xFFFFFFF0, 0x1FFFF0},
+		// Float loads always use src.
+		{"float load src == dst", instrFADD_M, 1, 1, 0x00, 8, 0x34018},
+		{"float load mod.mem 1: L1", instrFDIV_M, 0, 1, 0x01, 8, 0x0018},
+		// ISTORE addresses dst + imm, in L3 from mod.cond 14.
+		{"store mod.cond 13: L1", instrISTORE, 1, 0, 0xD1, 0, 0x0010},
+		{"store mod.cond 13: L2", instrISTORE, 1, 0, 0xD0, 0, 0x34010},
+		{"store mod.cond 14: L3", instrISTORE, 1, 0, 0xE1, 0, 0x1F4010},
+		{"store mod.cond 15: L3", instrISTORE, 1, 1, 0xF0, 0xFFFFFFF8, 0x1F4008},
 	}
 
 	for _, tt := range tests {
 		instr := &instruction{
-			src: 0,
-			imm: 0,
-			mod: tt.mod,
+			opcode: opcodeOf(t, tt.typ),
+			dst:    tt.dst,
+			src:    tt.src,
+			mod:    tt.mod,
+			imm:    tt.imm,
+		}
+		if addr := vm.getMemoryAddress(instr); addr != tt.expected {
+			t.Errorf("%s: address 0x%X, expected 0x%X", tt.name, addr, tt.expected)
+		}
+	}
+}
+
+// TestIntegerInstructions validates each integer instruction against
+// values computed by hand from the spec, with dst = r1 and src = r2
+// unless the case gives other registers
+func TestIntegerInstructions(t *testing.T) {
+	const (
+		neg1   = 0xFFFFFFFFFFFFFFFF
+		bit63  = 0x8000000000000000
+		noAddr = ^uint32(0)
+	)
+	tests := []struct {
+		name       string
+		typ        instructionType
+		dst, src   uint8
+		mod        uint8
+		imm        uint32
+		rdst, rsrc uint64
+		addr       uint32 // address of mem, or noAddr
+		mem        uint64
+		want       uint64
+	}{
+		// mod.shift is bits 2-3 of mod; mod.mem (bits 0-1) is ignored.
+		{"IADD_RS shift", instrIADD_RS, 1, 2, 0x0B, 0, 10, 3, noAddr, 0, 10 + 3<<2},
+		{"IADD_RS r5 displacement", instrIADD_RS, 5, 2, 0x04, 0xFFFFFFFE, 100, 7, noAddr, 0, 100 + 7<<1 - 2},
+		{"IADD_RS r5 + r5", instrIADD_RS, 5, 5, 0x00, 1, 9, 9, noAddr, 0, 9 + 9 + 1},
+		{"IADD_M L1", instrIADD_M, 1, 2, 0x01, 0x10, 1, 0x12345, 0x2350, 5, 6},
+		{"IADD_M L2", instrIADD_M, 1, 2, 0x00, 0x10, 1, 0x12345, 0x12350, 7, 8},
+		{"IADD_M L3 imm", instrIADD_M, 1, 1, 0x01, 0x1FFFFF, 0xDEAD, 0xDEAD, 0x1FFFF8, 1, 0xDEAE},
+		{"ISUB_R", instrISUB_R, 1, 2, 0, 0, 5, 7, noAddr, 0, neg1 - 1},
+		{"ISUB_R imm", instrISUB_R, 1, 1, 0, 0xFFFFFFFF, 5, 5, noAddr, 0, 6},
+		{"ISUB_M", instrISUB_M, 1, 2, 0x02, 0, 10, 0x4008, 0x0008, 3, 7},
+		{"IMUL_R", instrIMUL_R, 1, 2, 0, 0, 0x100000000, 0x100000001, noAddr, 0, 0x100000000},
+		{"IMUL_R imm", instrIMUL_R, 1, 1, 0, 0x80000000, 3, 3, noAddr, 0, 0xFFFFFFFE80000000},
+		{"IMUL_M", instrIMUL_M, 1, 2, 0x03, 8, 5, 0, 0x0008, neg1, neg1 - 4},
+		{"IMULH_R", instrIMULH_R, 1, 2, 0, 0, neg1, 2, noAddr, 0, 1},
+		{"IMULH_R square", instrIMULH_R, 1, 1, 0, 0, 1 << 32, 1 << 32, noAddr, 0, 1},
+		{"IMULH_M", instrIMULH_M, 1, 2, 0x01, 0x40, 4, 0, 0x0040, bit63, 2},
+		// -2^62 * 8 = -2^65
+		{"ISMULH_R negative", instrISMULH_R, 1, 2, 0, 0, 0xC000000000000000, 8, noAddr, 0, neg1 - 1},
+		{"ISMULH_R positive", instrISMULH_R, 1, 2, 0, 0, 1 << 62, 1 << 62, noAddr, 0, 1 << 60},
+		// -2^63 * -3 = 2^64 + 2^63
+		{"ISMULH_M L3 imm", instrISMULH_M, 1, 1, 0, 0x100, bit63, bit63, 0x0100, neg1 - 2, 1},
+		// 3 * floor(2^65 / 3) = 2^65 - 2
+		{"IMUL_RCP 3", instrIMUL_RCP, 1, 2, 0, 3, 3, 0, noAddr, 0, neg1 - 1},
+		// floor(2^95 / (2^32 - 1)) = 2^63 + 2^31
+		{"IMUL_RCP 2^32-1", instrIMUL_RCP, 1, 2, 0, 0xFFFFFFFF, 1, 0, noAddr, 0, 0x8000000080000000},
+		{"IMUL_RCP power of two", instrIMUL_RCP, 1, 2, 0, 16, 7, 0, noAddr, 0, 7},
+		{"IMUL_RCP zero", instrIMUL_RCP, 1, 2, 0, 0, 7, 0, noAddr, 0, 7},
+		{"INEG_R", instrINEG_R, 1, 2, 0, 0, 1, 0, noAddr, 0, neg1},
+		{"IXOR_R", instrIXOR_R, 1, 2, 0, 0, 0xF0F0, 0x0FF0, noAddr, 0, 0xFF00},
+		{"IXOR_R imm", instrIXOR_R, 1, 1, 0, 0x80000001, 1, 1, noAddr, 0, 0xFFFFFFFF80000000},
+		{"IXOR_M", instrIXOR_M, 1, 2, 0x00, 0x18, 0x0F, 0x40000, 0x0018, 0xFF, 0xF0},
+		{"IROR_R", instrIROR_R, 1, 2, 0, 0, 1, 65, noAddr, 0, bit63},
+		{"IROR_R imm", instrIROR_R, 1, 1, 0, 4, 0x10, 0x10, noAddr, 0, 1},
+		{"IROL_R", instrIROL_R, 1, 2, 0, 0, bit63, 1, noAddr, 0, 1},
+		{"IROL_R imm", instrIROL_R, 1, 1, 0, 0x44, 1, 1, noAddr, 0, 0x10},
+		{"ISWAP_R", instrISWAP_R, 1, 2, 0, 0, 1, 2, noAddr, 0, 2},
+		{"ISWAP_R same", instrISWAP_R, 1, 1, 0, 0, 1, 1, noAddr, 0, 1},
+	}
+
+	for _, tt := range tests {
+		vm := &virtualMachine{mem: make([]byte, scratchpadL3Size)}
+		vm.reg[tt.src] = tt.rsrc
+		vm.reg[tt.dst] = tt.rdst
+		if tt.addr != noAddr {
+			vm.writeMemory(tt.addr, tt.mem)
+		}
+
+		vm.executeInstruction(&instruction{
+			opcode: opcodeOf(t, tt.typ),
+			dst:    tt.dst,
+			src:    tt.src,
+			mod:    tt.mod,
+			imm:    tt.imm,
+		})
+
+		if vm.reg[tt.dst] != tt.want {
+			t.Errorf("%s: dst = %#x, want %#x", tt.name, vm.reg[tt.dst], tt.want)
+		}
+		wantSrc := tt.rsrc
+		if tt.typ == instrISWAP_R {
+			wantSrc = tt.rdst
 		}
-		addr := vm.getMemoryAddress(instr)
-		
-		var level string
-		if addr <= scratchpadL1Mask {
-			level = "L1"
-		} else if addr <= scratchpadL2Mask {
-			level = "L2"
-		} else {
-			level = "L3"
+		if tt.src != tt.dst && vm.reg[tt.src] != wantSrc {
+			t.Errorf("%s: src = %#x, want %#x", tt.name, vm.reg[tt.src], wantSrc)
 		}
-		
-		if level != tt.expected {
-			t.Errorf("mod %d (mod%%4=%d): address 0x%X mapped to %s, expected %s",
-				tt.mod, tt.mod%4, addr, level, tt.expected)
+	}
+}
+
+// TestISTORE validates that ISTORE writes src at its address
+func TestISTORE(t *testing.T) {
+	tests := []struct {
+		mod  uint8
+		imm  uint32
+		addr uint32
+	}{
+		{0x01, 0, 0x0010},
+		{0x00, 0, 0x34010},
+		{0xE0, 0, 0x1F4010},
+		{0xF3, 0xFFFFFFF8, 0x1F4008},
+	}
+	for _, tt := range tests {
+		vm := &virtualMachine{mem: make([]byte, scratchpadL3Size)}
+		vm.reg[1] = 0x1F4010
+		vm.reg[2] = 0x0123456789ABCDEF
+		vm.executeInstruction(&instruction{opcode: opcodeOf(t, instrISTORE), dst: 1, src: 2, mod: tt.mod, imm: tt.imm})
+		if got := vm.readMemory(tt.addr); got != vm.reg[2] {
+			t.Errorf("mod %#x imm %#x: mem[%#x] = %#x, want %#x", tt.mod, tt.imm, tt.addr, got, vm.reg[2])
 		}
 	}
 }
 
-// TestFloatMasking validates floating-point masking
+// TestFloatMasking validates E-register masking of memory values
 func TestFloatMasking(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -87,40 +208,54 @@ func TestFloatMasking(t *testing.T) {
 		{"large", 0x7FEFFFFFFFFFFFFF},  // max double
 		{"inf", 0x7FF0000000000000},    // infinity
 		{"nan", 0x7FF8000000000000},    // NaN
+		{"negative", 0xBFF0000000000000},
+		{"zero", 0},
 	}
 
+	vm := &virtualMachine{}
+	vm.config.eMask = [2]uint64{floatMask(0), floatMask(^uint64(0))}
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			f := maskFloat(uint64ToFloat(tt.input))
-			// Just verify it doesn't panic and returns a value
-			t.Logf("Input: 0x%016X -> Output: %v (bits: 0x%016X)",
-				tt.input, f, floatToUint64(f))
+			e := vm.maskRegisterE([2]float64{uint64ToFloat(tt.input), uint64ToFloat(tt.input)})
+			for i, f := range e {
+				if math.IsNaN(f) || math.IsInf(f, 0) || f <= 0 {
+					t.Errorf("half %d: 0x%016X masked to %v (bits: 0x%016X)",
+						i, tt.input, f, floatToUint64(f))
+				}
+			}
 		})
 	}
 }
 
-// TestEMaskApplication validates E-register masking
+// TestEMaskApplication validates the exponent masks built from configuration entropy
 func TestEMaskApplication(t *testing.T) {
-	vm := &virtualMachine{
-		config: vmConfig{
-			eMask: [4]uint64{
-				0x3FFFFFFFFFFFFFFF, // Default eMask for E0
-				0x3FFFFFFFFFFFFFFF, // Default eMask for E1
-				0x3FFFFFFFFFFFFFFF, // Default eMask for E2
-				0x3FFFFFFFFFFFFFFF, // Default eMask for E3
-			},
-		},
+	tests := []struct {
+		entropy uint64
+		mask    uint64
+	}{
+		// Exponent 0x300, no mantissa bits
+		{0, 0x3000000000000000},
+		// Exponent 0x3F0 and the 22 low mantissa bits
+		{^uint64(0), 0x3F000000003FFFFF},
+		// Only the top four and low 22 bits are used
+		{0xA000000000C00001, 0x3A00000000000001},
+	}
+	for _, tt := range tests {
+		if got := floatMask(tt.entropy); got != tt.mask {
+			t.Errorf("floatMask(0x%016X) = 0x%016X, want 0x%016X", tt.entropy, got, tt.mask)
+		}
 	}
 
-	// Test that eMask limits exponent range
-	testValue := uint64(0x7FF0000000000000) // Infinity
-	masked := testValue & vm.config.eMask[0]
-	
-	// After masking, exponent should be limited
-	exponentMask := uint64(0x7FF0000000000000)
-	if (masked & exponentMask) == exponentMask {
-		t.Error("eMask should limit exponent to prevent infinity")
+	// The masked exponent keeps its low four bits and takes the rest
+	// from the mask: 0x3A0 | 0xF = 0x3AF.
+	vm := &virtualMachine{}
+	vm.config.eMask = [2]uint64{floatMask(0xA000000000000000), floatMask(0xA000000000000000)}
+	e := vm.maskRegisterE([2]float64{uint64ToFloat(0x7FFFFFFFFFFFFFFF), uint64ToFloat(0x8000000000000001)})
+	if got, want := floatToUint64(e[0]), uint64(0x3AFFFFFFFFFFFFFF); got != want {
+		t.Errorf("masked low half = 0x%016X, want 0x%016X", got, want)
+	}
+	if got, want := floatToUint64(e[1]), uint64(0x3A00000000000001); got != want {
+		t.Errorf("masked high half = 0x%016X, want 0x%016X", got, want)
 	}
-	
-	t.Logf("Original: 0x%016X, Masked: 0x%016X", testValue, masked)
 }
@@ -1,9 +1,6 @@
 package randomx
 
-import (
-	"math"
-	"math/bits"
-)
+import "math/bits"
 
 // RandomX instruction frequencies and opcodes based on tevador/RandomX specification
 // These frequencies determine the instruction distribution in generated programs
@@ -16,9 +13,9 @@ const (
 	freqIMUL_R   = 16
 	freqIMUL_M   = 4
 	freqIMULH_R  = 4
-	freqIMULH_M  = 4
+	freqIMULH_M  = 1
 	freqISMULH_R = 4
-	freqISMULH_M = 4
+	freqISMULH_M = 1
 	freqIMUL_RCP = 8
 	freqINEG_R   = 2
 	freqIXOR_R   = 15
@@ -98,105 +95,109 @@ var instructionBoundaries = []struct {
 
 // getInstructionType maps an opcode (0-255) to its instruction type
 func getInstructionType(opcode uint8) instructionType {
-	// Build cumulative frequency table
-	cumulative := uint8(0)
+	// Build cumulative frequency table. The frequencies add up to 256,
+	// so the sums are not bytes.
+	op := int(opcode)
+	cumulative := 0
 	
 	// Integer instructions
-	if opcode < freqIADD_RS { return instrIADD_RS } // 0-15
+	if op < freqIADD_RS { return instrIADD_RS } // 0-15
 	cumulative += freqIADD_RS
 	
-	if opcode < cumulative + freqIADD_M { return instrIADD_M } // 16-22
+	if op < cumulative + freqIADD_M { return instrIADD_M } // 16-22
 	cumulative += freqIADD_M
 	
-	if opcode < cumulative + freqISUB_R { return instrISUB_R } // 23-38
+	if op < cumulative + freqISUB_R { return instrISUB_R } // 23-38
 	cumulative += freqISUB_R
 	
-	if opcode < cumulative + freqISUB_M { return instrISUB_M } // 39-45
+	if op < cumulative + freqISUB_M { return instrISUB_M } // 39-45
 	cumulative += freqISUB_M
 	
-	if opcode < cumulative + freqIMUL_R { return instrIMUL_R } // 46-61
+	if op < cumulative + freqIMUL_R { return instrIMUL_R } // 46-61
 	cumulative += freqIMUL_R
 	
-	if opcode < cumulative + freqIMUL_M { return instrIMUL_M } // 62-65
+	if op < cumulative + freqIMUL_M { return instrIMUL_M } // 62-65
 	cumulative += freqIMUL_M
 	
-	if opcode < cumulative + freqIMULH_R { return instrIMULH_R } // 66-69
+	if op < cumulative + freqIMULH_R { return instrIMULH_R } // 66-69
 	cumulative += freqIMULH_R
 	
-	if opcode < cumulative + freqIMULH_M { return instrIMULH_M } // 70-73
+	if op < cumulative + freqIMULH_M { return instrIMULH_M } // 70
 	cumulative += freqIMULH_M
 	
-	if opcode < cumulative + freqISMULH_R { return instrISMULH_R } // 74-77
+	if op < cumulative + freqISMULH_R { return instrISMULH_R } // 71-74
 	cumulative += freqISMULH_R
 	
-	if opcode < cumulative + freqISMULH_M { return instrISMULH_M } // 78-81
+	if op < cumulative + freqISMULH_M { return instrISMULH_M } // 75
 	cumulative += freqISMULH_M
 	
-	if opcode < cumulative + freqIMUL_RCP { return instrIMUL_RCP } // 82-89
+	if op < cumulative + freqIMUL_RCP { return instrIMUL_RCP } // 76-83
 	cumulative += freqIMUL_RCP
 	
-	if opcode < cumulative + freqINEG_R { return instrINEG_R } // 90-91
+	if op < cumulative + freqINEG_R { return instrINEG_R } // 84-85
 	cumulative += freqINEG_R
 	
-	if opcode < cumulative + freqIXOR_R { return instrIXOR_R } // 92-106
+	if op < cumulative + freqIXOR_R { return instrIXOR_R } // 86-100
 	cumulative += freqIXOR_R
 	
-	if opcode < cumulative + freqIXOR_M { return instrIXOR_M } // 107-111
+	if op < cumulative + freqIXOR_M { return instrIXOR_M } // 101-105
 	cumulative += freqIXOR_M
 	
-	if opcode < cumulative + freqIROR_R { return instrIROR_R } // 112-119
+	if op < cumulative + freqIROR_R { return instrIROR_R } // 106-113
 	cumulative += freqIROR_R
 	
-	if opcode < cumulative + freqIROL_R { return instrIROL_R } // 120-121
+	if op < cumulative + freqIROL_R { return instrIROL_R } // 114-115
 	cumulative += freqIROL_R
 	
-	if opcode < cumulative + freqISWAP_R { return instrISWAP_R } // 122-125
+	if op < cumulative + freqISWAP_R { return instrISWAP_R } // 116-119
 	cumulative += freqISWAP_R
 	
 	// Floating-point instructions
-	if opcode < cumulative + freqFSWAP_R { return instrFSWAP_R } // 126-129
+	if op < cumulative + freqFSWAP_R { return instrFSWAP_R } // 120-123
 	cumulative += freqFSWAP_R
 	
-	if opcode < cumulative + freqFADD_R { return instrFADD_R } // 130-145
+	if op < cumulative + freqFADD_R { return instrFADD_R } // 124-139
 	cumulative += freqFADD_R
 	
-	if opcode < cumulative + freqFADD_M { return instrFADD_M } // 146-150
+	if op < cumulative + freqFADD_M { return instrFADD_M } // 140-144
 	cumulative += freqFADD_M
 	
-	if opcode < cumulative + freqFSUB_R { return instrFSUB_R } // 151-166
+	if op < cumulative + freqFSUB_R { return instrFSUB_R } // 145-160
 	cumulative += freqFSUB_R
 	
-	if opcode < cumulative + freqFSUB_M { return instrFSUB_M } // 167-171
+	if op < cumulative + freqFSUB_M { return instrFSUB_M } // 161-165
 	cumulative += freqFSUB_M
 	
-	if opcode < cumulative + freqFSCAL_R { return instrFSCAL_R } // 172-177
+	if op < cumulative + freqFSCAL_R { return instrFSCAL_R } // 166-171
 	cumulative += freqFSCAL_R
 	
-	if opcode < cumulative + freqFMUL_R { return instrFMUL_R } // 178-209
+	if op < cumulative + freqFMUL_R { return instrFMUL_R } // 172-203
 	cumulative += freqFMUL_R
 	
-	if opcode < cumulative + freqFDIV_M { return instrFDIV_M } // 210-213
+	if op < cumulative + freqFDIV_M { return instrFDIV_M } // 204-207
 	cumulative += freqFDIV_M
 	
-	if opcode < cumulative + freqFSQRT_R { return instrFSQRT_R } // 214-219
+	if op < cumulative + freqFSQRT_R { return instrFSQRT_R } // 208-213
 	cumulative += freqFSQRT_R
 	
 	// Control instructions
-	if opcode < cumulative + freqCBRANCH { return instrCBRANCH } // 220-244
+	if op < cumulative + freqCBRANCH { return instrCBRANCH } // 214-238
 	cumulative += freqCBRANCH
 	
-	if opcode < cumulative + freqCFROUND { return instrCFROUND } // 245
+	if op < cumulative + freqCFROUND { return instrCFROUND } // 239
 	cumulative += freqCFROUND
 	
-	if opcode < cumulative + freqISTORE { return instrISTORE } // 246-261 (wraps)
+	if op < cumulative + freqISTORE { return instrISTORE } // 240-255
 	cumulative += freqISTORE
 	
-	// Anything beyond should be NOP or wrap around
+	// Unreachable while the frequencies add up to 256
 	return instrNOP
 }
 
-// executeInstructionFull executes a RandomX instruction with full spec compliance
-func (vm *virtualMachine) executeInstructionFull(instr *instruction) {
+// executeInstructionFull executes a RandomX instruction with full spec compliance.
+// It reports whether the instruction is a CBRANCH that was taken; the
+// caller makes the jump.
+func (vm *virtualMachine) executeInstructionFull(instr *instruction) bool {
 	instrType := getInstructionType(instr.opcode)
 	
 	dst := instr.dst & 0x07
@@ -204,94 +205,80 @@ func (vm *virtualMachine) executeInstructionFull(instr *instruction) {
 	
 	switch instrType {
 	case instrIADD_RS:
-		// dst = dst + (src << mod%4)
-		shift := instr.mod % 4
-		vm.reg[dst] += vm.reg[src] << shift
+		// dst = dst + (src << mod.shift), plus imm if dst is r5
+		vm.reg[dst] += vm.reg[src] << instr.getModShift()
+		if dst == displacementReg {
+			vm.reg[dst] += signExtend2sCompl(instr.imm)
+		}
 		
 	case instrIADD_M:
-		// dst = dst + mem[src + imm]
+		// dst = dst + mem
 		addr := vm.getMemoryAddress(instr)
 		vm.reg[dst] += vm.readMemory(addr)
 		
 	case instrISUB_R:
-		// dst = dst - src
-		vm.reg[dst] -= vm.reg[src]
+		// dst = dst - src, or dst - imm if src is dst
+		vm.reg[dst] -= vm.operand(instr)
 		
 	case instrISUB_M:
-		// dst = dst - mem[src + imm]
+		// dst = dst - mem
 		addr := vm.getMemoryAddress(instr)
 		vm.reg[dst] -= vm.readMemory(addr)
 		
 	case instrIMUL_R:
-		// dst = dst * src
-		vm.reg[dst] *= vm.reg[src]
+		// dst = dst * src, or dst * imm if src is dst
+		vm.reg[dst] *= vm.operand(instr)
 		
 	case instrIMUL_M:
-		// dst = dst * mem[src + imm]
+		// dst = dst * mem
 		addr := vm.getMemoryAddress(instr)
 		vm.reg[dst] *= vm.readMemory(addr)
 		
 	case instrIMULH_R:
 		// dst = (dst * src) >> 64 (unsigned high part)
-		hi, _ := bits.Mul64(vm.reg[dst], vm.reg[src])
-		vm.reg[dst] = hi
+		vm.reg[dst] = mulh(vm.reg[dst], vm.reg[src])
 		
 	case instrIMULH_M:
-		// dst = (dst * mem[src + imm]) >> 64
+		// dst = (dst * mem) >> 64
 		addr := vm.getMemoryAddress(instr)
-		val := vm.readMemory(addr)
-		hi, _ := bits.Mul64(vm.reg[dst], val)
-		vm.reg[dst] = hi
+		vm.reg[dst] = mulh(vm.reg[dst], vm.readMemory(addr))
 		
 	case instrISMULH_R:
 		// dst = (dst * src) >> 64 (signed high part)
-		a := int64(vm.reg[dst])
-		b := int64(vm.reg[src])
-		result := (int128mul(a, b)) >> 64
-		vm.reg[dst] = uint64(result)
+		vm.reg[dst] = uint64(smulh(int64(vm.reg[dst]), int64(vm.reg[src])))
 		
 	case instrISMULH_M:
-		// dst = (dst * mem[src + imm]) >> 64 (signed)
+		// dst = (dst * mem) >> 64 (signed)
 		addr := vm.getMemoryAddress(instr)
-		val := vm.readMemory(addr)
-		a := int64(vm.reg[dst])
-		b := int64(val)
-		result := (int128mul(a, b)) >> 64
-		vm.reg[dst] = uint64(result)
+		vm.reg[dst] = uint64(smulh(int64(vm.reg[dst]), int64(vm.readMemory(addr))))
 		
 	case instrIMUL_RCP:
-		// dst = dst * reciprocal(imm)
-		// Special handling for reciprocal multiplication
-		if instr.imm != 0 {
-			divisor := uint64(instr.imm)
-			if divisor&(divisor-1) == 0 {
-				// Power of 2, use shift
-				vm.reg[dst] *= reciprocalApprox(divisor)
-			} else {
-				vm.reg[dst] *= reciprocalApprox(divisor)
-			}
+		// dst = dst * 2^x / imm, the fixed-point reciprocal of the
+		// immediate; a no-op for zero and powers of two
+		if !isZeroOrPowerOf2(instr.imm) {
+			vm.reg[dst] *= reciprocal(instr.imm)
 		}
 		
 	case instrINEG_R:
 		// dst = -dst
-		vm.reg[dst] = uint64(-int64(vm.reg[dst]))
+		vm.reg[dst] = -vm.reg[dst]
 		
 	case instrIXOR_R:
-		// dst = dst XOR src
-		vm.reg[dst] ^= vm.reg[src]
+		// dst = dst XOR src, or dst XOR imm if src is dst
+		vm.reg[dst] ^= vm.operand(instr)
 		
 	case instrIXOR_M:
-		// dst = dst XOR mem[src + imm]
+		// dst = dst XOR mem
 		addr := vm.getMemoryAddress(instr)
 		vm.reg[dst] ^= vm.readMemory(addr)
 		
 	case instrIROR_R:
-		// dst = dst >>> src (rotate right)
-		vm.reg[dst] = bits.RotateLeft64(vm.reg[dst], -int(vm.reg[src]&63))
+		// dst = dst >>> src, or dst >>> imm if src is dst
+		vm.reg[dst] = bits.RotateLeft64(vm.reg[dst], -int(vm.operand(instr)&63))
 		
 	case instrIROL_R:
-		// dst = dst <<< src (rotate left)
-		vm.reg[dst] = bits.RotateLeft64(vm.reg[dst], int(vm.reg[src]&63))
+		// dst = dst <<< src, or dst <<< imm if src is dst
+		vm.reg[dst] = bits.RotateLeft64(vm.reg[dst], int(vm.operand(instr)&63))
 		
 	case instrISWAP_R:
 		// swap(dst, src) - but only if dst != src
@@ -300,85 +287,72 @@ func (vm *virtualMachine) executeInstructionFull(instr *instruction) {
 		}
 		
 	case instrFSWAP_R:
-		// swap floating-point registers
-		// Use E registers since there are only 4 F registers
-		fdst := dst % 4
-		fsrc := src % 4
-		if fdst != fsrc {
-			vm.regE[fdst], vm.regE[fsrc] = vm.regE[fsrc], vm.regE[fdst]
+		// swap the halves of f[dst], or of e[dst-4] for dst >= 4
+		reg := &vm.regF[dst%4]
+		if dst >= 4 {
+			reg = &vm.regE[dst%4]
 		}
+		reg[0], reg[1] = reg[1], reg[0]
 		
 	case instrFADD_R:
 		// f[dst] = f[dst] + a[src]
-		fdst := dst % 4
-		fsrc := src % 4
-		vm.regF[fdst] = vm.regF[fdst] + vm.regA(fsrc)
+		floatOp(&vm.regF[dst%4], vm.regA[src%4], vm.fprc, fpAdd)
 		
 	case instrFADD_M:
-		// f[dst] = f[dst] + mem[src + imm]
-		fdst := dst % 4
+		// f[dst] = f[dst] + mem[src + imm], as two int32 values
 		addr := vm.getMemoryAddress(instr)
-		val := vm.readMemoryFloat(addr)
-		vm.regF[fdst] = vm.regF[fdst] + val
+		floatOp(&vm.regF[dst%4], vm.readMemoryFloat(addr), vm.fprc, fpAdd)
 		
 	case instrFSUB_R:
 		// f[dst] = f[dst] - a[src]
-		fdst := dst % 4
-		fsrc := src % 4
-		vm.regF[fdst] = vm.regF[fdst] - vm.regA(fsrc)
+		floatOp(&vm.regF[dst%4], vm.regA[src%4], vm.fprc, fpSub)
 		
 	case instrFSUB_M:
-		// f[dst] = f[dst] - mem[src + imm]
-		fdst := dst % 4
+		// f[dst] = f[dst] - mem[src + imm], as two int32 values
 		addr := vm.getMemoryAddress(instr)
-		val := vm.readMemoryFloat(addr)
-		vm.regF[fdst] = vm.regF[fdst] - val
+		floatOp(&vm.regF[dst%4], vm.readMemoryFloat(addr), vm.fprc, fpSub)
 		
 	case instrFSCAL_R:
-		// f[dst] = f[dst] * 2^x (x from register)
-		fdst := dst % 4
-		// Use lower bits of src register to determine scale factor
-		exp := int32(vm.reg[src]&63) - 32
-		vm.regF[fdst] = math.Ldexp(vm.regF[fdst], int(exp))
+		// f[dst] = f[dst] ^ scaleMask, which flips the sign and four
+		// exponent bits of both halves
+		reg := &vm.regF[dst%4]
+		for i := range reg {
+			reg[i] = uint64ToFloat(floatToUint64(reg[i]) ^ scaleMask)
+		}
 		
 	case instrFMUL_R:
-		// f[dst] = f[dst] * e[src]
-		fdst := dst % 4
-		fsrc := src % 4
-		vm.regF[fdst] = vm.regF[fdst] * vm.regE[fsrc]
+		// e[dst] = e[dst] * a[src]
+		floatOp(&vm.regE[dst%4], vm.regA[src%4], vm.fprc, fpMul)
 		
 	case instrFDIV_M:
-		// e[dst] = e[dst] / mem[src + imm]
-		edst := dst % 4
+		// e[dst] = e[dst] / mem[src + imm], with the divisor masked
+		// like an E register so it is never zero
 		addr := vm.getMemoryAddress(instr)
-		val := vm.readMemoryFloat(addr)
-		if val != 0 {
-			vm.regE[edst] = vm.regE[edst] / val
-		}
+		floatOp(&vm.regE[dst%4], vm.maskRegisterE(vm.readMemoryFloat(addr)), vm.fprc, fpDiv)
 		
 	case instrFSQRT_R:
-		// e[dst] = sqrt(e[dst])
-		edst := dst % 4
-		vm.regE[edst] = math.Sqrt(math.Abs(vm.regE[edst]))
+		// e[dst] = sqrt(e[dst]); E registers are always positive
+		reg := &vm.regE[dst%4]
+		for i := range reg {
+			reg[i] = fpSqrt(reg[i], vm.fprc)
+		}
 		
 	case instrCBRANCH:
-		// Conditional branch - modifies register based on condition
-		// dst = dst + condition ? imm : 0
-		shift := instr.mod % 4
-		condition := vm.reg[dst] + uint64(instr.imm)
-		// Check if condition met (lower bits)
-		if (condition & ((1 << shift) - 1)) == 0 {
-			vm.reg[dst] += uint64(instr.imm)
-		}
+		// dst = dst + cimm; jump to the target if the 8 condition bits
+		// of dst are all zero
+		cimm, mask := branchOperands(instr)
+		vm.reg[dst] += cimm
+		return vm.reg[dst]&mask == 0
 		
 	case instrCFROUND:
 		// Set rounding mode for floating-point operations
-		// This affects subsequent FP operations
-		mode := vm.reg[src] & 3
+		// fprc = (src >>> imm%64) & 3, used by all later FP operations
+		mode := bits.RotateLeft64(vm.reg[src], -int(instr.imm&63)) & 3
 		vm.setRoundingMode(mode)
 		
 	case instrISTORE:
-		// Store integer to memory: mem[dst + imm] = src
+		// Store integer to memory: mem[dst + imm] = src, in L3 for the
+		// highest mod.cond values
 		addr := vm.getMemoryAddress(instr)
 		vm.writeMemory(addr, vm.reg[src])
 		
@@ -386,78 +360,148 @@ func (vm *virtualMachine) executeInstructionFull(instr *instruction) {
 		// No operation
 		break
 	}
+	return false
 }
 
 // Helper functions
 
-// int128mul performs signed 64x64->128 bit multiplication
-func int128mul(a, b int64) int64 {
-	// For the high 64 bits of signed multiplication
-	ua := uint64(a)
-	ub := uint64(b)
-	hi, _ := bits.Mul64(ua, ub)
-	
-	// Adjust for signs
-	if a < 0 {
-		hi -= ub
-	}
-	if b < 0 {
-		hi -= ua
+// Branch condition parameters from the specification: the condition
+// tests branchConditionBits bits of the register starting at bit
+// branchConditionOffset + mod>>4.
+const (
+	branchConditionBits   = 8
+	branchConditionOffset = 8
+)
+
+// branchOperands returns the value a CBRANCH adds to its register and
+// the mask of the bits that must be zero for the branch to be taken. The
+// immediate is sign-extended, with the lowest condition bit set and the
+// bit below it cleared, which makes the branch unlikely to be taken twice
+// in a row.
+func branchOperands(instr *instruction) (cimm, mask uint64) {
+	shift := uint(instr.getModCond()) + branchConditionOffset
+	cimm = uint64(int64(int32(instr.imm)))
+	cimm |= 1 << shift
+	cimm &^= 1 << (shift - 1)
+	mask = (1<<branchConditionBits - 1) << shift
+	return cimm, mask
+}
+
+// displacementReg is the register that IADD_RS also adds its immediate
+// to.
+const displacementReg = 5
+
+// operand returns the source operand of an integer instruction with a
+// register form: src, or the sign-extended immediate if src is dst.
+func (vm *virtualMachine) operand(instr *instruction) uint64 {
+	if instr.src&7 == instr.dst&7 {
+		return signExtend2sCompl(instr.imm)
 	}
-	
-	return int64(hi)
+	return vm.reg[instr.src&7]
 }
 
-// reciprocalApprox computes an approximation of 2^64 / divisor
-func reciprocalApprox(divisor uint64) uint64 {
-	if divisor == 0 {
-		return 0
+// isZeroOrPowerOf2 reports whether x has at most one bit set. IMUL_RCP
+// does nothing for these immediates.
+func isZeroOrPowerOf2(x uint32) bool {
+	return x&(x-1) == 0
+}
+
+// storeL3Condition is the lowest mod.cond for which ISTORE writes to L3.
+const storeL3Condition = 14
+
+// memoryOperand returns the register added to the immediate to address
+// the memory operand of instr, or -1 if the immediate is the whole
+// address, and the mask of the scratchpad level addressed:
+//
+//   - ISTORE writes to dst + imm, in L3 if mod.cond >= storeL3Condition
+//   - integer loads with src == dst read from imm, in L3
+//   - otherwise loads read from src + imm
+//
+// Unless L3 is given, mod.mem selects L1, or L2 if it is zero.
+func memoryOperand(instr *instruction) (reg int, mask uint32) {
+	dst, src := int(instr.dst&7), int(instr.src&7)
+	mask = scratchpadL2Mask
+	if instr.getModMem() != 0 {
+		mask = scratchpadL1Mask
 	}
-	
-	// Count leading zeros
-	shift := bits.LeadingZeros64(divisor)
-	
-	// Normalize divisor
-	_ = divisor << shift // normalized (unused for now)
-	
-	// Approximate reciprocal using Newton-Raphson or lookup table
-	// For now, use simple division
-	reciprocal := uint64(0xFFFFFFFFFFFFFFFF) / divisor
-	
-	return reciprocal
+
+	switch getInstructionType(instr.opcode) {
+	case instrISTORE:
+		if instr.getModCond() >= storeL3Condition {
+			mask = scratchpadL3Mask
+		}
+		return dst, mask
+	case instrIADD_M, instrISUB_M, instrIMUL_M, instrIMULH_M, instrISMULH_M, instrIXOR_M:
+		if src == dst {
+			return -1, scratchpadL3Mask
+		}
+	}
+	return src, mask
 }
 
-// readMemoryFloat reads a float64 value from memory
-func (vm *virtualMachine) readMemoryFloat(addr uint32) float64 {
+// readMemoryFloat reads the two signed 32-bit integers at addr and
+// converts them to the low and high halves of a float register.
+func (vm *virtualMachine) readMemoryFloat(addr uint32) [2]float64 {
 	val := vm.readMemory(addr)
-	// Mask to convert to proper float range
-	return maskFloat(math.Float64frombits(val))
+	return [2]float64{float64(int32(val)), float64(int32(val >> 32))}
+}
+
+// maskRegisterE forces a value into the range of the E registers: the
+// mantissa and low four exponent bits are kept and the rest of the
+// exponent comes from the configuration's eMask, so the result is
+// positive, finite and nonzero.
+func (vm *virtualMachine) maskRegisterE(f [2]float64) [2]float64 {
+	for i := range f {
+		f[i] = uint64ToFloat(floatToUint64(f[i])&dynamicMantissaMask | vm.config.eMask[i])
+	}
+	return f
 }
 
-// regA gets the A group register (used by floating-point ops)
-// A group = F group XOR E group
-func (vm *virtualMachine) regA(idx uint8) float64 {
-	idx = idx % 4
-	fBits := math.Float64bits(vm.regF[idx])
-	eBits := math.Float64bits(vm.regE[idx])
-	result := fBits ^ eBits
-	return maskFloat(math.Float64frombits(result))
+// floatOp applies op to both halves of dst and src, as the packed double
+// instructions of the reference implementation do.
+func floatOp(dst *[2]float64, src [2]float64, mode roundingMode, op func(a, b float64, mode roundingMode) float64) {
+	dst[0] = op(dst[0], src[0], mode)
+	dst[1] = op(dst[1], src[1], mode)
 }
 
-// setRoundingMode sets the FP rounding mode (stub for now)
+// setRoundingMode sets the FP rounding mode used by the float instructions.
+// Go cannot change the hardware rounding mode, so the instructions round
+// in software with the fpAdd family instead of fesetround().
 func (vm *virtualMachine) setRoundingMode(mode uint64) {
-	// Go doesn't allow changing FP rounding mode easily
-	// This is a limitation of pure Go implementation
-	// The reference implementation uses fesetround()
-	_ = mode
+	vm.fprc = roundingMode(mode & 3)
+}
+
+// Float register constants from the specification.
+const (
+	mantissaSize = 52
+	mantissaMask = 1<<mantissaSize - 1
+	exponentBias = 1023
+
+	// An E register takes its mantissa and the low four bits of its
+	// exponent from memory.
+	dynamicExponentBits = 4
+	dynamicMantissaMask = 1<<(mantissaSize+dynamicExponentBits) - 1
+
+	// Exponent bits set in every E register mask.
+	constExponentBits = 0x300
+
+	// FSCAL_R flips the sign and exponent bits 4-7.
+	scaleMask = 0x80F0000000000000
+)
+
+// smallPositiveFloatBits converts configuration entropy to an A register
+// value: the low 52 bits are the mantissa and the top five bits the
+// exponent, so the value is in [1, 2^32).
+func smallPositiveFloatBits(entropy uint64) uint64 {
+	exponent := entropy>>59 + exponentBias
+	return exponent<<mantissaSize | entropy&mantissaMask
 }
 
-// maskFloat applies RandomX float masking
-func maskFloat(f float64) float64 {
-	// RandomX uses specific masks to keep floats in valid range
-	// Mask out exponent bits to prevent inf/nan
-	bits := math.Float64bits(f)
-	// Mask exponent to reasonable range (RandomX spec)
-	bits &= 0x80F0FFFFFFFFFFFF // Preserve sign, limit exponent
-	return math.Float64frombits(bits)
+// floatMask converts configuration entropy to an E register exponent mask:
+// 22 low mantissa bits from the entropy and an exponent of
+// constExponentBits with bits 4-7 from the top of the entropy.
+func floatMask(entropy uint64) uint64 {
+	const mask22bit = 1<<22 - 1
+	exponent := uint64(constExponentBits) | entropy>>(64-4)<<dynamicExponentBits
+	return entropy&mask22bit | exponent<<mantissaSize
 }
@@ -0,0 +1,152 @@
+// Package aesround implements the single AES rounds RandomX is built on.
+//
+// RandomX does not use AES as a cipher. Its generators and scratchpad hash
+// apply one round at a time to independent 16-byte columns, exactly as the
+// x86 AESENC and AESDEC instructions do, with arbitrary data as the round
+// key. This package provides those two operations, with an AES-NI
+// implementation on amd64 and a table-driven one everywhere.
+package aesround
+
+import "encoding/binary"
+
+// Impl is an implementation of single AES rounds. The zero Impl is the
+// portable table-driven implementation.
+type Impl struct {
+	enc func(s, k *[16]byte)
+	dec func(s, k *[16]byte)
+}
+
+// Soft is the portable table-driven implementation.
+var Soft = Impl{}
+
+// Hardware returns the implementation using the CPU's AES instructions,
+// and whether the CPU has them. Where it does not, Hardware returns Soft.
+func Hardware() (Impl, bool) {
+	if !hasHardware {
+		return Soft, false
+	}
+	return Impl{enc: encHard, dec: decHard}, true
+}
+
+// Default returns the hardware implementation if the CPU supports it and
+// Soft otherwise.
+func Default() Impl {
+	impl, _ := Hardware()
+	return impl
+}
+
+// Enc applies one AES encryption round to s in place, like AESENC:
+// ShiftRows, SubBytes and MixColumns, then XOR with the round key k.
+func (i Impl) Enc(s, k *[16]byte) {
+	if i.enc == nil {
+		encSoft(s, k)
+		return
+	}
+	i.enc(s, k)
+}
+
+// Dec applies one AES decryption round to s in place, like AESDEC:
+// InvShiftRows, InvSubBytes and InvMixColumns, then XOR with the round
+// key k.
+func (i Impl) Dec(s, k *[16]byte) {
+	if i.dec == nil {
+		decSoft(s, k)
+		return
+	}
+	i.dec(s, k)
+}
+
+// Lookup tables for the table-driven implementation. te0[x] is the column
+// that byte x in row 0 contributes after SubBytes and MixColumns, stored
+// little-endian with row 0 in the low byte; te1 to te3 are te0 rotated for
+// rows 1 to 3. td0 to td3 are the same for InvSubBytes and InvMixColumns.
+var (
+	sbox, invSbox      [256]byte
+	te0, te1, te2, te3 [256]uint32
+	td0, td1, td2, td3 [256]uint32
+)
+
+func init() {
+	// Build the S-box from the multiplicative inverse in GF(2^8) and
+	// the affine transformation, walking the field with generator 3.
+	p, q := byte(1), byte(1)
+	for {
+		// p *= 3
+		p ^= p<<1 ^ byte(int8(p)>>7)&0x1b
+		// q /= 3
+		q ^= q << 1
+		q ^= q << 2
+		q ^= q << 4
+		q ^= byte(int8(q)>>7) & 0x09
+
+		x := q ^ rotl8(q, 1) ^ rotl8(q, 2) ^ rotl8(q, 3) ^ rotl8(q, 4) ^ 0x63
+		sbox[p] = x
+		invSbox[x] = p
+		if p == 1 {
+			break
+		}
+	}
+	sbox[0] = 0x63
+	invSbox[0x63] = 0
+
+	for x := 0; x < 256; x++ {
+		s := sbox[x]
+		e := uint32(mul(s, 2)) | uint32(s)<<8 | uint32(s)<<16 | uint32(mul(s, 3))<<24
+		te0[x], te1[x], te2[x], te3[x] = e, rotl32(e, 8), rotl32(e, 16), rotl32(e, 24)
+
+		i := invSbox[x]
+		d := uint32(mul(i, 14)) | uint32(mul(i, 9))<<8 | uint32(mul(i, 13))<<16 | uint32(mul(i, 11))<<24
+		td0[x], td1[x], td2[x], td3[x] = d, rotl32(d, 8), rotl32(d, 16), rotl32(d, 24)
+	}
+}
+
+// mul multiplies a and b in GF(2^8) with the AES polynomial.
+func mul(a, b byte) byte {
+	var p byte
+	for b != 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		a = a<<1 ^ byte(int8(a)>>7)&0x1b
+		b >>= 1
+	}
+	return p
+}
+
+func rotl8(x byte, n uint) byte {
+	return x<<n | x>>(8-n)
+}
+
+func rotl32(x uint32, n uint) uint32 {
+	return x<<n | x>>(32-n)
+}
+
+// encSoft is Impl.Enc with lookup tables. Column c of the result takes
+// row r from column c+r of s, which is ShiftRows.
+func encSoft(s, k *[16]byte) {
+	var out [4]uint32
+	for c := 0; c < 4; c++ {
+		out[c] = te0[s[4*c]] ^
+			te1[s[4*((c+1)&3)+1]] ^
+			te2[s[4*((c+2)&3)+2]] ^
+			te3[s[4*((c+3)&3)+3]]
+	}
+	for c := 0; c < 4; c++ {
+		binary.LittleEndian.PutUint32(s[4*c:], out[c]^binary.LittleEndian.Uint32(k[4*c:]))
+	}
+}
+
+// decSoft is Impl.Dec with lookup tables. Column c of the result takes
+// row r from column c-r of s, which is InvShiftRows.
+func decSoft(s, k *[16]byte) {
+	var out [4]uint32
+	for c := 0; c < 4; c++ {
+		out[c] = td0[s[4*c]] ^
+			td1[s[4*((c-1)&3)+1]] ^
+			td2[s[4*((c-2)&3)+2]] ^
+			td3[s[4*((c-3)&3)+3]]
+	}
+	for c := 0; c < 4; c++ {
+		binary.LittleEndian.PutUint32(s[4*c:], out[c]^binary.LittleEndian.Uint32(k[4*c:]))
+	}
+}
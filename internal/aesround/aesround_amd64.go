@@ -0,0 +1,17 @@
+//go:build amd64
+
+package aesround
+
+import "golang.org/x/sys/cpu"
+
+var hasHardware = cpu.X86.HasAES
+
+// encHard is Impl.Enc with the AESENC instruction.
+//
+//go:noescape
+func encHard(s, k *[16]byte)
+
+// decHard is Impl.Dec with the AESDEC instruction.
+//
+//go:noescape
+func decHard(s, k *[16]byte)
@@ -0,0 +1,23 @@
+//go:build amd64
+
+#include "textflag.h"
+
+// func encHard(s, k *[16]byte)
+TEXT ·encHard(SB), NOSPLIT, $0-16
+	MOVQ  s+0(FP), AX
+	MOVQ  k+8(FP), BX
+	MOVOU (AX), X0
+	MOVOU (BX), X1
+	AESENC X1, X0
+	MOVOU X0, (AX)
+	RET
+
+// func decHard(s, k *[16]byte)
+TEXT ·decHard(SB), NOSPLIT, $0-16
+	MOVQ  s+0(FP), AX
+	MOVQ  k+8(FP), BX
+	MOVOU (AX), X0
+	MOVOU (BX), X1
+	AESDEC X1, X0
+	MOVOU X0, (AX)
+	RET
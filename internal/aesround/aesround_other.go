@@ -0,0 +1,14 @@
+//go:build !amd64
+
+package aesround
+
+// hasHardware is false where there is no assembly implementation.
+const hasHardware = false
+
+func encHard(s, k *[16]byte) {
+	panic("aesround: no hardware implementation")
+}
+
+func decHard(s, k *[16]byte) {
+	panic("aesround: no hardware implementation")
+}
@@ -0,0 +1,119 @@
+package aesround
+
+import (
+	"encoding/hex"
+	"math/rand"
+	"testing"
+)
+
+// implementations returns the implementations available on this machine.
+func implementations() map[string]Impl {
+	impls := map[string]Impl{"Soft": Soft}
+	if hard, ok := Hardware(); ok {
+		impls["Hardware"] = hard
+	}
+	return impls
+}
+
+func block(t *testing.T, s string) [16]byte {
+	t.Helper()
+	var b [16]byte
+	if n, err := hex.Decode(b[:], []byte(s)); err != nil || n != 16 {
+		t.Fatalf("bad test block %q: %v", s, err)
+	}
+	return b
+}
+
+// Test single rounds against known answers. The encryption round is round 1
+// of the FIPS-197 Appendix B example; the decryption round is AESDEC on the
+// same inputs.
+func TestRounds(t *testing.T) {
+	const (
+		state  = "193de3bea0f4e22b9ac68d2ae9f84808"
+		key    = "a0fafe1788542cb123a339392a6c7605"
+		encOut = "a49c7ff2689f352b6b5bea43026a5049"
+		decOut = "123ecd82bf90896a4c52d233e719f177"
+	)
+
+	for name, impl := range implementations() {
+		t.Run(name, func(t *testing.T) {
+			k := block(t, key)
+
+			s := block(t, state)
+			impl.Enc(&s, &k)
+			if got := hex.EncodeToString(s[:]); got != encOut {
+				t.Errorf("Enc() = %s, want %s", got, encOut)
+			}
+
+			s = block(t, state)
+			impl.Dec(&s, &k)
+			if got := hex.EncodeToString(s[:]); got != decOut {
+				t.Errorf("Dec() = %s, want %s", got, decOut)
+			}
+		})
+	}
+}
+
+// Test the generated S-boxes
+func TestSbox(t *testing.T) {
+	// Spot values from FIPS-197 Figure 7
+	for x, want := range map[byte]byte{0x00: 0x63, 0x01: 0x7c, 0x53: 0xed, 0xff: 0x16} {
+		if sbox[x] != want {
+			t.Errorf("sbox[%#02x] = %#02x, want %#02x", x, sbox[x], want)
+		}
+	}
+	for x := 0; x < 256; x++ {
+		if invSbox[sbox[x]] != byte(x) {
+			t.Fatalf("invSbox[sbox[%#02x]] = %#02x", x, invSbox[sbox[x]])
+		}
+	}
+}
+
+// Test that the table-driven rounds match the AES instructions
+func TestSoftMatchesHardware(t *testing.T) {
+	hard, ok := Hardware()
+	if !ok {
+		t.Skip("no hardware AES on this machine")
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		var s, k [16]byte
+		rng.Read(s[:])
+		rng.Read(k[:])
+
+		soft, want := s, s
+		Soft.Enc(&soft, &k)
+		hard.Enc(&want, &k)
+		if soft != want {
+			t.Fatalf("Soft.Enc(%x, %x) = %x, want %x", s, k, soft, want)
+		}
+
+		soft, want = s, s
+		Soft.Dec(&soft, &k)
+		hard.Dec(&want, &k)
+		if soft != want {
+			t.Fatalf("Soft.Dec(%x, %x) = %x, want %x", s, k, soft, want)
+		}
+	}
+}
+
+func benchmarkEnc(b *testing.B, impl Impl) {
+	var s, k [16]byte
+	b.SetBytes(16)
+	for i := 0; i < b.N; i++ {
+		impl.Enc(&s, &k)
+	}
+}
+
+func BenchmarkEncSoft(b *testing.B) {
+	benchmarkEnc(b, Soft)
+}
+
+func BenchmarkEncHardware(b *testing.B) {
+	hard, ok := Hardware()
+	if !ok {
+		b.Skip("no hardware AES on this machine")
+	}
+	benchmarkEnc(b, hard)
+}
@@ -1,54 +1,46 @@
 package internal
 
 import (
-	"github.com/opd-ai/go-randomx/internal/argon2d"
-)
-
-// Argon2Config specifies Argon2 parameters for RandomX.
-type Argon2Config struct {
-	Time      uint32 // Number of iterations
-	Memory    uint32 // Memory in KB
-	Threads   uint8  // Parallelism factor
-	OutputLen uint32 // Output length in bytes
-	Salt      []byte // Salt value
-}
+	"context"
 
-// DefaultRandomXArgon2Config returns the Argon2 configuration used by RandomX.
-func DefaultRandomXArgon2Config(salt []byte) Argon2Config {
-	return Argon2Config{
-		Time:      3,      // 3 iterations
-		Memory:    262144, // 256 MB
-		Threads:   1,      // Single-threaded
-		OutputLen: 262144, // 256 KB output
-		Salt:      salt,
-	}
-}
-
-// Argon2d computes Argon2d hash (data-dependent, used by RandomX).
-//
-// This delegates to the proper Argon2d implementation in internal/argon2d
-// which provides full data-dependent addressing as required by RandomX.
-func Argon2d(password []byte, config Argon2Config) []byte {
-	// Convert salt to match argon2d.Argon2d signature
-	salt := config.Salt
-	if salt == nil {
-		salt = []byte{} // Empty salt if none provided
-	}
+	"github.com/opd-ai/go-randomx/argon2"
+)
 
-	return argon2d.Argon2d(password, salt, config.Time, config.Memory, uint32(config.Threads), config.OutputLen)
-}
+// Argon2d parameters of the RandomX cache, as used by Argon2dCache.
+const (
+	Argon2CacheMemoryKB   = argon2.RandomXMemory
+	Argon2CacheIterations = argon2.RandomXTime
+	Argon2CacheLanes      = argon2.RandomXLanes
+)
 
-// Argon2dCache generates the RandomX cache using proper Argon2d.
-// This uses the custom Argon2d implementation in internal/argon2d which
-// provides full data-dependent addressing as required by RandomX.
+// Argon2dCache generates the RandomX cache with the RandomX preset of the
+// argon2 package.
 //
 // RandomX parameters:
 //   - Memory: 256 MB (262144 KB)
 //   - Time: 3 passes
 //   - Lanes: 1 (single-threaded)
-//   - Output: 256 KB cache
+//   - Salt: "RandomX\x03"
 //
-// The key is used as both password and salt, following RandomX specification.
+// The cache is the Argon2d memory after the last pass, not a tag.
 func Argon2dCache(key []byte) []byte {
-	return argon2d.Argon2dCache(key)
+	return argon2.RandomXCache(key)
+}
+
+// Argon2ProgressFunc receives periodic progress updates from the Argon2d
+// memory fill. See argon2.ProgressFunc.
+type Argon2ProgressFunc = argon2.ProgressFunc
+
+// Argon2dCacheContext is Argon2dCache with cancellation support.
+// It returns ctx.Err() if the context is cancelled during the memory fill.
+// If progress is non-nil it receives periodic updates from the fill.
+func Argon2dCacheContext(ctx context.Context, key []byte, progress Argon2ProgressFunc) ([]byte, error) {
+	return argon2.RandomXCacheContext(ctx, key, progress)
+}
+
+// Argon2dCacheInto is Argon2dCacheContext filling dst, which must be the
+// size of the cache, in place, compressing blocks with impl. See
+// argon2.RandomXCacheInto.
+func Argon2dCacheInto(ctx context.Context, key, dst []byte, impl argon2.Impl, progress Argon2ProgressFunc) error {
+	return argon2.RandomXCacheInto(ctx, key, dst, impl, progress)
 }
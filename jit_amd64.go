@@ -0,0 +1,511 @@
+//go:build unix
+
+package randomx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// jitSupported reports whether this build can compile programs to native
+// code.
+const jitSupported = true
+
+// jitCodeSize is the size of the executable mapping for one compiled
+// program. The longest instruction compiles to well under 64 bytes.
+const jitCodeSize = 64 * 1024
+
+// jitCall runs the compiled program at code on vm's registers and the
+// scratchpad at mem. It is implemented in jit_amd64.s.
+//
+//go:noescape
+func jitCall(code *byte, vm *virtualMachine, mem *byte)
+
+// jitCompiler compiles RandomX programs to x86-64 machine code and runs
+// them. The code is generated to give exactly the results of
+// executeInstructionFull, so the two can be used interchangeably.
+//
+// The compiled code keeps r0-r7 in R8-R15, f0-f3 in X0-X3, e0-e3 in X4-X7
+// and a0-a3 in X8-X11 while it runs, each float register as a pair of
+// doubles. X13-X15 hold the E register masks and the FSCAL_R mask. RDI
+// points to the virtualMachine and RSI to the scratchpad; RAX, RCX, RDX
+// and X12 are scratch. The float instructions round in the MXCSR mode,
+// which the code sets from the VM's fprc and changes on CFROUND; jitCall
+// restores the caller's MXCSR.
+type jitCompiler struct {
+	code   []byte // executable mapping
+	buf    []byte // machine code being assembled
+	prot   int    // current protection of code
+	secure bool   // never map code writable and executable at once
+}
+
+// newJITCompiler maps the memory for compiled code. The owner of the VM
+// must unmap it with release; the finalizer is only a backstop for a
+// compiler that is dropped without it.
+func newJITCompiler() (*jitCompiler, error) {
+	code, err := unix.Mmap(-1, 0, jitCodeSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		return nil, fmt.Errorf("randomx: map JIT code: %w", err)
+	}
+	c := &jitCompiler{
+		code: code,
+		buf:  make([]byte, 0, jitCodeSize),
+		prot: unix.PROT_READ | unix.PROT_WRITE,
+	}
+	runtime.SetFinalizer(c, (*jitCompiler).release)
+	return c, nil
+}
+
+// release unmaps the compiled code.
+func (c *jitCompiler) release() error {
+	if c.code == nil {
+		return nil
+	}
+	runtime.SetFinalizer(c, nil)
+	err := unix.Munmap(c.code)
+	c.code = nil
+	return err
+}
+
+// protect changes the protection of the code mapping.
+func (c *jitCompiler) protect(prot int) error {
+	if c.prot == prot {
+		return nil
+	}
+	if err := unix.Mprotect(c.code, prot); err != nil {
+		return fmt.Errorf("randomx: protect JIT code: %w", err)
+	}
+	c.prot = prot
+	return nil
+}
+
+// errJITCodeSize is returned if a program does not fit the code mapping,
+// which would be a bug in the compiler.
+var errJITCodeSize = errors.New("randomx: compiled program exceeds JIT code size")
+
+// compile replaces the compiled code with p. In secure mode the mapping
+// is made writable for the copy and executable afterwards; otherwise it
+// stays writable and executable.
+func (c *jitCompiler) compile(p *program) error {
+	c.buf = c.buf[:0]
+	a := (*jitAssembler)(&c.buf)
+	a.prologue()
+	var offsets [programLength]int
+	for i := range p.instructions {
+		offsets[i] = len(c.buf)
+		a.instruction(&p.instructions[i], &offsets)
+	}
+	a.epilogue()
+	if len(c.buf) > len(c.code) {
+		return errJITCodeSize
+	}
+
+	rw, rx := unix.PROT_READ|unix.PROT_WRITE, unix.PROT_READ|unix.PROT_EXEC
+	if !c.secure {
+		rw |= unix.PROT_EXEC
+		rx = rw
+	}
+	if err := c.protect(rw); err != nil {
+		return err
+	}
+	copy(c.code, c.buf)
+	return c.protect(rx)
+}
+
+// run executes the compiled program once on vm, in place of calling
+// executeInstruction for each of its instructions.
+func (c *jitCompiler) run(vm *virtualMachine) {
+	jitCall(&c.code[0], vm, &vm.mem[0])
+}
+
+// x86-64 register numbers.
+const (
+	rax = 0
+	rcx = 1
+	rdx = 2
+	rbx = 3
+	rsi = 6
+	rdi = 7
+
+	// xmm12 is the scratch SSE register; xmm13 and xmm14 hold the
+	// dynamicMantissaMask and eMask pairs, xmm15 the scaleMask pair.
+	xmm12 = 12
+	xmm13 = 13
+	xmm14 = 14
+	xmm15 = 15
+)
+
+// Offsets of the register files in virtualMachine.
+var (
+	jitRegOffset   = int32(unsafe.Offsetof(virtualMachine{}.reg))
+	jitRegFOffset  = int32(unsafe.Offsetof(virtualMachine{}.regF))
+	jitRegEOffset  = int32(unsafe.Offsetof(virtualMachine{}.regE))
+	jitRegAOffset  = int32(unsafe.Offsetof(virtualMachine{}.regA))
+	jitEMaskOffset = int32(unsafe.Offsetof(virtualMachine{}.config) + unsafe.Offsetof(vmConfig{}.eMask))
+	jitFprcOffset  = int32(unsafe.Offsetof(virtualMachine{}.fprc))
+	jitMXCSROffset = int32(unsafe.Offsetof(virtualMachine{}.jitMXCSR))
+)
+
+// jitAssembler appends x86-64 instructions to a buffer. Only the forms
+// the compiler needs are supported.
+type jitAssembler []byte
+
+// gpr returns the native register holding VM register r.
+func gpr(r uint8) byte { return 8 + r&7 }
+
+// freg, ereg and areg return the SSE registers holding f, e and a
+// registers.
+func freg(r uint8) byte { return r & 3 }
+func ereg(r uint8) byte { return 4 + r&3 }
+func areg(r uint8) byte { return 8 + r&3 }
+
+func (a *jitAssembler) emit(b ...byte) {
+	*a = append(*a, b...)
+}
+
+func (a *jitAssembler) imm32(v uint32) {
+	*a = binary.LittleEndian.AppendUint32(*a, v)
+}
+
+// op emits an optional mandatory prefix (0 for none), a REX prefix if w
+// is set or an extended register is used, and the opcode. reg goes in
+// ModRM.reg, index in SIB.index and base in ModRM.rm or SIB.base.
+func (a *jitAssembler) op(prefix byte, w bool, opcode []byte, reg, index, base byte) {
+	if prefix != 0 {
+		a.emit(prefix)
+	}
+	rex := byte(0x40)
+	if w {
+		rex |= 8
+	}
+	rex |= reg >> 3 << 2
+	rex |= index >> 3 << 1
+	rex |= base >> 3
+	if rex != 0x40 {
+		a.emit(rex)
+	}
+	a.emit(opcode...)
+}
+
+// rr emits an instruction with register operands: reg (or an opcode
+// extension) and rm.
+func (a *jitAssembler) rr(prefix byte, w bool, opcode []byte, reg, rm byte) {
+	a.op(prefix, w, opcode, reg, 0, rm)
+	a.emit(0xC0 | reg&7<<3 | rm&7)
+}
+
+// rs emits an instruction with a register operand and the scratchpad
+// operand [rsi+index].
+func (a *jitAssembler) rs(prefix byte, w bool, opcode []byte, reg, index byte) {
+	a.op(prefix, w, opcode, reg, index, rsi)
+	a.emit(0x04|reg&7<<3, index&7<<3|rsi)
+}
+
+// rv emits an instruction with a register operand and the VM field
+// operand [rdi+disp].
+func (a *jitAssembler) rv(prefix byte, w bool, opcode []byte, reg byte, disp int32) {
+	a.op(prefix, w, opcode, reg, 0, rdi)
+	a.emit(0x80 | reg&7<<3 | rdi)
+	a.imm32(uint32(disp))
+}
+
+func (a *jitAssembler) mov(dst, src byte) {
+	a.rr(0, true, []byte{0x8B}, dst, src)
+}
+
+func (a *jitAssembler) movImm32(dst byte, v uint32) {
+	a.op(0, false, []byte{0xB8 + dst&7}, 0, 0, dst)
+	a.imm32(v)
+}
+
+func (a *jitAssembler) movImm64(dst byte, v uint64) {
+	a.op(0, true, []byte{0xB8 + dst&7}, 0, 0, dst)
+	*a = binary.LittleEndian.AppendUint64(*a, v)
+}
+
+// movqToX moves 64 bits from a general purpose register to the low half
+// of an SSE register.
+func (a *jitAssembler) movqToX(x, r byte) {
+	a.rr(0x66, true, []byte{0x0F, 0x6E}, x, r)
+}
+
+// sse emits a packed double instruction (66 0F opcode) on two SSE
+// registers.
+func (a *jitAssembler) sse(opcode byte, dst, src byte) {
+	a.rr(0x66, false, []byte{0x0F, opcode}, dst, src)
+}
+
+// SSE packed double opcodes.
+const (
+	sseSqrt = 0x51
+	sseAnd  = 0x54
+	sseOr   = 0x56
+	sseXor  = 0x57
+	sseAdd  = 0x58
+	sseMul  = 0x59
+	sseSub  = 0x5C
+	sseDiv  = 0x5E
+)
+
+// movupd is the opcode of an unaligned packed double load (or, plus one,
+// store).
+var movupd = []byte{0x0F, 0x10}
+
+// broadcast loads v into both halves of x.
+func (a *jitAssembler) broadcast(x byte, v uint64) {
+	a.movImm64(rax, v)
+	a.movqToX(x, rax)
+	a.rr(0x66, false, []byte{0x0F, 0x6C}, x, x) // punpcklqdq x, x
+}
+
+// jzBack emits a near jz to the earlier code offset target.
+func (a *jitAssembler) jzBack(target int) {
+	a.emit(0x0F, 0x84)
+	a.imm32(uint32(int32(target - len(*a) - 4)))
+}
+
+// prologue loads the register files and the float masks.
+func (a *jitAssembler) prologue() {
+	for i := uint8(0); i < 8; i++ {
+		a.rv(0, true, []byte{0x8B}, gpr(i), jitRegOffset+8*int32(i))
+	}
+	for i := uint8(0); i < 4; i++ {
+		a.rv(0x66, false, movupd, freg(i), jitRegFOffset+16*int32(i))
+		a.rv(0x66, false, movupd, ereg(i), jitRegEOffset+16*int32(i))
+		a.rv(0x66, false, movupd, areg(i), jitRegAOffset+16*int32(i))
+	}
+	a.broadcast(xmm13, dynamicMantissaMask)
+	a.rv(0x66, false, movupd, xmm14, jitEMaskOffset)
+	a.broadcast(xmm15, scaleMask)
+	a.rv(0, false, []byte{0x0F, 0xB6}, rax, jitFprcOffset) // movzx eax, byte fprc
+	a.setRoundingMode()
+}
+
+// setRoundingMode loads MXCSR for the rounding mode in eax: the Go
+// default 0x1F80, with all exceptions masked, and the mode in bits 13-14.
+func (a *jitAssembler) setRoundingMode() {
+	a.rr(0, false, []byte{0xC1}, 4, rax) // shl eax, 13
+	a.emit(13)
+	a.rr(0, false, []byte{0x81}, 1, rax) // or eax, 0x1F80
+	a.imm32(0x1F80)
+	a.rv(0, false, []byte{0x89}, rax, jitMXCSROffset)
+	a.rv(0, false, []byte{0x0F, 0xAE}, 2, jitMXCSROffset) // ldmxcsr
+}
+
+// epilogue stores the register files and returns.
+func (a *jitAssembler) epilogue() {
+	for i := uint8(0); i < 8; i++ {
+		a.rv(0, true, []byte{0x89}, gpr(i), jitRegOffset+8*int32(i))
+	}
+	movupdStore := []byte{0x0F, 0x11}
+	for i := uint8(0); i < 4; i++ {
+		a.rv(0x66, false, movupdStore, freg(i), jitRegFOffset+16*int32(i))
+		a.rv(0x66, false, movupdStore, ereg(i), jitRegEOffset+16*int32(i))
+	}
+	a.emit(0xC3)
+}
+
+// address computes the scratchpad offset of a memory operand into dst,
+// as getMemoryAddress does.
+func (a *jitAssembler) address(dst byte, instr *instruction) {
+	reg, mask := memoryOperand(instr)
+	if reg < 0 {
+		a.movImm32(dst, instr.imm&mask)
+		return
+	}
+
+	a.mov(dst, gpr(uint8(reg)))
+	// Only the low bits survive the mask, so 32-bit arithmetic will do.
+	a.rr(0, false, []byte{0x81}, 0, dst) // add dst, imm
+	a.imm32(instr.imm)
+	a.rr(0, false, []byte{0x81}, 4, dst) // and dst, mask
+	a.imm32(mask)
+}
+
+// loadFloat converts the two int32 values of the memory operand of instr
+// into xmm12, as readMemoryFloat does.
+func (a *jitAssembler) loadFloat(instr *instruction) {
+	a.address(rax, instr)
+	a.rs(0xF3, false, []byte{0x0F, 0xE6}, xmm12, rax) // cvtdq2pd
+}
+
+// instruction compiles one instruction. Each case mirrors the same case
+// of executeInstructionFull. offsets holds the code offsets of the
+// instructions compiled so far, which CBRANCH jumps back to.
+func (a *jitAssembler) instruction(instr *instruction, offsets *[programLength]int) {
+	dst, src := gpr(instr.dst), gpr(instr.src)
+
+	typ := getInstructionType(instr.opcode)
+	switch typ {
+	case instrIADD_RS:
+		a.mov(rax, src)
+		if shift := instr.getModShift(); shift != 0 {
+			a.rr(0, true, []byte{0xC1}, 4, rax) // shl rax, shift
+			a.emit(shift)
+		}
+		a.rr(0, true, []byte{0x03}, dst, rax)
+		if instr.dst&7 == displacementReg {
+			a.rr(0, true, []byte{0x81}, 0, dst) // add dst, imm
+			a.imm32(instr.imm)
+		}
+
+	case instrIADD_M:
+		a.address(rax, instr)
+		a.rs(0, true, []byte{0x03}, dst, rax)
+
+	case instrISUB_R:
+		if dst != src {
+			a.rr(0, true, []byte{0x2B}, dst, src)
+		} else {
+			a.rr(0, true, []byte{0x81}, 5, dst) // sub dst, imm
+			a.imm32(instr.imm)
+		}
+
+	case instrISUB_M:
+		a.address(rax, instr)
+		a.rs(0, true, []byte{0x2B}, dst, rax)
+
+	case instrIMUL_R:
+		if dst != src {
+			a.rr(0, true, []byte{0x0F, 0xAF}, dst, src)
+		} else {
+			a.rr(0, true, []byte{0x69}, dst, dst) // imul dst, dst, imm
+			a.imm32(instr.imm)
+		}
+
+	case instrIMUL_M:
+		a.address(rax, instr)
+		a.rs(0, true, []byte{0x0F, 0xAF}, dst, rax)
+
+	case instrIMULH_R, instrISMULH_R:
+		ext := byte(4) // mul
+		if typ == instrISMULH_R {
+			ext = 5 // imul
+		}
+		a.mov(rax, dst)
+		a.rr(0, true, []byte{0xF7}, ext, src)
+		a.mov(dst, rdx)
+
+	case instrIMULH_M, instrISMULH_M:
+		ext := byte(4)
+		if typ == instrISMULH_M {
+			ext = 5
+		}
+		a.address(rcx, instr)
+		a.mov(rax, dst)
+		a.rs(0, true, []byte{0xF7}, ext, rcx)
+		a.mov(dst, rdx)
+
+	case instrIMUL_RCP:
+		if !isZeroOrPowerOf2(instr.imm) {
+			a.movImm64(rax, reciprocal(instr.imm))
+			a.rr(0, true, []byte{0x0F, 0xAF}, dst, rax)
+		}
+
+	case instrINEG_R:
+		a.rr(0, true, []byte{0xF7}, 3, dst)
+
+	case instrIXOR_R:
+		if dst != src {
+			a.rr(0, true, []byte{0x33}, dst, src)
+		} else {
+			a.rr(0, true, []byte{0x81}, 6, dst) // xor dst, imm
+			a.imm32(instr.imm)
+		}
+
+	case instrIXOR_M:
+		a.address(rax, instr)
+		a.rs(0, true, []byte{0x33}, dst, rax)
+
+	case instrIROR_R, instrIROL_R:
+		ext := byte(1) // ror
+		if typ == instrIROL_R {
+			ext = 0 // rol
+		}
+		if dst != src {
+			a.mov(rcx, src)
+			a.rr(0, true, []byte{0xD3}, ext, dst) // dst, cl
+		} else {
+			a.rr(0, true, []byte{0xC1}, ext, dst) // dst, imm
+			a.emit(byte(instr.imm & 63))
+		}
+
+	case instrISWAP_R:
+		if dst != src {
+			a.rr(0, true, []byte{0x87}, dst, src)
+		}
+
+	case instrFSWAP_R:
+		x := freg(instr.dst)
+		if instr.dst&7 >= 4 {
+			x = ereg(instr.dst)
+		}
+		a.rr(0x66, false, []byte{0x0F, 0xC6}, x, x) // shufpd x, x, 1
+		a.emit(1)
+
+	case instrFADD_R:
+		a.sse(sseAdd, freg(instr.dst), areg(instr.src))
+
+	case instrFSUB_R:
+		a.sse(sseSub, freg(instr.dst), areg(instr.src))
+
+	case instrFADD_M, instrFSUB_M:
+		a.loadFloat(instr)
+		opcode := byte(sseAdd)
+		if typ == instrFSUB_M {
+			opcode = sseSub
+		}
+		a.sse(opcode, freg(instr.dst), xmm12)
+
+	case instrFSCAL_R:
+		a.sse(sseXor, freg(instr.dst), xmm15)
+
+	case instrFMUL_R:
+		a.sse(sseMul, ereg(instr.dst), areg(instr.src))
+
+	case instrFDIV_M:
+		// The divisor is masked like an E register, as maskRegisterE
+		// does.
+		a.loadFloat(instr)
+		a.sse(sseAnd, xmm12, xmm13)
+		a.sse(sseOr, xmm12, xmm14)
+		a.sse(sseDiv, ereg(instr.dst), xmm12)
+
+	case instrFSQRT_R:
+		a.sse(sseSqrt, ereg(instr.dst), ereg(instr.dst))
+
+	case instrCBRANCH:
+		// Both operands fit a sign-extended imm32: the condition bits
+		// end below bit 31 and only bits below them differ from the
+		// sign-extended immediate.
+		cimm, mask := branchOperands(instr)
+		a.rr(0, true, []byte{0x81}, 0, dst) // add dst, cimm
+		a.imm32(uint32(cimm))
+		a.rr(0, true, []byte{0xF7}, 0, dst) // test dst, mask
+		a.imm32(uint32(mask))
+		a.jzBack(offsets[instr.target])
+
+	case instrCFROUND:
+		// fprc = (src >>> imm%64) & 3
+		a.mov(rax, src)
+		if rot := byte(instr.imm & 63); rot != 0 {
+			a.rr(0, true, []byte{0xC1}, 1, rax) // ror rax, rot
+			a.emit(rot)
+		}
+		a.rr(0, false, []byte{0x83}, 4, rax) // and eax, 3
+		a.emit(3)
+		a.rv(0, false, []byte{0x88}, rax, jitFprcOffset) // mov byte fprc, al
+		a.setRoundingMode()
+
+	case instrISTORE:
+		a.address(rax, instr)
+		a.rs(0, true, []byte{0x89}, src, rax)
+
+	case instrNOP:
+	}
+}
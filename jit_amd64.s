@@ -0,0 +1,39 @@
+//go:build unix
+
+#include "textflag.h"
+
+// func jitCall(code *byte, vm *virtualMachine, mem *byte)
+//
+// The compiled code expects the VM in DI and the scratchpad in SI. It
+// clobbers R8-R15 and X0-X15 but not BP, and uses no stack beyond the return
+// address of the call. It changes the rounding mode in MXCSR, so the
+// caller's MXCSR is saved and restored around it.
+TEXT ·jitCall(SB), NOSPLIT, $8-24
+	STMXCSR 0(SP)
+	MOVQ    code+0(FP), AX
+	MOVQ    vm+8(FP), DI
+	MOVQ    mem+16(FP), SI
+	CALL    AX
+	LDMXCSR 0(SP)
+	RET
+
+// func superscalarCall(code, cache, out *byte, start, end uint64)
+//
+// The item function at code expects the item number in BX, the cache in
+// SI and the output in DI, and leaves them unchanged.
+TEXT ·superscalarCall(SB), NOSPLIT, $0-40
+	MOVQ cache+8(FP), SI
+	MOVQ out+16(FP), DI
+	MOVQ start+24(FP), BX
+
+loop:
+	CMPQ BX, end+32(FP)
+	JAE  done
+	MOVQ code+0(FP), AX
+	CALL AX
+	ADDQ $64, DI
+	INCQ BX
+	JMP  loop
+
+done:
+	RET
@@ -0,0 +1,335 @@
+//go:build unix
+
+package randomx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// randomProgram returns a program of random instructions and the set of
+// instruction types it contains.
+func randomProgram(rng *rand.Rand) (*program, map[instructionType]bool) {
+	p := &program{}
+	types := make(map[instructionType]bool)
+	var raw [8]byte
+	for i := range p.instructions {
+		rng.Read(raw[:])
+		p.instructions[i] = decodeInstruction(raw[:])
+		types[getInstructionType(p.instructions[i].opcode)] = true
+	}
+	p.setBranchTargets()
+	return p, types
+}
+
+// randomVMState fills the registers and scratchpad of vm the way a
+// program's configuration and an iteration do: a random configuration,
+// random integer registers and float registers converted from int32
+// pairs, with the E registers masked.
+func randomVMState(rng *rand.Rand, vm *virtualMachine) {
+	var config [128]byte
+	rng.Read(config[:])
+	vm.parseConfiguration(config[:])
+	for i := range vm.reg {
+		vm.reg[i] = rng.Uint64()
+	}
+	for i := range vm.regF {
+		vm.regF[i] = [2]float64{float64(int32(rng.Uint32())), float64(int32(rng.Uint32()))}
+		vm.regE[i] = vm.maskRegisterE([2]float64{float64(int32(rng.Uint32())), float64(int32(rng.Uint32()))})
+	}
+	rng.Read(vm.mem)
+	vm.fprc = roundingMode(rng.Intn(4))
+}
+
+// compareVMs reports differences between the state of two VMs.
+func compareVMs(t *testing.T, got, want *virtualMachine) {
+	t.Helper()
+	for i := range want.reg {
+		if got.reg[i] != want.reg[i] {
+			t.Errorf("r%d = %#x, want %#x", i, got.reg[i], want.reg[i])
+		}
+	}
+	for i := range want.regF {
+		for j := range want.regF[i] {
+			if g, w := math.Float64bits(got.regF[i][j]), math.Float64bits(want.regF[i][j]); g != w {
+				t.Errorf("f%d[%d] = %#x, want %#x", i, j, g, w)
+			}
+			if g, w := math.Float64bits(got.regE[i][j]), math.Float64bits(want.regE[i][j]); g != w {
+				t.Errorf("e%d[%d] = %#x, want %#x", i, j, g, w)
+			}
+		}
+	}
+	if got.fprc != want.fprc {
+		t.Errorf("fprc = %d, want %d", got.fprc, want.fprc)
+	}
+	if !bytes.Equal(got.mem, want.mem) {
+		for i := 0; i < len(want.mem); i += 8 {
+			if g, w := binary.LittleEndian.Uint64(got.mem[i:]), binary.LittleEndian.Uint64(want.mem[i:]); g != w {
+				t.Errorf("scratchpad[%#x] = %#x, want %#x", i, g, w)
+				break
+			}
+		}
+	}
+}
+
+// Test that compiled programs give exactly the interpreter's results
+func TestJITMatchesInterpreter(t *testing.T) {
+	programs := 200
+	if testing.Short() {
+		programs = 20
+	}
+
+	c, err := newJITCompiler()
+	if err != nil {
+		t.Fatalf("newJITCompiler() error = %v", err)
+	}
+	defer c.release()
+
+	rng := rand.New(rand.NewSource(1))
+	interp := &virtualMachine{mem: make([]byte, scratchpadL3Size)}
+	jit := &virtualMachine{mem: make([]byte, scratchpadL3Size)}
+	seen := make(map[instructionType]bool)
+	taken := 0
+
+	for n := 0; n < programs; n++ {
+		p, types := randomProgram(rng)
+		for typ := range types {
+			seen[typ] = true
+		}
+		if err := c.compile(p); err != nil {
+			t.Fatalf("compile() error = %v", err)
+		}
+
+		randomVMState(rng, interp)
+		jit.reg, jit.regF, jit.regE, jit.regA = interp.reg, interp.regF, interp.regE, interp.regA
+		jit.fprc, jit.config = interp.fprc, interp.config
+		copy(jit.mem, interp.mem)
+
+		// Run each program a few times so results feed back into
+		// addresses and operands.
+		for i := 0; i < 4; i++ {
+			taken += p.execute(interp)
+			c.run(jit)
+		}
+
+		compareVMs(t, jit, interp)
+		if t.Failed() {
+			t.Fatalf("program %d differs", n)
+		}
+	}
+
+	// The compiled backward jumps must have been exercised too.
+	if taken == 0 {
+		t.Error("no branches taken")
+	}
+
+	// Opcodes that fall through to NOP make up the rest of the table, so
+	// every type getInstructionType can return should have run.
+	for typ := instrIADD_RS; typ <= instrNOP; typ++ {
+		reachable := false
+		for op := 0; op < 256; op++ {
+			if getInstructionType(uint8(op)) == typ {
+				reachable = true
+				break
+			}
+		}
+		if reachable && !seen[typ] {
+			t.Errorf("instruction type %d never compiled", typ)
+		}
+	}
+}
+
+// Test each instruction type on its own, with registers chosen so that
+// dst == src cases are covered
+func TestJITSingleInstructions(t *testing.T) {
+	c, err := newJITCompiler()
+	if err != nil {
+		t.Fatalf("newJITCompiler() error = %v", err)
+	}
+	defer c.release()
+
+	rng := rand.New(rand.NewSource(2))
+	interp := &virtualMachine{mem: make([]byte, scratchpadL3Size)}
+	jit := &virtualMachine{mem: make([]byte, scratchpadL3Size)}
+	randomVMState(rng, interp)
+	jit.regA, jit.config = interp.regA, interp.config
+	copy(jit.mem, interp.mem)
+
+	for op := 0; op < 256; op++ {
+		for _, regs := range [][2]uint8{{0, 0}, {3, 5}, {7, 6}, {5, 1}} {
+			instr := instruction{
+				opcode: uint8(op),
+				dst:    regs[0],
+				src:    regs[1],
+				mod:    uint8(rng.Intn(256)),
+				imm:    rng.Uint32(),
+			}
+			p := &program{}
+			for i := range p.instructions {
+				p.instructions[i] = instr
+			}
+			p.setBranchTargets()
+			if err := c.compile(p); err != nil {
+				t.Fatalf("compile() error = %v", err)
+			}
+
+			// The scratchpads stay equal as long as the test passes,
+			// so only the registers are randomized again.
+			for i := range interp.reg {
+				interp.reg[i] = rng.Uint64()
+			}
+			jit.reg, jit.regF, jit.regE = interp.reg, interp.regF, interp.regE
+			jit.fprc = interp.fprc
+
+			p.execute(interp)
+			c.run(jit)
+
+			compareVMs(t, jit, interp)
+			if t.Failed() {
+				t.Fatalf("opcode %d (type %d) %+v differs", op, getInstructionType(instr.opcode), instr)
+			}
+		}
+	}
+}
+
+// Test that the compiled code rounds in the VM's mode and leaves the
+// caller's rounding mode alone
+func TestJITRoundingMode(t *testing.T) {
+	c, err := newJITCompiler()
+	if err != nil {
+		t.Fatalf("newJITCompiler() error = %v", err)
+	}
+	defer c.release()
+
+	p := nopProgram(t, map[int]instruction{
+		0: {opcode: opcodeOf(t, instrCFROUND), src: 0},
+		1: {opcode: opcodeOf(t, instrFMUL_R), dst: 0, src: 0},
+	})
+	if err := c.compile(p); err != nil {
+		t.Fatalf("compile() error = %v", err)
+	}
+
+	vm := &virtualMachine{mem: make([]byte, scratchpadL3Size)}
+	vm.reg[0] = uint64(roundUp)
+	vm.fprc = roundZero
+	vm.regE[0][1] = math.Float64frombits(0x3FF0000000000001)
+	vm.regA[0][1] = vm.regE[0][1]
+	vm.regE[2][0], vm.regE[3][0] = 1, 0x1p-53
+	c.run(vm)
+
+	if got, want := math.Float64bits(vm.regE[0][1]), uint64(0x3FF0000000000003); got != want {
+		t.Errorf("e0 high half = %#x, want %#x", got, want)
+	}
+	if vm.fprc != roundUp {
+		t.Errorf("fprc = %d, want %d", vm.fprc, roundUp)
+	}
+
+	// 1 + 2^-53 is a tie that rounds to 1 only when rounding to nearest.
+	if sum := vm.regE[2][0] + vm.regE[3][0]; sum != 1 {
+		t.Errorf("1 + 2^-53 after run = %v, want 1", sum)
+	}
+}
+
+// Test that secure mode leaves the code executable but not writable
+func TestJITSecure(t *testing.T) {
+	c, err := newJITCompiler()
+	if err != nil {
+		t.Fatalf("newJITCompiler() error = %v", err)
+	}
+	defer c.release()
+
+	p, _ := randomProgram(rand.New(rand.NewSource(3)))
+	for _, secure := range []bool{true, false, true} {
+		c.secure = secure
+		if err := c.compile(p); err != nil {
+			t.Fatalf("compile() with secure = %v error = %v", secure, err)
+		}
+
+		want := unix.PROT_READ | unix.PROT_EXEC
+		if !secure {
+			want |= unix.PROT_WRITE
+		}
+		if c.prot != want {
+			t.Errorf("protection with secure = %v is %#x, want %#x", secure, c.prot, want)
+		}
+	}
+}
+
+// Test that FlagJIT and FlagSecure do not change the hashes, and that
+// closing the hasher releases the compiled code
+func TestHasherJIT(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping hasher initialization test in short mode")
+	}
+
+	key := []byte("jit test")
+	inputs := [][]byte{[]byte("jit input"), []byte(""), bytes.Repeat([]byte{0xAB}, 200)}
+
+	plain, err := New(Config{Mode: LightMode, CacheKey: key})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer plain.Close()
+
+	for _, flags := range []Flags{FlagJIT, FlagJIT | FlagSecure, FlagJIT | FlagLargePages} {
+		hasher, err := New(Config{Mode: LightMode, Flags: flags, CacheKey: key})
+		if err != nil {
+			t.Fatalf("New(%v) error = %v", flags, err)
+		}
+		for _, input := range inputs {
+			if got, want := hasher.Hash(input), plain.Hash(input); got != want {
+				t.Errorf("Hash(%q) with %v = %x, want %x", input, flags, got, want)
+			}
+		}
+
+		// Closing the hasher unmaps the compiled code of its VMs
+		var vms []*virtualMachine
+		for _, pad := range hasher.vms.pads {
+			vms = append(vms, pad.vm)
+		}
+		hasher.Close()
+		for i, vm := range vms {
+			if vm.jit != nil {
+				t.Errorf("VM %d with %v still has compiled code after Close", i, flags)
+			}
+		}
+	}
+}
+
+func benchmarkProgram(b *testing.B, useJIT bool) {
+	rng := rand.New(rand.NewSource(1))
+	vm := &virtualMachine{mem: make([]byte, scratchpadL3Size)}
+	randomVMState(rng, vm)
+	p, _ := randomProgram(rng)
+
+	c, err := newJITCompiler()
+	if err != nil {
+		b.Fatalf("newJITCompiler() error = %v", err)
+	}
+	defer c.release()
+	if err := c.compile(p); err != nil {
+		b.Fatalf("compile() error = %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if useJIT {
+			c.run(vm)
+		} else {
+			p.execute(vm)
+		}
+	}
+}
+
+func BenchmarkProgramInterpreter(b *testing.B) {
+	benchmarkProgram(b, false)
+}
+
+func BenchmarkProgramJIT(b *testing.B) {
+	benchmarkProgram(b, true)
+}
@@ -0,0 +1,50 @@
+//go:build !amd64 || !unix
+
+package randomx
+
+import "errors"
+
+// jitSupported reports whether this build can compile programs to native
+// code.
+const jitSupported = false
+
+// jitCompiler is not available on this platform; VMs always interpret.
+type jitCompiler struct {
+	secure bool
+}
+
+// errNoJIT is returned by newJITCompiler on platforms without a JIT
+// compiler.
+var errNoJIT = errors.New("randomx: JIT compiler not supported on this platform")
+
+func newJITCompiler() (*jitCompiler, error) {
+	return nil, errNoJIT
+}
+
+func (c *jitCompiler) release() error {
+	return nil
+}
+
+func (c *jitCompiler) compile(p *program) error {
+	return errNoJIT
+}
+
+func (c *jitCompiler) run(vm *virtualMachine) {
+	panic("randomx: JIT compiler not supported on this platform")
+}
+
+// superscalarCode is not available on this platform; dataset items are
+// always computed by the interpreter.
+type superscalarCode struct{}
+
+func compileSuperscalar(programs []*superscalarProgram, reciprocals []uint64) (*superscalarCode, error) {
+	return nil, errNoJIT
+}
+
+func (s *superscalarCode) release() error {
+	return nil
+}
+
+func (s *superscalarCode) run(data []byte, start uint64, dst []byte) {
+	panic("randomx: JIT compiler not supported on this platform")
+}
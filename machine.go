@@ -0,0 +1,167 @@
+package randomx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/opd-ai/go-randomx/internal"
+)
+
+// VM computes RandomX hashes from a shared Cache or Dataset, like the VM
+// returned by randomx_create_vm in the reference implementation.
+//
+// A VM in fast mode reads a Dataset; a VM in light mode computes dataset
+// items from a Cache on the fly. The VM holds a reference to whichever it
+// uses, so the caller may release its own references once the VMs are
+// created. Close the VM to drop its references.
+//
+// A VM is not safe for concurrent use; create one VM per goroutine. Use
+// Hasher for a concurrency-safe wrapper that owns its cache and dataset.
+type VM struct {
+	vm    *virtualMachine
+	cache *Cache
+	ds    *Dataset
+	free  func() error // Unmaps a large page scratchpad, if the VM is not pooled
+
+	pooled bool // vm came from the shared VM pool
+}
+
+// errNoCacheOrDataset is returned when a VM would have neither a cache
+// nor a dataset to read from.
+var errNoCacheOrDataset = errors.New("randomx: VM needs a cache or a dataset")
+
+// NewVM creates a VM that hashes with ds in fast mode, or with c in light
+// mode if ds is nil. One of c and ds must be non-nil; passing both lets
+// the VM later switch between them with SetDataset, and fails with
+// ErrKeyMismatch if they were built from different keys. NewVM retains
+// the cache and dataset it is given.
+//
+// Of the flags, FlagHardAES, FlagJIT, FlagSecure and FlagLargePages, for
+// the scratchpad, apply as they do for New; NewVM fails with
+// ErrUnsupportedFlags if a flag is not supported on this machine.
+func NewVM(c *Cache, ds *Dataset, flags Flags) (*VM, error) {
+	if c == nil && ds == nil {
+		return nil, errNoCacheOrDataset
+	}
+	if err := checkFlags(flags); err != nil {
+		return nil, err
+	}
+
+	v := &VM{}
+	if err := v.SetCache(c); err != nil {
+		return nil, err
+	}
+	if err := v.SetDataset(ds); err != nil {
+		v.SetCache(nil)
+		return nil, err
+	}
+
+	if flags.largePages() {
+		mem, _, free := allocateAlignedDataset(scratchpadL3Size, true)
+		v.vm = &virtualMachine{mem: mem}
+		v.free = free
+	} else {
+		v.vm = poolGetVM()
+		v.pooled = true
+	}
+	v.vm.applyFlags(flags)
+	return v, nil
+}
+
+// SetCache replaces the VM's cache, as randomx_vm_set_cache does after a
+// key change. The new cache is retained and the old one released. Passing
+// nil drops the cache, which is only valid while the VM has a dataset.
+func (v *VM) SetCache(c *Cache) error {
+	if c != nil {
+		if err := c.Retain(); err != nil {
+			return err
+		}
+	}
+	if v.cache != nil {
+		v.cache.Release()
+	}
+	v.cache = c
+	return nil
+}
+
+// SetDataset replaces the VM's dataset, as randomx_vm_set_dataset does.
+// The new dataset is retained and the old one released. Passing nil
+// switches the VM to light mode using its cache. A dataset from
+// AllocDataset is rejected with ErrIncomplete until all its items have
+// been initialized, and a dataset built from another key than the VM's
+// cache with ErrKeyMismatch; after a key change, set the new cache first.
+func (v *VM) SetDataset(ds *Dataset) error {
+	if ds != nil {
+		if !ds.complete() {
+			return ErrIncomplete
+		}
+		if v.cache != nil && !bytes.Equal(ds.Key(), v.cache.c.key) {
+			return ErrKeyMismatch
+		}
+		if err := ds.Retain(); err != nil {
+			return err
+		}
+	}
+	if v.ds != nil {
+		v.ds.Release()
+	}
+	v.ds = ds
+	return nil
+}
+
+// Hash computes the RandomX hash of input. It returns ErrClosed after
+// Close.
+func (v *VM) Hash(input []byte) ([32]byte, error) {
+	return v.HashContext(context.Background(), input)
+}
+
+// HashContext is like Hash but stops early when ctx is done, returning
+// ctx.Err().
+func (v *VM) HashContext(ctx context.Context, input []byte) ([32]byte, error) {
+	if v.vm == nil {
+		return [32]byte{}, ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return [32]byte{}, err
+	}
+
+	var (
+		ds *dataset
+		c  *cache
+	)
+	if v.ds != nil {
+		ds = v.ds.ds
+	}
+	if v.cache != nil {
+		c = v.cache.c
+	}
+	if ds == nil && c == nil {
+		return [32]byte{}, errNoCacheOrDataset
+	}
+
+	v.vm.init(ds, c)
+	return v.vm.runSeed(ctx, internal.Blake2b512(input))
+}
+
+// Close releases the VM's cache and dataset references, unmaps its
+// compiled code and returns its scratchpad to the pool, or unmaps it if it
+// uses large pages. Closing an already closed VM returns ErrClosed.
+func (v *VM) Close() error {
+	if v.vm == nil {
+		return ErrClosed
+	}
+
+	v.vm.releaseJIT()
+	if v.pooled {
+		poolPutVM(v.vm)
+	} else {
+		releaseDataset(v.vm.mem, v.free)
+		v.vm.mem = nil
+		v.free = nil
+	}
+	v.vm = nil
+	v.SetDataset(nil)
+	v.SetCache(nil)
+	return nil
+}
@@ -0,0 +1,109 @@
+package randomx
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// Test that VMs sharing one cache match a Hasher with the same key
+func TestVMSharedCache(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping cache initialization test in short mode")
+	}
+
+	key := []byte("shared cache test")
+	c, err := NewCache(key, FlagDefault)
+	if err != nil {
+		t.Fatalf("NewCache() error = %v", err)
+	}
+	if !bytes.Equal(c.Key(), key) {
+		t.Errorf("Key() = %q, want %q", c.Key(), key)
+	}
+
+	vm1, err := NewVM(c, nil, FlagDefault)
+	if err != nil {
+		t.Fatalf("NewVM() error = %v", err)
+	}
+	// The second VM uses every flag the machine supports, including a
+	// large page scratchpad
+	vm2, err := NewVM(c, nil, GetFlags()|FlagLargePages|FlagSecure)
+	if err != nil {
+		t.Fatalf("NewVM() error = %v", err)
+	}
+
+	// The VMs hold their own references
+	c.Release()
+
+	hasher, err := New(Config{Mode: LightMode, CacheKey: key})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer hasher.Close()
+
+	input := []byte("shared input")
+	want := hasher.Hash(input)
+	for i, vm := range []*VM{vm1, vm2} {
+		got, err := vm.Hash(input)
+		if err != nil {
+			t.Fatalf("vm%d.Hash() error = %v", i+1, err)
+		}
+		if got != want {
+			t.Errorf("vm%d.Hash() = %x, want %x", i+1, got, want)
+		}
+	}
+
+	vm1.Close()
+	if c.c.data == nil {
+		t.Fatal("cache freed while vm2 still uses it")
+	}
+	if _, err := vm1.Hash(input); !errors.Is(err, ErrClosed) {
+		t.Errorf("Hash() after Close error = %v, want ErrClosed", err)
+	}
+
+	vm2.Close()
+	if c.c.data != nil {
+		t.Error("cache not freed after the last VM was closed")
+	}
+}
+
+// Test that a VM only combines a cache and dataset built from the same
+// key, and rejects unsupported flags
+func TestVMKeyMismatch(t *testing.T) {
+	newCache := func(key string) *Cache {
+		c := &Cache{c: &cache{key: []byte(key)}}
+		c.refs.init()
+		return c
+	}
+	newDataset := func(key string) *Dataset {
+		d := &Dataset{ds: &dataset{data: make([]byte, 64)}, key: []byte(key)}
+		d.refs.init()
+		return d
+	}
+
+	c, ds, other := newCache("key a"), newDataset("key a"), newDataset("key b")
+	if _, err := NewVM(c, other, FlagDefault); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("NewVM() with another key's dataset error = %v, want ErrKeyMismatch", err)
+	}
+
+	vm, err := NewVM(c, ds, FlagDefault)
+	if err != nil {
+		t.Fatalf("NewVM() error = %v", err)
+	}
+	defer vm.Close()
+	if err := vm.SetDataset(other); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("SetDataset() with another key's dataset error = %v, want ErrKeyMismatch", err)
+	}
+
+	// After a key change the new cache goes first.
+	if err := vm.SetCache(newCache("key b")); err != nil {
+		t.Fatalf("SetCache() error = %v", err)
+	}
+	if err := vm.SetDataset(other); err != nil {
+		t.Errorf("SetDataset() after SetCache() error = %v", err)
+	}
+
+	if _, err := NewVM(c, nil, Flags(1<<30)); !errors.Is(err, ErrUnsupportedFlags) {
+		t.Errorf("NewVM() with an unknown flag error = %v, want ErrUnsupportedFlags", err)
+	}
+}
@@ -1,6 +1,7 @@
 package randomx
 
 import (
+	"errors"
 	"sync"
 	"unsafe"
 )
@@ -18,6 +19,9 @@ const (
 	scratchpadL1Mask = (scratchpadL1Size - 1) &^ 7  // 0x3FF8
 	scratchpadL2Mask = (scratchpadL2Size - 1) &^ 7  // 0x3FFF8
 	scratchpadL3Mask = (scratchpadL3Size - 1) &^ 7  // 0x1FFFF8
+
+	// Mask aligning the per-iteration scratchpad addresses to 64 bytes
+	scratchpadL3LineMask = (scratchpadL3Size - 1) &^ (cacheLineSize - 1) // 0x1FFFC0
 )
 
 // Global pools for memory reuse to minimize allocations
@@ -45,6 +49,7 @@ var (
 func poolGetVM() *virtualMachine {
 	vm := vmPool.Get().(*virtualMachine)
 	vm.reset()
+	vm.useJIT = false
 	return vm
 }
 
@@ -71,9 +76,38 @@ func releaseScratchpad(pad []byte) {
 	}
 }
 
-// allocateAlignedDataset allocates a large aligned buffer for dataset storage.
-// The dataset is read-only after initialization, so GC scanning is minimal.
-func allocateAlignedDataset(size int) []byte {
+// errNoHugePages is returned by mapHugeTLB where explicit huge pages are
+// not available.
+var errNoHugePages = errors.New("randomx: huge pages are not available")
+
+// allocateAlignedDataset allocates a large buffer for a cache or dataset.
+// Where the platform supports it the memory is an anonymous mapping
+// outside the Go heap, so hundreds of megabytes of cache and gigabytes of
+// dataset neither inflate the garbage collector's pacing nor linger after
+// release. The returned free function gives the memory back to the
+// operating system; it is nil for the heap fallback, which the garbage
+// collector reclaims. Either way the buffer is zeroed and at least
+// cache-line aligned.
+//
+// With largePages, explicit huge pages (MAP_HUGETLB) are tried first,
+// then transparent huge pages (MADV_HUGEPAGE), then regular pages. The
+// returned PageKind tells which was used.
+func allocateAlignedDataset(size int, largePages bool) (data []byte, pages PageKind, free func() error) {
+	if largePages {
+		if mapping, err := mapHugeTLB(size); err == nil {
+			return mapping[:size], PagesHuge, func() error { return unmapAnonymous(mapping) }
+		}
+	}
+
+	data, err := mapAnonymous(size)
+	if err == nil {
+		pages = PagesRegular
+		if largePages && adviseHugePages(data) {
+			pages = PagesTransparentHuge
+		}
+		return data, pages, func() error { return unmapAnonymous(data) }
+	}
+
 	// Allocate slightly larger to allow alignment
 	buf := make([]byte, size+cacheLineSize)
 
@@ -84,15 +118,16 @@ func allocateAlignedDataset(size int) []byte {
 	}
 
 	// Return aligned slice
-	return buf[offset : offset+size]
+	return buf[offset : offset+size], PagesHeap, nil
 }
 
-// releaseDataset releases a dataset buffer.
-// In Go, we rely on GC, but we can hint that the data is no longer needed.
-func releaseDataset(data []byte) {
-	// Clear reference to help GC
-	// The actual memory will be freed by the garbage collector
-	data = nil
+// releaseDataset releases a buffer from allocateAlignedDataset. Mapped
+// memory is returned to the operating system at once; heap memory is
+// left to the garbage collector. The buffer must not be used afterwards.
+func releaseDataset(data []byte, free func() error) {
+	if free != nil {
+		free()
+	}
 }
 
 // copyBytes copies src to dst efficiently.
@@ -0,0 +1,74 @@
+package randomx
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// residentBytes returns the resident set size of the process.
+func residentBytes(t *testing.T) int64 {
+	t.Helper()
+	statm, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		t.Skipf("cannot read RSS: %v", err)
+	}
+	fields := strings.Fields(string(statm))
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		t.Fatalf("parsing /proc/self/statm: %v", err)
+	}
+	return pages * int64(os.Getpagesize())
+}
+
+// Test that releasing a dataset gives its memory back to the OS at once
+func TestDatasetReleaseDropsRSS(t *testing.T) {
+	const touched = 512 << 20
+
+	d, err := AllocDataset(FlagDefault)
+	if err != nil {
+		t.Fatalf("AllocDataset() error = %v", err)
+	}
+	if d.ds.unmap == nil {
+		t.Fatal("dataset memory is not mapped")
+	}
+	for i := 0; i < touched; i += os.Getpagesize() {
+		d.ds.data[i] = 1
+	}
+
+	before := residentBytes(t)
+	d.Release()
+	after := residentBytes(t)
+
+	t.Logf("RSS %d MB before Release, %d MB after", before>>20, after>>20)
+	if before-after < touched*9/10 {
+		t.Errorf("RSS dropped by %d MB after Release, want about %d MB", (before-after)>>20, touched>>20)
+	}
+}
+
+// Test that closing a hasher gives its cache memory back to the OS
+func TestHasherCloseDropsRSS(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping hasher initialization test in short mode")
+	}
+
+	hasher, err := New(Config{Mode: LightMode, CacheKey: []byte("rss test")})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if hasher.cache.unmap == nil {
+		t.Fatal("cache memory is not mapped")
+	}
+
+	before := residentBytes(t)
+	if err := hasher.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	after := residentBytes(t)
+
+	t.Logf("RSS %d MB before Close, %d MB after", before>>20, after>>20)
+	if before-after < cacheSize*9/10 {
+		t.Errorf("RSS dropped by %d MB after Close, want about %d MB", (before-after)>>20, cacheSize>>20)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package randomx
+
+import "errors"
+
+// errNoMmap is returned by mapAnonymous on platforms without mmap.
+var errNoMmap = errors.New("randomx: anonymous mappings are not supported")
+
+// mapAnonymous always fails on platforms without mmap, so caches and
+// datasets fall back to the Go heap.
+func mapAnonymous(size int) ([]byte, error) {
+	return nil, errNoMmap
+}
+
+// unmapAnonymous is never called on platforms without mmap.
+func unmapAnonymous(data []byte) error {
+	return errNoMmap
+}
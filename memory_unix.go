@@ -0,0 +1,16 @@
+//go:build unix
+
+package randomx
+
+import "golang.org/x/sys/unix"
+
+// mapAnonymous allocates size bytes of zeroed, page-aligned memory with an
+// anonymous private mapping, outside the Go heap.
+func mapAnonymous(size int) ([]byte, error) {
+	return unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANON)
+}
+
+// unmapAnonymous returns memory from mapAnonymous to the operating system.
+func unmapAnonymous(data []byte) error {
+	return unix.Munmap(data)
+}
@@ -0,0 +1,304 @@
+package monero
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/opd-ai/go-randomx"
+)
+
+// SeedHashFunc returns the hash of the block at height on the caller's
+// current best chain. The Scheduler calls it every time it resolves a
+// key, so after a reorg it sees the new chain without being told.
+type SeedHashFunc func(ctx context.Context, height uint64) ([]byte, error)
+
+// Config configures a Scheduler.
+type Config struct {
+	// Mode is the mode of the hashers the Scheduler creates.
+	Mode randomx.Mode
+
+	// Flags is passed through to the hashers the Scheduler creates.
+	Flags randomx.Flags
+
+	// SeedHash looks up seed block hashes. It must not be nil.
+	SeedHash SeedHashFunc
+}
+
+// maxHashers is the number of hashers a Scheduler keeps: one for the
+// current key and one for the next key during the lag window. It also
+// bounds the number of hashers being built at once.
+const maxHashers = 2
+
+// newHasher creates the hashers. Tests replace it to avoid building
+// real caches.
+var newHasher = randomx.NewContext
+
+// ErrClosed is returned by a Scheduler after Close.
+var ErrClosed = errors.New("monero: scheduler is closed")
+
+// Scheduler keeps RandomX hashers for the keys a Monero node needs and
+// picks the right one for each block height.
+//
+// Call SetTip as the chain advances. When the tip enters the lag window,
+// the Scheduler starts building the hasher for the next key in the
+// background, so it is ready when the epoch changes. Hash and KeyFor work
+// for any height: a height whose key has no hasher yet (an old block, or
+// a seed block replaced by a reorg) gets one built on demand, evicting
+// the least recently used hasher. At most maxHashers hashers are built at
+// a time; requests for further keys wait for a build to finish.
+//
+// A Scheduler is safe for concurrent use.
+type Scheduler struct {
+	config Config
+	ctx    context.Context // Cancelled by Close to stop background builds
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	entries []*entry
+	clock   uint64 // Incremented on every use, for LRU eviction
+	closed  bool
+	wg      sync.WaitGroup // Tracks hasher builds and the closing of evicted hashers
+	slots   chan struct{}  // Holds a token for each build in progress
+}
+
+// entry is a hasher for one key, possibly still being built.
+type entry struct {
+	key      []byte
+	ready    chan struct{} // Closed once the build has finished
+	hasher   *randomx.Hasher
+	err      error
+	lastUsed uint64
+}
+
+// NewScheduler returns a Scheduler with no hashers. The first call to
+// SetTip, Hash or KeyFor builds one.
+func NewScheduler(config Config) (*Scheduler, error) {
+	if config.SeedHash == nil {
+		return nil, errors.New("monero: SeedHash must not be nil")
+	}
+	if config.Mode != randomx.LightMode && config.Mode != randomx.FastMode && config.Mode != randomx.AutoMode {
+		return nil, fmt.Errorf("%w: %v", randomx.ErrInvalidMode, config.Mode)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		config: config,
+		ctx:    ctx,
+		cancel: cancel,
+		slots:  make(chan struct{}, maxHashers),
+	}, nil
+}
+
+// KeyFor returns the RandomX key the block at height must be verified
+// with: the hash of the block at SeedHeight(height) on the current chain.
+func (s *Scheduler) KeyFor(ctx context.Context, height uint64) ([]byte, error) {
+	key, err := s.config.SeedHash(ctx, SeedHeight(height))
+	if err != nil {
+		return nil, fmt.Errorf("monero: seed hash at height %d: %w", SeedHeight(height), err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("monero: seed hash at height %d: %w", SeedHeight(height), randomx.ErrEmptyKey)
+	}
+	return key, nil
+}
+
+// SetTip tells the Scheduler the chain has reached height. It makes sure
+// the hasher for height's key is ready, waiting for it to be built if
+// necessary, and in the lag window starts building the hasher for the
+// next key in the background.
+func (s *Scheduler) SetTip(ctx context.Context, height uint64) error {
+	key, err := s.KeyFor(ctx, height)
+	if err != nil {
+		return err
+	}
+	if _, err := s.wait(ctx, s.acquire(key)); err != nil {
+		return err
+	}
+
+	if seed, next := SeedHeights(height); seed != next {
+		nextKey, err := s.KeyFor(ctx, height+EpochLag)
+		if err != nil {
+			return err
+		}
+		// Build in the background; the result is picked up by a later
+		// Hash or SetTip once the epoch changes.
+		s.acquire(nextKey)
+	}
+	return nil
+}
+
+// Hash computes the RandomX hash of blob, the hashing blob of the block at
+// height, with the key for that height.
+func (s *Scheduler) Hash(ctx context.Context, height uint64, blob []byte) ([32]byte, error) {
+	key, err := s.KeyFor(ctx, height)
+	if err != nil {
+		return [32]byte{}, err
+	}
+
+	for {
+		hasher, err := s.wait(ctx, s.acquire(key))
+		if err != nil {
+			return [32]byte{}, err
+		}
+
+		hash, err := hasher.HashContext(ctx, blob)
+		if errors.Is(err, randomx.ErrClosed) {
+			// The hasher was evicted between acquire and HashContext;
+			// acquire builds it again unless the scheduler is closed.
+			continue
+		}
+		return hash, err
+	}
+}
+
+// Close stops any background builds and closes all hashers.
+func (s *Scheduler) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	s.closed = true
+	entries := s.entries
+	s.entries = nil
+	s.mu.Unlock()
+
+	s.cancel()
+	s.wg.Wait()
+
+	for _, e := range entries {
+		if e.hasher != nil {
+			e.hasher.Close()
+		}
+	}
+	return nil
+}
+
+// acquire returns the entry for key, starting a build if there is none.
+// It returns nil once the scheduler is closed.
+func (s *Scheduler) acquire(key []byte) *entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	s.clock++
+	for _, e := range s.entries {
+		if string(e.key) == string(key) {
+			e.lastUsed = s.clock
+			return e
+		}
+	}
+
+	e := &entry{
+		key:      append([]byte(nil), key...),
+		ready:    make(chan struct{}),
+		lastUsed: s.clock,
+	}
+	s.entries = append(s.entries, e)
+	s.evictLocked()
+
+	s.wg.Add(1)
+	go s.build(e)
+	return e
+}
+
+// build creates the hasher for e once fewer than maxHashers builds are
+// running, so a burst of requests for different keys cannot allocate a
+// cache and dataset for each of them at once.
+func (s *Scheduler) build(e *entry) {
+	defer s.wg.Done()
+
+	var (
+		hasher *randomx.Hasher
+		err    error
+	)
+	select {
+	case s.slots <- struct{}{}:
+		hasher, err = newHasher(s.ctx, randomx.Config{
+			Mode:     s.config.Mode,
+			Flags:    s.config.Flags,
+			CacheKey: e.key,
+		})
+		<-s.slots
+	case <-s.ctx.Done():
+		err = s.ctx.Err()
+	}
+
+	s.mu.Lock()
+	e.hasher, e.err = hasher, err
+	close(e.ready)
+	if err != nil {
+		// Drop the failed entry so the next acquire retries the build.
+		s.removeLocked(e)
+	}
+	// Builds that were running during earlier acquires may have left
+	// more hashers than maxHashers.
+	s.evictLocked()
+	s.mu.Unlock()
+}
+
+// wait blocks until e has been built and returns its hasher.
+func (s *Scheduler) wait(ctx context.Context, e *entry) (*randomx.Hasher, error) {
+	if e == nil {
+		return nil, ErrClosed
+	}
+
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if e.err != nil {
+		return nil, fmt.Errorf("monero: building hasher: %w", e.err)
+	}
+	return e.hasher, nil
+}
+
+// evictLocked closes the least recently used hashers beyond maxHashers.
+// Hashers still being built are never evicted.
+func (s *Scheduler) evictLocked() {
+	for len(s.entries) > maxHashers {
+		var victim *entry
+		for _, e := range s.entries {
+			select {
+			case <-e.ready:
+			default:
+				continue
+			}
+			if victim == nil || e.lastUsed < victim.lastUsed {
+				victim = e
+			}
+		}
+		if victim == nil {
+			return
+		}
+
+		s.removeLocked(victim)
+		if victim.hasher != nil {
+			// Close waits for in-flight hashes; callers that lose the
+			// race get ErrClosed and acquire again. The scheduler's
+			// Close waits for it, so the dataset is freed by then.
+			s.wg.Add(1)
+			go func(h *randomx.Hasher) {
+				defer s.wg.Done()
+				h.Close()
+			}(victim.hasher)
+		}
+	}
+}
+
+// removeLocked removes e from the entry list.
+func (s *Scheduler) removeLocked(e *entry) {
+	for i, x := range s.entries {
+		if x == e {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package monero
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opd-ai/go-randomx"
+)
+
+// chain is a fake blockchain whose block hashes can be replaced to
+// simulate a reorg.
+type chain struct {
+	mu     sync.Mutex
+	hashes map[uint64]string
+}
+
+func (c *chain) seedHash(ctx context.Context, height uint64) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.hashes[height]
+	if !ok {
+		return nil, fmt.Errorf("no block at height %d", height)
+	}
+	return []byte(h), nil
+}
+
+func (c *chain) set(height uint64, hash string) {
+	c.mu.Lock()
+	c.hashes[height] = hash
+	c.mu.Unlock()
+}
+
+// referenceHash hashes blob with a fresh hasher for key.
+func referenceHash(t *testing.T, key string, blob []byte) [32]byte {
+	t.Helper()
+	hasher, err := randomx.New(randomx.Config{Mode: randomx.LightMode, CacheKey: []byte(key)})
+	if err != nil {
+		t.Fatalf("randomx.New() error = %v", err)
+	}
+	defer hasher.Close()
+	return hasher.Hash(blob)
+}
+
+// Test NewScheduler argument validation
+func TestNewSchedulerConfig(t *testing.T) {
+	if _, err := NewScheduler(Config{Mode: randomx.LightMode}); err == nil {
+		t.Error("NewScheduler() without SeedHash should fail")
+	}
+	c := &chain{hashes: map[uint64]string{}}
+	if _, err := NewScheduler(Config{Mode: randomx.Mode(9), SeedHash: c.seedHash}); !errors.Is(err, randomx.ErrInvalidMode) {
+		t.Errorf("NewScheduler() with bad mode error = %v, want ErrInvalidMode", err)
+	}
+}
+
+// Test key selection and hashing across an epoch boundary and a reorg
+func TestScheduler(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping hasher initialization test in short mode")
+	}
+
+	// Record every hasher, to check that Close has closed them all,
+	// evicted ones included, by the time it returns.
+	var (
+		builtMu sync.Mutex
+		built   []*randomx.Hasher
+	)
+	newHasher = func(ctx context.Context, config randomx.Config) (*randomx.Hasher, error) {
+		h, err := randomx.NewContext(ctx, config)
+		if err == nil {
+			builtMu.Lock()
+			built = append(built, h)
+			builtMu.Unlock()
+		}
+		return h, err
+	}
+	defer func() { newHasher = randomx.NewContext }()
+
+	c := &chain{hashes: map[uint64]string{
+		0:    "genesis",
+		2048: "seed 2048",
+	}}
+	s, err := NewScheduler(Config{Mode: randomx.LightMode, SeedHash: c.seedHash})
+	if err != nil {
+		t.Fatalf("NewScheduler() error = %v", err)
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	blob := []byte("block blob")
+
+	// In the lag window the old key is still used, and the next one is
+	// prepared in the background.
+	if err := s.SetTip(ctx, 2100); err != nil {
+		t.Fatalf("SetTip() error = %v", err)
+	}
+	if key, _ := s.KeyFor(ctx, 2112); string(key) != "genesis" {
+		t.Errorf("KeyFor(2112) = %q, want genesis", key)
+	}
+	s.mu.Lock()
+	n := len(s.entries)
+	s.mu.Unlock()
+	if n != 2 {
+		t.Errorf("scheduler has %d hashers in the lag window, want 2", n)
+	}
+
+	got, err := s.Hash(ctx, 2112, blob)
+	if err != nil {
+		t.Fatalf("Hash(2112) error = %v", err)
+	}
+	if want := referenceHash(t, "genesis", blob); got != want {
+		t.Errorf("Hash(2112) = %x, want %x", got, want)
+	}
+
+	// After the boundary the new seed is used
+	if key, _ := s.KeyFor(ctx, 2113); string(key) != "seed 2048" {
+		t.Errorf("KeyFor(2113) = %q, want seed 2048", key)
+	}
+	got, err = s.Hash(ctx, 2113, blob)
+	if err != nil {
+		t.Fatalf("Hash(2113) error = %v", err)
+	}
+	want2048 := referenceHash(t, "seed 2048", blob)
+	if got != want2048 {
+		t.Errorf("Hash(2113) = %x, want %x", got, want2048)
+	}
+
+	// A reorg replaces the seed block; the new key is picked up at once
+	c.set(2048, "reorged seed 2048")
+	got, err = s.Hash(ctx, 2113, blob)
+	if err != nil {
+		t.Fatalf("Hash(2113) after reorg error = %v", err)
+	}
+	if got == want2048 {
+		t.Error("Hash(2113) after reorg still uses the old seed")
+	}
+	if want := referenceHash(t, "reorged seed 2048", blob); got != want {
+		t.Errorf("Hash(2113) after reorg = %x, want %x", got, want)
+	}
+
+	s.mu.Lock()
+	n = len(s.entries)
+	s.mu.Unlock()
+	if n > maxHashers {
+		t.Errorf("scheduler keeps %d hashers, want at most %d", n, maxHashers)
+	}
+
+	if _, err := s.Hash(ctx, 5000, blob); err == nil {
+		t.Error("Hash() with a missing seed block should fail")
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := s.Hash(ctx, 2113, blob); !errors.Is(err, ErrClosed) {
+		t.Errorf("Hash() after Close error = %v, want ErrClosed", err)
+	}
+	for i, h := range built {
+		if _, err := h.HashE(blob); !errors.Is(err, randomx.ErrClosed) {
+			t.Errorf("hasher %d not closed after Close: HashE() error = %v", i, err)
+		}
+	}
+}
+
+// Test that a burst of requests for different keys builds at most
+// maxHashers hashers at a time
+func TestSchedulerLimitsBuilds(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		running int
+		peak    int
+		calls   int
+	)
+	release := make(chan struct{})
+	errFake := errors.New("fake build")
+	newHasher = func(ctx context.Context, config randomx.Config) (*randomx.Hasher, error) {
+		mu.Lock()
+		calls++
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+
+		<-release
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil, errFake
+	}
+	defer func() { newHasher = randomx.NewContext }()
+
+	c := &chain{hashes: map[uint64]string{}}
+	for i := uint64(0); i < 6; i++ {
+		c.set(i*EpochBlocks, fmt.Sprintf("seed %d", i))
+	}
+	s, err := NewScheduler(Config{Mode: randomx.FastMode, SeedHash: c.seedHash})
+	if err != nil {
+		t.Fatalf("NewScheduler() error = %v", err)
+	}
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	for i := uint64(1); i <= 5; i++ {
+		wg.Add(1)
+		go func(height uint64) {
+			defer wg.Done()
+			if _, err := s.Hash(context.Background(), height, []byte("blob")); !errors.Is(err, errFake) {
+				t.Errorf("Hash(%d) error = %v, want the build error", height, err)
+			}
+		}(i*EpochBlocks + EpochLag + 1)
+	}
+
+	// Let the builds finish one at a time once all requests are queued
+	for {
+		mu.Lock()
+		n := calls
+		mu.Unlock()
+		if n == 5 {
+			break
+		}
+		select {
+		case release <- struct{}{}:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	if peak > maxHashers {
+		t.Errorf("%d hashers were built at once, want at most %d", peak, maxHashers)
+	}
+}
@@ -0,0 +1,50 @@
+// Package monero implements Monero's RandomX key schedule on top of
+// go-randomx.
+//
+// Monero changes the RandomX cache key every EpochBlocks blocks. The key
+// for a block is the hash of an earlier "seed" block, and a new seed only
+// takes effect EpochLag blocks after it is mined, so every node has time
+// to build the new dataset before it is needed. This package maps block
+// heights to seed heights and provides a Scheduler that keeps hashers for
+// the current and upcoming keys.
+package monero
+
+const (
+	// EpochBlocks is the number of blocks between seed heights
+	// (SEEDHASH_EPOCH_BLOCKS in Monero).
+	EpochBlocks = 2048
+
+	// EpochLag is the number of blocks a new seed waits before it is used
+	// (SEEDHASH_EPOCH_LAG in Monero).
+	EpochLag = 64
+)
+
+// SeedHeight returns the height of the block whose hash is the RandomX key
+// for the block at height, following Monero's rx_seedheight.
+//
+// Blocks up to EpochBlocks+EpochLag use the genesis block as their seed.
+// After that, the seed is the most recent multiple of EpochBlocks that is
+// more than EpochLag blocks below height.
+func SeedHeight(height uint64) uint64 {
+	if height <= EpochBlocks+EpochLag {
+		return 0
+	}
+	return (height - EpochLag - 1) &^ (EpochBlocks - 1)
+}
+
+// SeedHeights returns the seed height for the block at height and the
+// seed height that will be in effect EpochLag blocks later, following
+// Monero's rx_seedheights. The two differ exactly when height is in the
+// lag window.
+func SeedHeights(height uint64) (seed, next uint64) {
+	return SeedHeight(height), SeedHeight(height + EpochLag)
+}
+
+// InLagWindow reports whether the block at height lies in the lag window:
+// the EpochLag blocks after a new seed block has been mined but before its
+// hash becomes the key. During the window blocks are still verified with
+// the old key, and the dataset for the new key should be prepared.
+func InLagWindow(height uint64) bool {
+	seed, next := SeedHeights(height)
+	return seed != next
+}
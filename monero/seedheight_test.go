@@ -0,0 +1,38 @@
+package monero
+
+import "testing"
+
+// Test the seed height rule around epoch boundaries
+func TestSeedHeight(t *testing.T) {
+	tests := []struct {
+		height uint64
+		seed   uint64
+		next   uint64
+		lag    bool
+	}{
+		{0, 0, 0, false},
+		{1, 0, 0, false},
+		{2048, 0, 0, false},
+		{2049, 0, 2048, true},
+		{2112, 0, 2048, true},
+		{2113, 2048, 2048, false},
+		{4096, 2048, 2048, false},
+		{4097, 2048, 4096, true},
+		{4160, 2048, 4096, true},
+		{4161, 4096, 4096, false},
+		{3000000, 2998272, 2998272, false},
+	}
+
+	for _, tt := range tests {
+		seed, next := SeedHeights(tt.height)
+		if seed != tt.seed || next != tt.next {
+			t.Errorf("SeedHeights(%d) = %d, %d, want %d, %d", tt.height, seed, next, tt.seed, tt.next)
+		}
+		if got := SeedHeight(tt.height); got != tt.seed {
+			t.Errorf("SeedHeight(%d) = %d, want %d", tt.height, got, tt.seed)
+		}
+		if got := InLagWindow(tt.height); got != tt.lag {
+			t.Errorf("InLagWindow(%d) = %v, want %v", tt.height, got, tt.lag)
+		}
+	}
+}
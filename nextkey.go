@@ -0,0 +1,224 @@
+package randomx
+
+import (
+	"context"
+	"fmt"
+)
+
+// KeyEventKind identifies what happened in a KeyEvent.
+type KeyEventKind int
+
+const (
+	// KeyPrepared means the cache and dataset for a key passed to
+	// PrepareNextKey have been built and can be swapped in.
+	KeyPrepared KeyEventKind = iota
+
+	// KeyPrepareFailed means building the cache or dataset for a key
+	// passed to PrepareNextKey failed. KeyEvent.Err holds the error.
+	KeyPrepareFailed
+
+	// KeySwapped means the hasher has switched to a new key. Hashes
+	// started after the event use the new key.
+	KeySwapped
+)
+
+// String returns the string representation of the event kind.
+func (k KeyEventKind) String() string {
+	switch k {
+	case KeyPrepared:
+		return "KeyPrepared"
+	case KeyPrepareFailed:
+		return "KeyPrepareFailed"
+	case KeySwapped:
+		return "KeySwapped"
+	default:
+		return fmt.Sprintf("KeyEventKind(%d)", k)
+	}
+}
+
+// KeyEvent reports a change in the keys of a Hasher. It is delivered to
+// Config.KeyEvents.
+type KeyEvent struct {
+	// Kind is what happened.
+	Kind KeyEventKind
+
+	// Key is the cache key the event is about. It must not be modified.
+	Key []byte
+
+	// Err is the build error for KeyPrepareFailed, and nil otherwise.
+	Err error
+}
+
+// nextKey is a cache and dataset being built in the background by
+// PrepareNextKey.
+type nextKey struct {
+	key    []byte
+	cancel context.CancelFunc
+	done   chan struct{} // Closed once the build has finished
+	cache  *cache
+	ds     *dataset
+	err    error
+}
+
+// PrepareNextKey starts building the cache, and in fast mode the
+// dataset, for key in the background and returns immediately. Hashing
+// continues with the current key meanwhile. Once the build is done, the
+// hasher switches to key when SwapNextKey or UpdateCacheKey(key) is
+// called, or at once if Config.AutoSwap is set.
+//
+// Only one key is prepared at a time: preparing a different key abandons
+// the previous build. Preparing the key that is already being prepared,
+// or the current key, does nothing.
+func (h *Hasher) PrepareNextKey(key []byte) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+
+	h.mu.RLock()
+	closed, same := h.closed, bytesEqual(h.config.CacheKey, key)
+	h.mu.RUnlock()
+
+	if closed {
+		return ErrClosed
+	}
+	if same {
+		return nil
+	}
+
+	h.nextMu.Lock()
+	defer h.nextMu.Unlock()
+
+	if h.next != nil {
+		if bytesEqual(h.next.key, key) {
+			return nil
+		}
+		go h.discard(h.next)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	next := &nextKey{
+		key:    append([]byte(nil), key...),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	h.next = next
+
+	go h.prepare(ctx, next)
+	return nil
+}
+
+// prepare builds next and, with Config.AutoSwap, swaps it in.
+func (h *Hasher) prepare(ctx context.Context, next *nextKey) {
+	newCache, newDS, err := h.build(ctx, next.key)
+
+	h.nextMu.Lock()
+	if h.next != next {
+		// Abandoned by PrepareNextKey, UpdateCacheKey or Close
+		h.nextMu.Unlock()
+		if err == nil {
+			if newDS != nil {
+				newDS.release()
+			}
+			newCache.release()
+		}
+		next.cancel()
+		close(next.done)
+		return
+	}
+
+	// The results now belong to whoever takes next out of h.next
+	next.cache, next.ds, next.err = newCache, newDS, err
+	if err != nil {
+		h.next = nil
+	}
+	h.nextMu.Unlock()
+	next.cancel()
+	close(next.done)
+
+	if err != nil {
+		h.emit(KeyEvent{Kind: KeyPrepareFailed, Key: next.key, Err: err})
+		return
+	}
+	h.emit(KeyEvent{Kind: KeyPrepared, Key: next.key})
+
+	if h.config.AutoSwap {
+		// This fails harmlessly if next has been replaced by another
+		// key or by UpdateCacheKey, or the hasher has been closed.
+		h.SwapNextKey(context.Background())
+	}
+}
+
+// discard stops the build of a next key that has been taken out of
+// h.next and releases whatever it built.
+func (h *Hasher) discard(next *nextKey) {
+	next.cancel()
+	<-next.done
+
+	// A build abandoned before it finished has released its results
+	// itself; one that finished while still pending left them in next.
+	if next.ds != nil {
+		next.ds.release()
+	}
+	if next.cache != nil {
+		next.cache.release()
+	}
+}
+
+// SwapNextKey switches the hasher to the key passed to PrepareNextKey,
+// waiting for its build to finish if necessary. In-flight hashes finish
+// with the old key; the swap itself only blocks hashing briefly.
+//
+// It returns ErrNoPendingKey if no key is being prepared, the build error
+// if the build failed, and ctx.Err() if ctx is done first, in which case
+// the build continues in the background.
+func (h *Hasher) SwapNextKey(ctx context.Context) error {
+	h.nextMu.Lock()
+	next := h.next
+	h.nextMu.Unlock()
+
+	if next == nil {
+		return ErrNoPendingKey
+	}
+
+	select {
+	case <-next.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if next.err != nil {
+		return next.err
+	}
+
+	// Take ownership of the prepared resources, unless another caller,
+	// PrepareNextKey, UpdateCacheKey or Close got there first. Holding
+	// swapMu orders this swap against UpdateCacheKey's.
+	h.swapMu.Lock()
+	defer h.swapMu.Unlock()
+
+	h.nextMu.Lock()
+	if h.next != next {
+		h.nextMu.Unlock()
+		h.mu.RLock()
+		closed := h.closed
+		h.mu.RUnlock()
+		if closed {
+			return ErrClosed
+		}
+		return ErrNoPendingKey
+	}
+	h.next = nil
+	h.nextMu.Unlock()
+
+	return h.swap(next.key, next.cache, next.ds)
+}
+
+// emit delivers ev to Config.KeyEvents, one event at a time.
+func (h *Hasher) emit(ev KeyEvent) {
+	if h.config.KeyEvents == nil {
+		return
+	}
+	h.eventMu.Lock()
+	defer h.eventMu.Unlock()
+	h.config.KeyEvents(ev)
+}
@@ -0,0 +1,217 @@
+package randomx
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test preparing a key in the background and swapping it in on request
+func TestPrepareNextKey(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping hasher initialization test in short mode")
+	}
+
+	events := make(chan KeyEvent, 10)
+	hasher, err := New(Config{
+		Mode:      LightMode,
+		CacheKey:  []byte("old key"),
+		KeyEvents: func(ev KeyEvent) { events <- ev },
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer hasher.Close()
+
+	input := []byte("next key test")
+	start := time.Now()
+	oldHash := hasher.Hash(input)
+	baseline := time.Since(start)
+
+	if err := hasher.SwapNextKey(context.Background()); !errors.Is(err, ErrNoPendingKey) {
+		t.Errorf("SwapNextKey() without a pending key error = %v, want ErrNoPendingKey", err)
+	}
+	if err := hasher.PrepareNextKey(nil); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("PrepareNextKey(nil) error = %v, want ErrEmptyKey", err)
+	}
+
+	if err := hasher.PrepareNextKey([]byte("new key")); err != nil {
+		t.Fatalf("PrepareNextKey() error = %v", err)
+	}
+
+	// Hashing is not blocked by the build and still uses the old key. The
+	// hash shares the CPU with the build, so on a single core, and more so
+	// under the race detector, it may take a few times its usual time; it
+	// must not take anywhere near as long as the build.
+	start = time.Now()
+	if got := hasher.Hash(input); got != oldHash {
+		t.Errorf("Hash() while preparing = %x, want old key hash %x", got, oldHash)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second && elapsed > 4*baseline {
+		t.Errorf("Hash() while preparing took %v (%v before), want it not to wait for the build", elapsed, baseline)
+	}
+
+	ev := <-events
+	if ev.Kind != KeyPrepared || string(ev.Key) != "new key" || ev.Err != nil {
+		t.Fatalf("first event = %v %q %v, want KeyPrepared", ev.Kind, ev.Key, ev.Err)
+	}
+	if got := hasher.Hash(input); got != oldHash {
+		t.Errorf("Hash() before swap = %x, want old key hash %x", got, oldHash)
+	}
+
+	if err := hasher.SwapNextKey(context.Background()); err != nil {
+		t.Fatalf("SwapNextKey() error = %v", err)
+	}
+	ev = <-events
+	if ev.Kind != KeySwapped || string(ev.Key) != "new key" {
+		t.Errorf("second event = %v %q, want KeySwapped", ev.Kind, ev.Key)
+	}
+
+	reference, err := New(Config{Mode: LightMode, CacheKey: []byte("new key")})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer reference.Close()
+	if got, want := hasher.Hash(input), reference.Hash(input); got != want {
+		t.Errorf("Hash() after swap = %x, want %x", got, want)
+	}
+
+	// Preparing the current key is a no-op
+	if err := hasher.PrepareNextKey([]byte("new key")); err != nil {
+		t.Fatalf("PrepareNextKey(current key) error = %v", err)
+	}
+	if err := hasher.SwapNextKey(context.Background()); !errors.Is(err, ErrNoPendingKey) {
+		t.Errorf("SwapNextKey() after preparing the current key error = %v, want ErrNoPendingKey", err)
+	}
+}
+
+// Test that AutoSwap switches keys once the build is done, and that Close
+// abandons a build in progress
+func TestPrepareNextKeyAutoSwap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping hasher initialization test in short mode")
+	}
+
+	swapped := make(chan KeyEvent, 10)
+	hasher, err := New(Config{
+		Mode:     LightMode,
+		CacheKey: []byte("old key"),
+		AutoSwap: true,
+		KeyEvents: func(ev KeyEvent) {
+			if ev.Kind == KeySwapped {
+				swapped <- ev
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := hasher.PrepareNextKey([]byte("auto key")); err != nil {
+		t.Fatalf("PrepareNextKey() error = %v", err)
+	}
+	if ev := <-swapped; string(ev.Key) != "auto key" {
+		t.Errorf("KeySwapped key = %q, want auto key", ev.Key)
+	}
+
+	// UpdateCacheKey also reports the swap
+	input := []byte("auto swap test")
+	autoHash := hasher.Hash(input)
+	if err := hasher.UpdateCacheKey([]byte("old key")); err != nil {
+		t.Fatalf("UpdateCacheKey() error = %v", err)
+	}
+	if ev := <-swapped; string(ev.Key) != "old key" {
+		t.Errorf("KeySwapped key = %q, want old key", ev.Key)
+	}
+	if hasher.Hash(input) == autoHash {
+		t.Error("Hash() did not change after UpdateCacheKey")
+	}
+
+	if err := hasher.PrepareNextKey([]byte("abandoned key")); err != nil {
+		t.Fatalf("PrepareNextKey() error = %v", err)
+	}
+	if err := hasher.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := hasher.PrepareNextKey([]byte("late key")); !errors.Is(err, ErrClosed) {
+		t.Errorf("PrepareNextKey() after Close error = %v, want ErrClosed", err)
+	}
+	select {
+	case ev := <-swapped:
+		t.Errorf("unexpected KeySwapped for %q after Close", ev.Key)
+	default:
+	}
+}
+
+// Test that UpdateCacheKey to another key drops a key still being
+// prepared, so AutoSwap cannot switch back to it, and that the two
+// concurrent builds never call Progress concurrently
+func TestUpdateCacheKeyDropsPreparedKey(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping hasher initialization test in short mode")
+	}
+
+	var active, overlaps atomic.Int32
+	hasher, err := New(Config{
+		Mode:     LightMode,
+		CacheKey: []byte("old key"),
+		AutoSwap: true,
+		Progress: func(Progress) {
+			if active.Add(1) > 1 {
+				overlaps.Add(1)
+			}
+			runtime.Gosched()
+			active.Add(-1)
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer hasher.Close()
+
+	if err := hasher.PrepareNextKey([]byte("stale key")); err != nil {
+		t.Fatalf("PrepareNextKey() error = %v", err)
+	}
+	hasher.nextMu.Lock()
+	stale := hasher.next
+	hasher.nextMu.Unlock()
+
+	if err := hasher.UpdateCacheKey([]byte("new key")); err != nil {
+		t.Fatalf("UpdateCacheKey() error = %v", err)
+	}
+	<-stale.done
+
+	hasher.mu.RLock()
+	key := string(hasher.config.CacheKey)
+	hasher.mu.RUnlock()
+	if key != "new key" {
+		t.Errorf("key after the stale build finished = %q, want new key", key)
+	}
+	if err := hasher.SwapNextKey(context.Background()); !errors.Is(err, ErrNoPendingKey) {
+		t.Errorf("SwapNextKey() after UpdateCacheKey error = %v, want ErrNoPendingKey", err)
+	}
+	if n := overlaps.Load(); n != 0 {
+		t.Errorf("Progress was called concurrently %d times", n)
+	}
+}
+
+// Test event kind names
+func TestKeyEventKindString(t *testing.T) {
+	tests := []struct {
+		kind KeyEventKind
+		want string
+	}{
+		{KeyPrepared, "KeyPrepared"},
+		{KeyPrepareFailed, "KeyPrepareFailed"},
+		{KeySwapped, "KeySwapped"},
+		{KeyEventKind(9), "KeyEventKind(9)"},
+	}
+	for _, tt := range tests {
+		if got := tt.kind.String(); got != tt.want {
+			t.Errorf("KeyEventKind(%d).String() = %q, want %q", tt.kind, got, tt.want)
+		}
+	}
+}
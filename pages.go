@@ -0,0 +1,224 @@
+package randomx
+
+import (
+	"fmt"
+	"sync"
+)
+
+// PageKind describes the kind of memory pages backing an allocation.
+type PageKind int
+
+const (
+	// PagesNone means there is no such allocation, such as the dataset
+	// in light mode.
+	PagesNone PageKind = iota
+
+	// PagesHeap means the memory comes from the Go heap. This is the case
+	// on platforms without anonymous mappings.
+	PagesHeap
+
+	// PagesRegular means the memory is mapped with the operating system's
+	// regular page size.
+	PagesRegular
+
+	// PagesTransparentHuge means the memory is mapped with regular pages
+	// and the kernel has agreed to back it with transparent huge pages
+	// (MADV_HUGEPAGE). It does so on a best-effort basis as huge pages
+	// become available.
+	PagesTransparentHuge
+
+	// PagesHuge means the memory is mapped with explicit huge pages
+	// (MAP_HUGETLB) from the pool reserved through vm.nr_hugepages.
+	PagesHuge
+
+	// PagesFile means the memory is mapped read-only from a dataset
+	// file by LoadDatasetFile.
+	PagesFile
+)
+
+// String returns the string representation of the page kind.
+func (k PageKind) String() string {
+	switch k {
+	case PagesNone:
+		return "None"
+	case PagesHeap:
+		return "Heap"
+	case PagesRegular:
+		return "Regular"
+	case PagesTransparentHuge:
+		return "TransparentHuge"
+	case PagesHuge:
+		return "Huge"
+	case PagesFile:
+		return "File"
+	default:
+		return fmt.Sprintf("PageKind(%d)", k)
+	}
+}
+
+// PageReport lists the kind of pages each allocation of a Hasher got.
+// Cache.Pages and Dataset.Pages report the same for caches and datasets
+// created on their own.
+type PageReport struct {
+	// Cache is the kind of pages backing the cache.
+	Cache PageKind
+
+	// Dataset is the kind of pages backing the dataset, or PagesNone
+	// if the hasher hashes from the cache.
+	Dataset PageKind
+
+	// Scratchpads holds one entry per VM scratchpad the hasher has
+	// allocated with FlagLargePages. Without the flag, scratchpads come
+	// from the Go heap and are not listed.
+	Scratchpads []PageKind
+}
+
+// Pages reports the kind of pages backing the hasher's cache, dataset and
+// scratchpads. With FlagLargePages, use it to check whether huge pages
+// were actually obtained.
+func (h *Hasher) Pages() PageReport {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var r PageReport
+	if h.cache != nil {
+		r.Cache = h.cache.pages
+	}
+	if h.ds != nil {
+		r.Dataset = h.ds.pages
+	}
+	if h.vms != nil {
+		r.Scratchpads = h.vms.pages()
+	}
+	return r
+}
+
+// getVM returns a VM for h, with a large page scratchpad if h uses
+// FlagLargePages, set up to use the hasher's AES implementation and to
+// compile programs if h uses FlagJIT.
+func (h *Hasher) getVM() *virtualMachine {
+	var vm *virtualMachine
+	if h.vms != nil {
+		vm = h.vms.get()
+	} else {
+		vm = poolGetVM()
+	}
+	vm.applyFlags(h.config.Flags)
+	return vm
+}
+
+// putVM returns a VM from getVM.
+func (h *Hasher) putVM(vm *virtualMachine) {
+	if h.vms != nil {
+		h.vms.put(vm)
+		return
+	}
+	poolPutVM(vm)
+}
+
+// hasherVMPool holds the VMs of a hasher with FlagLargePages or FlagJIT.
+// Unlike vmPool it belongs to a single hasher and keeps its VMs until the
+// hasher is closed, so neither the scratchpads nor the compiled code
+// mappings are left to the garbage collector, which knows nothing of
+// mapped memory.
+type hasherVMPool struct {
+	mu         sync.Mutex
+	largePages bool // Map scratchpads with large pages
+	idle       []*virtualMachine
+	pads       []pooledPad // In allocation order, so pages is stable
+	closed     bool
+}
+
+// pooledPad is the scratchpad memory of a VM in a hasherVMPool.
+type pooledPad struct {
+	vm    *virtualMachine
+	pages PageKind
+	free  func() error
+}
+
+func newHasherVMPool(largePages bool) *hasherVMPool {
+	return &hasherVMPool{largePages: largePages}
+}
+
+// get returns an idle VM, or a new one with a fresh scratchpad.
+func (p *hasherVMPool) get() *virtualMachine {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n := len(p.idle); n > 0 {
+		vm := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		vm.reset()
+		return vm
+	}
+
+	var pad pooledPad
+	if p.largePages {
+		pad.vm = &virtualMachine{}
+		pad.vm.mem, pad.pages, pad.free = allocateAlignedDataset(scratchpadL3Size, true)
+	} else {
+		mem := allocateScratchpad()
+		pad = pooledPad{
+			vm:    &virtualMachine{mem: mem},
+			pages: PagesHeap,
+			free:  func() error { releaseScratchpad(mem); return nil },
+		}
+	}
+	p.pads = append(p.pads, pad)
+	return pad.vm
+}
+
+// put makes vm available again. Once the pool is closed, the VM's
+// scratchpad and compiled code are released instead.
+func (p *hasherVMPool) put(vm *virtualMachine) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		p.releaseLocked(vm)
+		return
+	}
+	p.idle = append(p.idle, vm)
+}
+
+// close releases the scratchpads and compiled code of all idle VMs. Those
+// still in use are released when they are put back.
+func (p *hasherVMPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for _, vm := range p.idle {
+		p.releaseLocked(vm)
+	}
+	p.idle = nil
+}
+
+func (p *hasherVMPool) releaseLocked(vm *virtualMachine) {
+	for i, pad := range p.pads {
+		if pad.vm == vm {
+			p.pads = append(p.pads[:i], p.pads[i+1:]...)
+			releaseDataset(vm.mem, pad.free)
+			vm.mem = nil
+			vm.releaseJIT()
+			return
+		}
+	}
+}
+
+// pages returns the page kind of every scratchpad in the pool, in the
+// order the scratchpads were allocated. Scratchpads are only listed when
+// they were mapped with large pages.
+func (p *hasherVMPool) pages() []PageKind {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.largePages {
+		return nil
+	}
+	kinds := make([]PageKind, 0, len(p.pads))
+	for _, pad := range p.pads {
+		kinds = append(kinds, pad.pages)
+	}
+	return kinds
+}
@@ -0,0 +1,133 @@
+package randomx
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// Test page kind string representation
+func TestPageKindString(t *testing.T) {
+	tests := []struct {
+		kind PageKind
+		want string
+	}{
+		{PagesNone, "None"},
+		{PagesHeap, "Heap"},
+		{PagesRegular, "Regular"},
+		{PagesTransparentHuge, "TransparentHuge"},
+		{PagesHuge, "Huge"},
+		{PagesFile, "File"},
+		{PageKind(99), "PageKind(99)"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.kind.String(); got != tt.want {
+			t.Errorf("PageKind.String() = %v, want %v", got, tt.want)
+		}
+	}
+}
+
+// Test that large page allocations fall back to something usable
+func TestAllocateLargePages(t *testing.T) {
+	const size = 2 * scratchpadL3Size
+
+	data, pages, free := allocateAlignedDataset(size, true)
+	t.Logf("large page allocation got %v pages", pages)
+
+	if len(data) != size {
+		t.Fatalf("len(data) = %d, want %d", len(data), size)
+	}
+	if runtime.GOOS == "linux" && pages == PagesHeap {
+		t.Error("large page allocation fell back to the heap on Linux")
+	}
+	if (pages == PagesHeap) != (free == nil) {
+		t.Errorf("pages = %v with free function %v", pages, free != nil)
+	}
+
+	for i := range data {
+		if data[i] != 0 {
+			t.Fatalf("data[%d] = %d, want zeroed memory", i, data[i])
+		}
+		data[i] = byte(i)
+	}
+
+	if free != nil {
+		if err := free(); err != nil {
+			t.Errorf("free() error = %v", err)
+		}
+	}
+}
+
+// Test that FlagLargePages changes where memory comes from, not the hashes
+func TestHasherLargePages(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping hasher initialization test in short mode")
+	}
+
+	key := []byte("large pages test")
+	input := []byte("large pages input")
+
+	plain, err := New(Config{Mode: LightMode, CacheKey: key})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	want := plain.Hash(input)
+	if got := plain.Pages().Scratchpads; got != nil {
+		t.Errorf("Pages().Scratchpads = %v without FlagLargePages, want nil", got)
+	}
+	plain.Close()
+
+	hasher, err := New(Config{Mode: LightMode, Flags: FlagLargePages, CacheKey: key})
+	if err != nil {
+		t.Fatalf("New(FlagLargePages) error = %v", err)
+	}
+
+	if got := hasher.Hash(input); got != want {
+		t.Errorf("Hash() with FlagLargePages = %x, want %x", got, want)
+	}
+
+	pages := hasher.Pages()
+	t.Logf("cache: %v, scratchpads: %v", pages.Cache, pages.Scratchpads)
+	if pages.Cache == PagesNone {
+		t.Error("Pages().Cache = None")
+	}
+	if pages.Dataset != PagesNone {
+		t.Errorf("Pages().Dataset = %v in light mode, want None", pages.Dataset)
+	}
+	if len(pages.Scratchpads) != 1 {
+		t.Errorf("Pages() lists %d scratchpads after one hash, want 1", len(pages.Scratchpads))
+	}
+
+	if err := hasher.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if pages := hasher.Pages(); pages.Cache != PagesNone || len(pages.Scratchpads) != 0 {
+		t.Errorf("Pages() after Close = %+v, want nothing allocated", pages)
+	}
+}
+
+// Test that the scratchpads are listed in allocation order, and stay so
+// as VMs are released
+func TestHasherVMPoolPagesOrder(t *testing.T) {
+	vms := make([]*virtualMachine, 4)
+	kinds := []PageKind{PagesHuge, PagesRegular, PagesTransparentHuge, PagesHeap}
+	p := newHasherVMPool(true)
+	for i := range vms {
+		vms[i] = &virtualMachine{}
+		p.pads = append(p.pads, pooledPad{vm: vms[i], pages: kinds[i]})
+	}
+
+	for n := 0; n < 10; n++ {
+		if got := p.pages(); !reflect.DeepEqual(got, kinds) {
+			t.Fatalf("pages() = %v, want %v", got, kinds)
+		}
+	}
+
+	p.mu.Lock()
+	p.releaseLocked(vms[1])
+	p.mu.Unlock()
+	if got, want := p.pages(), []PageKind{PagesHuge, PagesTransparentHuge, PagesHeap}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pages() after a release = %v, want %v", got, want)
+	}
+}
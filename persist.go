@@ -0,0 +1,335 @@
+package randomx
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/opd-ai/go-randomx/internal"
+)
+
+// Cache and dataset files start with a fixed-size header followed by the
+// raw cache or dataset memory:
+//
+//	offset  size  field
+//	0       8     magic "RXGODATA"
+//	8       4     format version
+//	12      4     kind (1 = cache, 2 = dataset)
+//	16      32    Blake2b-256 of the cache key
+//	48      32    parameter set (see fileParams)
+//	80      32    Blake2b-256 of the payload
+//	112     ...   zero padding up to fileHeaderSize
+//
+// All integers are little-endian. The header is padded to a page so that
+// the payload can be mapped straight from the file.
+const (
+	fileMagic      = "RXGODATA"
+	fileVersion    = 1
+	fileHeaderSize = 4096
+
+	fileKindCache   = 1
+	fileKindDataset = 2
+)
+
+// fileParams is the RandomX parameter set a file was built with. Files
+// built with different parameters hold different data for the same key
+// and are rejected.
+type fileParams struct {
+	ArgonMemory        uint32 // Argon2d memory in KB
+	ArgonIterations    uint32
+	ArgonLanes         uint32
+	SuperscalarLatency uint32
+	CacheAccesses      uint32
+	_                  uint32
+	DataSize           uint64 // Payload size in bytes
+}
+
+// fileHeader is the binary layout of the file header.
+type fileHeader struct {
+	Magic    [8]byte
+	Version  uint32
+	Kind     uint32
+	KeyHash  [32]byte
+	Params   fileParams
+	Checksum [32]byte
+}
+
+// currentFileParams returns the parameter set of this implementation for
+// a payload of the given size.
+func currentFileParams(size int) fileParams {
+	return fileParams{
+		ArgonMemory:        internal.Argon2CacheMemoryKB,
+		ArgonIterations:    internal.Argon2CacheIterations,
+		ArgonLanes:         internal.Argon2CacheLanes,
+		SuperscalarLatency: superscalarLatency,
+		CacheAccesses:      cacheAccesses,
+		DataSize:           uint64(size),
+	}
+}
+
+// fileKindName returns the name of a file kind for error messages.
+func fileKindName(kind uint32) string {
+	switch kind {
+	case fileKindCache:
+		return "cache"
+	case fileKindDataset:
+		return "dataset"
+	default:
+		return fmt.Sprintf("kind %d", kind)
+	}
+}
+
+// writeFile writes a header for key and data followed by data itself.
+func writeFile(w io.Writer, kind uint32, key, data []byte) (int64, error) {
+	hdr := fileHeader{
+		Version:  fileVersion,
+		Kind:     kind,
+		KeyHash:  internal.Blake2b256(key),
+		Params:   currentFileParams(len(data)),
+		Checksum: internal.Blake2b256(data),
+	}
+	copy(hdr.Magic[:], fileMagic)
+
+	var buf bytes.Buffer
+	buf.Grow(fileHeaderSize)
+	if err := binary.Write(&buf, binary.LittleEndian, &hdr); err != nil {
+		return 0, err
+	}
+	buf.Write(make([]byte, fileHeaderSize-buf.Len()))
+
+	n, err := w.Write(buf.Bytes())
+	total := int64(n)
+	if err != nil {
+		return total, err
+	}
+
+	n, err = w.Write(data)
+	total += int64(n)
+	return total, err
+}
+
+// readFileHeader reads and validates a header, checking that the file
+// holds data of the given kind and size built for key. The checksum is
+// returned for the caller to verify once the payload has been read.
+func readFileHeader(r io.Reader, kind uint32, key []byte, size int) ([32]byte, error) {
+	var raw [fileHeaderSize]byte
+	if _, err := io.ReadFull(r, raw[:]); err != nil {
+		return [32]byte{}, fmt.Errorf("%w: reading header: %v", ErrInvalidFile, err)
+	}
+
+	var hdr fileHeader
+	if err := binary.Read(bytes.NewReader(raw[:]), binary.LittleEndian, &hdr); err != nil {
+		return [32]byte{}, fmt.Errorf("%w: decoding header: %v", ErrInvalidFile, err)
+	}
+
+	if string(hdr.Magic[:]) != fileMagic {
+		return [32]byte{}, fmt.Errorf("%w: bad magic %q", ErrInvalidFile, hdr.Magic[:])
+	}
+	if hdr.Version != fileVersion {
+		return [32]byte{}, fmt.Errorf("%w: unsupported format version %d", ErrInvalidFile, hdr.Version)
+	}
+	if hdr.Kind != kind {
+		return [32]byte{}, fmt.Errorf("%w: file holds a %s, want a %s",
+			ErrInvalidFile, fileKindName(hdr.Kind), fileKindName(kind))
+	}
+	if want := currentFileParams(size); hdr.Params != want {
+		return [32]byte{}, fmt.Errorf("%w: built with parameters %+v, want %+v",
+			ErrInvalidFile, hdr.Params, want)
+	}
+	if hdr.KeyHash != internal.Blake2b256(key) {
+		return [32]byte{}, ErrKeyMismatch
+	}
+
+	return hdr.Checksum, nil
+}
+
+// readFile reads a file written by writeFile into memory.
+func readFile(r io.Reader, kind uint32, key []byte, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if err := readFileInto(r, kind, key, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readFileInto reads a file written by writeFile into data, which must
+// have the size of the payload.
+func readFileInto(r io.Reader, kind uint32, key, data []byte) error {
+	checksum, err := readFileHeader(r, kind, key, len(data))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.ReadFull(r, data); err != nil {
+		return fmt.Errorf("%w: reading %s: %v", ErrInvalidFile, fileKindName(kind), err)
+	}
+	return verifyChecksum(data, checksum)
+}
+
+// readDatasetFile reads a dataset file into memory from
+// allocateAlignedDataset.
+func readDatasetFile(r io.Reader, key []byte) (*dataset, error) {
+	ds := newDatasetMemory(false)
+	if err := readFileInto(r, fileKindDataset, key, ds.data); err != nil {
+		ds.release()
+		return nil, err
+	}
+	return ds, nil
+}
+
+// verifyChecksum checks the payload against the checksum in the header.
+func verifyChecksum(data []byte, checksum [32]byte) error {
+	if internal.Blake2b256(data) != checksum {
+		return fmt.Errorf("%w: checksum mismatch", ErrInvalidFile)
+	}
+	return nil
+}
+
+// saveFile writes a file atomically: the data goes to a temporary file in
+// the same directory, which is renamed over path once it is complete.
+func saveFile(path string, write func(io.Writer) (int64, error)) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if _, err = write(f); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// WriteTo writes the cache to w in the versioned cache file format.
+// It implements io.WriterTo.
+func (c *Cache) WriteTo(w io.Writer) (int64, error) {
+	if err := c.Retain(); err != nil {
+		return 0, err
+	}
+	defer c.Release()
+
+	return writeFile(w, fileKindCache, c.c.key, c.c.data)
+}
+
+// SaveFile writes the cache to the named file, replacing it atomically.
+func (c *Cache) SaveFile(path string) error {
+	return saveFile(path, c.WriteTo)
+}
+
+// LoadCache reads a cache written by Cache.WriteTo for key. It returns an
+// error wrapping ErrInvalidFile if the data is malformed, was built with
+// different parameters or fails its checksum, and ErrKeyMismatch if it
+// was built for another key.
+func LoadCache(r io.Reader, key []byte) (*Cache, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	c := &cache{key: append([]byte(nil), key...)}
+	c.data, c.pages, c.unmap = allocateAlignedDataset(cacheSize, false)
+	if err := readFileInto(r, fileKindCache, key, c.data); err != nil {
+		c.release()
+		return nil, err
+	}
+	if err := c.generatePrograms(context.Background(), nil); err != nil {
+		c.release()
+		return nil, err
+	}
+
+	cache := &Cache{c: c}
+	cache.refs.init()
+	return cache, nil
+}
+
+// LoadCacheFile reads a cache saved with Cache.SaveFile. See LoadCache.
+func LoadCacheFile(path string, key []byte) (*Cache, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadCache(f, key)
+}
+
+// WriteTo writes the dataset to w in the versioned dataset file format.
+// It implements io.WriterTo.
+func (d *Dataset) WriteTo(w io.Writer) (int64, error) {
+	if err := d.Retain(); err != nil {
+		return 0, err
+	}
+	defer d.Release()
+
+	key := d.Key()
+	if key == nil {
+		return 0, fmt.Errorf("randomx: dataset has not been initialized: %w", ErrEmptyKey)
+	}
+	if !d.complete() {
+		return 0, ErrIncomplete
+	}
+	return writeFile(w, fileKindDataset, key, d.ds.data)
+}
+
+// SaveFile writes the dataset to the named file, replacing it atomically.
+func (d *Dataset) SaveFile(path string) error {
+	return saveFile(path, d.WriteTo)
+}
+
+// LoadDataset reads a dataset written by Dataset.WriteTo for key into
+// memory. It rejects bad files like LoadCache.
+func LoadDataset(r io.Reader, key []byte) (*Dataset, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	ds, err := readDatasetFile(r, key)
+	if err != nil {
+		return nil, err
+	}
+	return newLoadedDataset(ds, key), nil
+}
+
+// LoadDatasetFile loads a dataset saved with Dataset.SaveFile. Where the
+// platform supports it the file is mapped read-only instead of being
+// copied into memory, so the dataset is backed by the page cache and
+// several processes loading the same file share one copy. The whole file
+// is still read once to verify its checksum.
+//
+// The file must not be truncated or rewritten while the dataset is in
+// use: the mapping is private, but pages not yet read still come from
+// the file, and the checksum only covers the file as it was at load time.
+// Accessing a truncated mapping crashes the process with SIGBUS. Write a
+// new dataset to another path and rename it into place instead.
+func LoadDatasetFile(path string, key []byte) (*Dataset, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	ds, err := mapDatasetFile(path, key)
+	if err != nil {
+		return nil, err
+	}
+	return newLoadedDataset(ds, key), nil
+}
+
+// newLoadedDataset wraps a loaded dataset with one reference.
+func newLoadedDataset(ds *dataset, key []byte) *Dataset {
+	d := &Dataset{ds: ds, key: append([]byte(nil), key...)}
+	d.refs.init()
+	return d
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package randomx
+
+import "os"
+
+// mapDatasetFile reads a dataset file into memory on platforms without
+// mmap support.
+func mapDatasetFile(path string, key []byte) (*dataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readDatasetFile(f, key)
+}
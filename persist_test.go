@@ -0,0 +1,116 @@
+package randomx
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// Test the file format round trip and validation on a small payload
+func TestFileRoundTrip(t *testing.T) {
+	key := []byte("file key")
+	data := bytes.Repeat([]byte{1, 2, 3, 4, 5, 6, 7, 8}, 512)
+
+	var buf bytes.Buffer
+	n, err := writeFile(&buf, fileKindDataset, key, data)
+	if err != nil {
+		t.Fatalf("writeFile() error = %v", err)
+	}
+	if n != int64(fileHeaderSize+len(data)) || n != int64(buf.Len()) {
+		t.Errorf("writeFile() = %d bytes, buffer has %d, want %d", n, buf.Len(), fileHeaderSize+len(data))
+	}
+	file := buf.Bytes()
+
+	got, err := readFile(bytes.NewReader(file), fileKindDataset, key, len(data))
+	if err != nil {
+		t.Fatalf("readFile() error = %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("readFile() returned different data")
+	}
+
+	corrupt := func(offset int) []byte {
+		b := append([]byte(nil), file...)
+		b[offset] ^= 0xFF
+		return b
+	}
+
+	tests := []struct {
+		name string
+		file []byte
+		kind uint32
+		key  []byte
+		size int
+		want error
+	}{
+		{"wrong key", file, fileKindDataset, []byte("other key"), len(data), ErrKeyMismatch},
+		{"wrong kind", file, fileKindCache, key, len(data), ErrInvalidFile},
+		{"wrong size", file, fileKindDataset, key, len(data) / 2, ErrInvalidFile},
+		{"bad magic", corrupt(0), fileKindDataset, key, len(data), ErrInvalidFile},
+		{"bad version", corrupt(8), fileKindDataset, key, len(data), ErrInvalidFile},
+		{"bad parameters", corrupt(48), fileKindDataset, key, len(data), ErrInvalidFile},
+		{"corrupt payload", corrupt(fileHeaderSize + 100), fileKindDataset, key, len(data), ErrInvalidFile},
+		{"truncated", file[:len(file)-1], fileKindDataset, key, len(data), ErrInvalidFile},
+		{"empty", nil, fileKindDataset, key, len(data), ErrInvalidFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readFile(bytes.NewReader(tt.file), tt.kind, tt.key, tt.size)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("readFile() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// Test saving a cache and loading it back
+func TestCacheSaveLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping cache initialization test in short mode")
+	}
+
+	key := []byte("persist test")
+	c, err := NewCache(key, FlagDefault)
+	if err != nil {
+		t.Fatalf("NewCache() error = %v", err)
+	}
+	defer c.Release()
+
+	path := filepath.Join(t.TempDir(), "cache.bin")
+	if err := c.SaveFile(path); err != nil {
+		t.Fatalf("SaveFile() error = %v", err)
+	}
+
+	if _, err := LoadCacheFile(path, []byte("other key")); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("LoadCacheFile() with another key error = %v, want ErrKeyMismatch", err)
+	}
+
+	loaded, err := LoadCacheFile(path, key)
+	if err != nil {
+		t.Fatalf("LoadCacheFile() error = %v", err)
+	}
+	defer loaded.Release()
+
+	if !bytes.Equal(loaded.c.data, c.c.data) {
+		t.Error("loaded cache data differs")
+	}
+
+	input := []byte("persisted input")
+	var hashes [2][32]byte
+	for i, cache := range []*Cache{c, loaded} {
+		vm, err := NewVM(cache, nil, FlagDefault)
+		if err != nil {
+			t.Fatalf("NewVM() error = %v", err)
+		}
+		hashes[i], err = vm.Hash(input)
+		vm.Close()
+		if err != nil {
+			t.Fatalf("Hash() error = %v", err)
+		}
+	}
+	if hashes[0] != hashes[1] {
+		t.Errorf("loaded cache hash = %x, want %x", hashes[1], hashes[0])
+	}
+}
@@ -0,0 +1,57 @@
+//go:build unix
+
+package randomx
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapDatasetFile validates a dataset file and maps its payload read-only.
+func mapDatasetFile(path string, key []byte) (*dataset, error) {
+	return mapFile(path, fileKindDataset, key, datasetSize)
+}
+
+// mapFile validates a file written by writeFile and maps its payload
+// read-only and private, so nothing written through the mapping could
+// ever reach the file. The header is padded to a page, so the payload
+// offset is suitably aligned for mmap.
+func mapFile(path string, kind uint32, key []byte, size int) (*dataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	checksum, err := readFileHeader(f, kind, key, size)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() != int64(fileHeaderSize+size) {
+		return nil, fmt.Errorf("%w: file is %d bytes, want %d",
+			ErrInvalidFile, info.Size(), fileHeaderSize+size)
+	}
+
+	data, err := unix.Mmap(int(f.Fd()), fileHeaderSize, size, unix.PROT_READ, unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("randomx: mapping %s: %w", path, err)
+	}
+	if err := verifyChecksum(data, checksum); err != nil {
+		unix.Munmap(data)
+		return nil, err
+	}
+
+	return &dataset{
+		data:     data,
+		unmap:    func() error { return unix.Munmap(data) },
+		readOnly: true,
+		pages:    PagesFile,
+	}, nil
+}
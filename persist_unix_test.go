@@ -0,0 +1,75 @@
+//go:build unix
+
+package randomx
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test mapping a small file read-only
+func TestMapFile(t *testing.T) {
+	key := []byte("map key")
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+
+	path := filepath.Join(t.TempDir(), "dataset.bin")
+	err := saveFile(path, func(w io.Writer) (int64, error) {
+		return writeFile(w, fileKindDataset, key, data)
+	})
+	if err != nil {
+		t.Fatalf("saveFile() error = %v", err)
+	}
+
+	ds, err := mapFile(path, fileKindDataset, key, len(data))
+	if err != nil {
+		t.Fatalf("mapFile() error = %v", err)
+	}
+	if !bytes.Equal(ds.data, data) {
+		t.Error("mapped data differs")
+	}
+	if ds.unmap == nil {
+		t.Error("mapped dataset has no unmap function")
+	}
+
+	// Writing into the read-only mapping would fault
+	d := newLoadedDataset(ds, key)
+	if got := d.Pages(); got != PagesFile {
+		t.Errorf("Pages() of a mapped dataset = %v, want File", got)
+	}
+	if err := d.SetItems(0, data[:64]); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("SetItems() on a mapped dataset error = %v, want ErrReadOnly", err)
+	}
+	d.Release()
+	if ds.data != nil {
+		t.Error("release() did not drop the mapping")
+	}
+
+	if _, err := mapFile(path, fileKindDataset, []byte("other key"), len(data)); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("mapFile() with another key error = %v, want ErrKeyMismatch", err)
+	}
+
+	// Flip a payload byte on disk
+	file, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file[fileHeaderSize+7] ^= 1
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mapFile(path, fileKindDataset, key, len(data)); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("mapFile() of a corrupt file error = %v, want ErrInvalidFile", err)
+	}
+
+	// Append trailing garbage
+	if err := os.WriteFile(path, append(file, 0), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mapFile(path, fileKindDataset, key, len(data)); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("mapFile() of an oversized file error = %v, want ErrInvalidFile", err)
+	}
+}
@@ -0,0 +1,125 @@
+package randomx
+
+import (
+	"context"
+
+	"github.com/opd-ai/go-randomx/internal"
+)
+
+// Pipeline hashes a sequence of inputs one after another, overlapping the
+// end of each hash with the start of the next. It corresponds to the
+// randomx_calculate_hash_first, randomx_calculate_hash_next and
+// randomx_calculate_hash_last functions of the reference implementation
+// and produces the same hashes as Hasher.Hash.
+//
+// When hashing input N, Next finishes the scratchpad hash of input N while
+// filling the scratchpad for input N+1 in the same pass, so a mining loop
+// that steps through nonces saves one walk over the 2 MB scratchpad per
+// hash:
+//
+//	p := hasher.NewPipeline()
+//	defer p.Close()
+//	p.First(blob(0))
+//	for nonce := 1; ; nonce++ {
+//	    hash, err := p.Next(blob(nonce)) // hash of blob(nonce-1)
+//	    ...
+//	}
+//
+// A Pipeline owns a VM and is meant to be used by a single goroutine.
+// The cache or dataset is read when Next or Last runs, so a pending input
+// is hashed with the key that is current at that point.
+type Pipeline struct {
+	h       *Hasher
+	vm      *virtualMachine
+	pending bool
+}
+
+// NewPipeline returns a Pipeline that hashes with h. Close the Pipeline
+// when it is no longer needed to return its VM to the pool.
+func (h *Hasher) NewPipeline() *Pipeline {
+	return &Pipeline{
+		h:  h,
+		vm: h.getVM(),
+	}
+}
+
+// First starts hashing input. The hash is returned by the following call
+// to Next or Last. Calling First again discards the pending input.
+func (p *Pipeline) First(input []byte) error {
+	p.pending = false
+
+	p.h.mu.RLock()
+	defer p.h.mu.RUnlock()
+
+	if p.h.closed {
+		return ErrClosed
+	}
+
+	p.vm.init(p.h.ds, p.h.cache)
+	if err := p.vm.initializeSeed(internal.Blake2b512(input)); err != nil {
+		return err
+	}
+
+	p.pending = true
+	return nil
+}
+
+// Next returns the hash of the pending input and starts hashing
+// nextInput, which becomes the pending input.
+// It returns ErrNoPendingHash if First has not been called.
+func (p *Pipeline) Next(nextInput []byte) ([32]byte, error) {
+	return p.finish(nextInput, true)
+}
+
+// Last returns the hash of the pending input and leaves the Pipeline with
+// no pending input. It returns ErrNoPendingHash if First has not been
+// called.
+func (p *Pipeline) Last() ([32]byte, error) {
+	return p.finish(nil, false)
+}
+
+// finish runs the programs for the pending input and finalizes it,
+// filling the scratchpad for nextInput in the same pass if hasNext is set.
+func (p *Pipeline) finish(nextInput []byte, hasNext bool) ([32]byte, error) {
+	if !p.pending {
+		return [32]byte{}, ErrNoPendingHash
+	}
+	p.pending = false
+
+	p.h.mu.RLock()
+	defer p.h.mu.RUnlock()
+
+	if p.h.closed {
+		return [32]byte{}, ErrClosed
+	}
+
+	// Pick up the current cache and dataset without clearing the
+	// scratchpad that First or the previous Next filled.
+	p.vm.ds = p.h.ds
+	p.vm.c = p.h.cache
+
+	if err := p.vm.execute(context.Background()); err != nil {
+		return [32]byte{}, err
+	}
+
+	if !hasNext {
+		return p.vm.finalize()
+	}
+
+	hash, err := p.vm.hashAndFill(internal.Blake2b512(nextInput))
+	if err != nil {
+		return [32]byte{}, err
+	}
+	p.pending = true
+	return hash, nil
+}
+
+// Close returns the Pipeline's VM to the pool. The Pipeline must not be
+// used afterwards.
+func (p *Pipeline) Close() {
+	if p.vm != nil {
+		p.h.putVM(p.vm)
+		p.vm = nil
+	}
+	p.pending = false
+}
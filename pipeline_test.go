@@ -0,0 +1,65 @@
+package randomx
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Test that pipelined hashing matches Hasher.Hash
+func TestPipeline(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping hasher test in short mode")
+	}
+
+	hasher, err := New(Config{
+		Mode:     LightMode,
+		CacheKey: []byte("pipeline test"),
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer hasher.Close()
+
+	p := hasher.NewPipeline()
+	defer p.Close()
+
+	if _, err := p.Next([]byte("too early")); !errors.Is(err, ErrNoPendingHash) {
+		t.Errorf("Next() before First error = %v, want ErrNoPendingHash", err)
+	}
+
+	inputs := make([][]byte, 3)
+	for i := range inputs {
+		inputs[i] = []byte(fmt.Sprintf("nonce %d", i))
+	}
+
+	if err := p.First(inputs[0]); err != nil {
+		t.Fatalf("First() error = %v", err)
+	}
+	for i := 1; i <= len(inputs); i++ {
+		var got [32]byte
+		if i < len(inputs) {
+			got, err = p.Next(inputs[i])
+		} else {
+			got, err = p.Last()
+		}
+		if err != nil {
+			t.Fatalf("hash %d error = %v", i-1, err)
+		}
+		if want := hasher.Hash(inputs[i-1]); got != want {
+			t.Errorf("hash %d = %x, want %x", i-1, got, want)
+		}
+	}
+
+	if _, err := p.Last(); !errors.Is(err, ErrNoPendingHash) {
+		t.Errorf("second Last() error = %v, want ErrNoPendingHash", err)
+	}
+
+	if err := p.First(inputs[0]); err != nil {
+		t.Fatalf("First() error = %v", err)
+	}
+	hasher.Close()
+	if _, err := p.Last(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Last() after Close error = %v, want ErrClosed", err)
+	}
+}
@@ -21,6 +21,27 @@ type instruction struct {
 	src    uint8
 	mod    uint8
 	imm    uint32
+
+	// target is the index execution continues at when a CBRANCH is
+	// taken. It is set by setBranchTargets.
+	target uint8
+}
+
+// getModMem returns the mod.mem field, which selects the scratchpad level
+// of a memory operand.
+func (i *instruction) getModMem() uint8 {
+	return i.mod % 4
+}
+
+// getModShift returns the mod.shift field, the shift amount of IADD_RS.
+func (i *instruction) getModShift() uint8 {
+	return (i.mod >> 2) % 4
+}
+
+// getModCond returns the mod.cond field, which places the CBRANCH
+// condition and the ISTORE level.
+func (i *instruction) getModCond() uint8 {
+	return i.mod >> 4
 }
 
 // program represents a RandomX program (sequence of instructions).
@@ -47,6 +68,7 @@ func generateProgram(input []byte) *program {
 
 		p.instructions[i] = decodeInstruction(entropy[offset : offset+8])
 	}
+	p.setBranchTargets()
 
 	return p
 }
@@ -85,9 +107,60 @@ func decodeInstruction(data []byte) instruction {
 	}
 }
 
-// execute runs the program on the VM.
-func (p *program) execute(vm *virtualMachine) {
-	for i := 0; i < programLength; i++ {
-		vm.executeInstruction(&p.instructions[i])
+// setBranchTargets sets the target of each CBRANCH instruction, as the
+// specification's decoder does: a taken branch jumps back to the
+// instruction after the last one that modified its destination register,
+// or after the last CBRANCH if that came later, or to the start of the
+// program. Every CBRANCH counts as modifying all registers, so the loops
+// cannot overlap and each jump lands after the previous branch.
+func (p *program) setBranchTargets() {
+	// lastModified[r] is one past the index of the last instruction that
+	// modified register r.
+	var lastModified [8]uint8
+	for i := range p.instructions {
+		instr := &p.instructions[i]
+		dst, src := instr.dst&7, instr.src&7
+
+		switch getInstructionType(instr.opcode) {
+		case instrIADD_RS, instrIADD_M, instrISUB_R, instrISUB_M,
+			instrIMUL_R, instrIMUL_M, instrIMULH_R, instrIMULH_M,
+			instrISMULH_R, instrISMULH_M, instrINEG_R, instrIXOR_R,
+			instrIXOR_M, instrIROR_R, instrIROL_R:
+			lastModified[dst] = uint8(i + 1)
+
+		case instrIMUL_RCP:
+			// executeInstructionFull leaves dst alone for a zero or
+			// power of two immediate.
+			if !isZeroOrPowerOf2(instr.imm) {
+				lastModified[dst] = uint8(i + 1)
+			}
+
+		case instrISWAP_R:
+			if dst != src {
+				lastModified[dst] = uint8(i + 1)
+				lastModified[src] = uint8(i + 1)
+			}
+
+		case instrCBRANCH:
+			instr.target = lastModified[dst]
+			for r := range lastModified {
+				lastModified[r] = uint8(i + 1)
+			}
+		}
+	}
+}
+
+// execute runs the program on the VM, following taken CBRANCH
+// instructions back to their targets, and returns the number of branches
+// taken.
+func (p *program) execute(vm *virtualMachine) int {
+	taken := 0
+	for pc := 0; pc < programLength; pc++ {
+		instr := &p.instructions[pc]
+		if vm.executeInstruction(instr) {
+			pc = int(instr.target) - 1
+			taken++
+		}
 	}
+	return taken
 }
@@ -0,0 +1,235 @@
+package randomx
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// opcodeOf returns the first opcode of an instruction type.
+func opcodeOf(t *testing.T, typ instructionType) uint8 {
+	t.Helper()
+	for op := 0; op < 256; op++ {
+		if getInstructionType(uint8(op)) == typ {
+			return uint8(op)
+		}
+	}
+	t.Fatalf("no opcode for instruction type %d", typ)
+	return 0
+}
+
+// nopProgram returns a program of no-ops with the given instructions at
+// their indices. The spec has no NOP opcode, so the no-op is ISWAP_R with
+// the same register twice.
+func nopProgram(t *testing.T, instrs map[int]instruction) *program {
+	t.Helper()
+	p := &program{}
+	nop := opcodeOf(t, instrISWAP_R)
+	for i := range p.instructions {
+		p.instructions[i] = instruction{opcode: nop}
+	}
+	for i, instr := range instrs {
+		p.instructions[i] = instr
+	}
+	p.setBranchTargets()
+	return p
+}
+
+// Test the CBRANCH operands for the lowest and highest condition offsets
+// and a negative immediate
+func TestBranchOperands(t *testing.T) {
+	tests := []struct {
+		mod        uint8
+		imm        uint32
+		cimm, mask uint64
+	}{
+		{0x00, 0, 0x100, 0xFF00},
+		{0x0F, 0, 0x100, 0xFF00}, // only mod>>4 selects the offset
+		{0x00, 0xFFFFFFFF, 0xFFFFFFFFFFFFFF7F, 0xFF00},
+		{0xF0, 0, 0x800000, 0x7F800000},
+		{0xF0, 0x80400000, 0xFFFFFFFF80800000, 0x7F800000},
+		{0x30, 0x12345678, 0x12345A78, 0x7F800},
+	}
+	for _, tt := range tests {
+		cimm, mask := branchOperands(&instruction{mod: tt.mod, imm: tt.imm})
+		if cimm != tt.cimm || mask != tt.mask {
+			t.Errorf("branchOperands(mod=%#x, imm=%#x) = %#x, %#x, want %#x, %#x",
+				tt.mod, tt.imm, cimm, mask, tt.cimm, tt.mask)
+		}
+	}
+}
+
+// Test that branch targets follow the last modification of the
+// destination register and never cross an earlier branch
+func TestSetBranchTargets(t *testing.T) {
+	iadd := opcodeOf(t, instrIADD_RS)
+	ixor := opcodeOf(t, instrIXOR_R)
+	iswap := opcodeOf(t, instrISWAP_R)
+	rcp := opcodeOf(t, instrIMUL_RCP)
+	fadd := opcodeOf(t, instrFADD_R)
+	cbranch := opcodeOf(t, instrCBRANCH)
+
+	p := nopProgram(t, map[int]instruction{
+		3:  {opcode: iadd, dst: 1, src: 2},
+		5:  {opcode: ixor, dst: 2, src: 1},
+		6:  {opcode: fadd, dst: 1, src: 1}, // float registers do not count
+		8:  {opcode: cbranch, dst: 1},      // after 3
+		10: {opcode: cbranch, dst: 2},      // after 8, not 5
+		12: {opcode: iswap, dst: 4, src: 5},
+		13: {opcode: iswap, dst: 6, src: 6}, // no-op swap
+		14: {opcode: rcp, dst: 6},           // zero immediate: no-op
+		15: {opcode: cbranch, dst: 5},       // after 12
+		16: {opcode: cbranch, dst: 6},       // after 15
+		40: {opcode: rcp, dst: 0, imm: 7},
+		41: {opcode: cbranch, dst: 0},           // after 40
+		42: {opcode: rcp, dst: 0, imm: 1 << 20}, // power of two: no-op
+		50: {opcode: cbranch, dst: 0},           // after 41
+	})
+	want := map[int]uint8{8: 4, 10: 9, 15: 13, 16: 16, 41: 41, 50: 42}
+	for i, target := range want {
+		if got := p.instructions[i].target; got != target {
+			t.Errorf("instruction %d target = %d, want %d", i, got, target)
+		}
+	}
+
+	// The first branch of a program with no writes to its register
+	// jumps to the start.
+	p = nopProgram(t, map[int]instruction{
+		100: {opcode: iadd, dst: 3, src: 3},
+		200: {opcode: cbranch, dst: 7},
+	})
+	if got := p.instructions[200].target; got != 0 {
+		t.Errorf("unmodified register target = %d, want 0", got)
+	}
+}
+
+// Test the number of branches taken by programs with known behaviour
+func TestProgramBranchesTaken(t *testing.T) {
+	iadd := opcodeOf(t, instrIADD_RS)
+	cbranch := opcodeOf(t, instrCBRANCH)
+
+	// With a zero immediate and offset 8, each CBRANCH adds 1 to the
+	// condition byte r0>>8 and is taken when it wraps to zero.
+	tests := []struct {
+		name   string
+		instrs map[int]instruction
+		r0     uint64
+		taken  int
+		r0Want uint64
+		r1Want uint64
+	}{
+		{
+			name:   "not taken",
+			instrs: map[int]instruction{10: {opcode: cbranch, dst: 0}},
+			r0:     0,
+			taken:  0,
+			r0Want: 0x100,
+		},
+		{
+			// The loop runs r1 += r2 a second time, after which the
+			// condition byte is 1.
+			name: "taken once",
+			instrs: map[int]instruction{
+				5:  {opcode: iadd, dst: 1, src: 2},
+				10: {opcode: cbranch, dst: 0},
+			},
+			r0:     0xFF00,
+			taken:  1,
+			r0Want: 0x10100,
+			r1Want: 2,
+		},
+		{
+			// The bit below the condition is cleared in the
+			// immediate, so 0x80 + 0x80 does not carry into it.
+			name:   "cleared bit",
+			instrs: map[int]instruction{10: {opcode: cbranch, dst: 0, imm: 0x80}},
+			r0:     0xFE80,
+			taken:  0,
+			r0Want: 0xFF80,
+		},
+		{
+			// Each branch is taken once, and the second only jumps
+			// back to the instruction after the first.
+			name: "two loops",
+			instrs: map[int]instruction{
+				5:  {opcode: iadd, dst: 1, src: 2},
+				10: {opcode: cbranch, dst: 0},
+				20: {opcode: cbranch, dst: 3, mod: 0x10, imm: 0xFFFFFFFF},
+			},
+			r0:     0xFF00,
+			taken:  2,
+			r0Want: 0x10100,
+			r1Want: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := nopProgram(t, tt.instrs)
+			vm := &virtualMachine{mem: make([]byte, scratchpadL3Size)}
+			vm.reg[0] = tt.r0
+			vm.reg[2] = 1
+			// r3 = 0x1FF: with the immediate -1 and offset 9, cimm
+			// is -1 | 0x200 &^ 0x100 = 0x...FEFF, and 0x1FF+cimm
+			// = 0xFE has a zero condition, but 0xFE+cimm does not.
+			vm.reg[3] = 0x1FF
+
+			if taken := p.execute(vm); taken != tt.taken {
+				t.Errorf("execute() took %d branches, want %d", taken, tt.taken)
+			}
+			if vm.reg[0] != tt.r0Want {
+				t.Errorf("r0 = %#x, want %#x", vm.reg[0], tt.r0Want)
+			}
+			if vm.reg[1] != tt.r1Want {
+				t.Errorf("r1 = %d, want %d", vm.reg[1], tt.r1Want)
+			}
+		})
+	}
+}
+
+// Test that the branches of random programs only jump back over
+// instructions that leave their register alone
+func TestProgramBranchTargetsRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var raw [programSize]byte
+	branches := 0
+	for n := 0; n < 100; n++ {
+		rng.Read(raw[:])
+		p := generateProgram(raw[:])
+		for i := range p.instructions {
+			instr := &p.instructions[i]
+			if getInstructionType(instr.opcode) != instrCBRANCH {
+				continue
+			}
+			branches++
+			if int(instr.target) > i {
+				t.Fatalf("program %d: branch %d jumps forward to %d", n, i, instr.target)
+			}
+			for j := int(instr.target); j < i; j++ {
+				body := &p.instructions[j]
+				typ := getInstructionType(body.opcode)
+				if typ == instrCBRANCH || modifies(body, instr.dst&7) {
+					t.Fatalf("program %d: branch %d loops over instruction %d (type %d)", n, i, j, typ)
+				}
+			}
+		}
+	}
+	if branches == 0 {
+		t.Fatal("random programs contain no branches")
+	}
+}
+
+// modifies reports whether instr writes integer register r, independently
+// of setBranchTargets.
+func modifies(instr *instruction, r uint8) bool {
+	dst, src := instr.dst&7, instr.src&7
+	switch getInstructionType(instr.opcode) {
+	case instrFSWAP_R, instrFADD_R, instrFADD_M, instrFSUB_R, instrFSUB_M,
+		instrFSCAL_R, instrFMUL_R, instrFDIV_M, instrFSQRT_R,
+		instrCFROUND, instrISTORE, instrNOP:
+		return false
+	case instrIMUL_RCP:
+		return dst == r && instr.imm&(instr.imm-1) != 0
+	case instrISWAP_R:
+		return dst != src && (dst == r || src == r)
+	}
+	return dst == r
+}
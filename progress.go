@@ -0,0 +1,135 @@
+package randomx
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Phase identifies a stage of cache or dataset initialization.
+type Phase int
+
+const (
+	// PhaseArgon2d is the Argon2d fill of the 256 MB cache.
+	// Progress is counted in 1 KB memory blocks across all passes.
+	PhaseArgon2d Phase = iota
+
+	// PhaseSuperscalar is the generation of the superscalar programs
+	// used to expand the cache into dataset items.
+	// Progress is counted in programs.
+	PhaseSuperscalar
+
+	// PhaseDataset is the generation of the fast mode dataset.
+	// Progress is counted in 64-byte dataset items.
+	PhaseDataset
+)
+
+// String returns the string representation of the phase.
+func (p Phase) String() string {
+	switch p {
+	case PhaseArgon2d:
+		return "Argon2d"
+	case PhaseSuperscalar:
+		return "Superscalar"
+	case PhaseDataset:
+		return "Dataset"
+	default:
+		return fmt.Sprintf("Phase(%d)", p)
+	}
+}
+
+// Progress describes how far cache or dataset initialization has got.
+// It is delivered to Config.Progress.
+type Progress struct {
+	// Phase is the initialization stage currently running.
+	Phase Phase
+
+	// Pass and Slice locate the Argon2d fill. They are zero in other phases.
+	Pass, Slice uint32
+
+	// Done and Total count the units of work in the current phase
+	// (memory blocks, programs or dataset items; see Phase).
+	Done, Total uint64
+
+	// Fraction is Done/Total, between 0 and 1.
+	Fraction float64
+
+	// Remaining estimates the time left in the current phase, based on the
+	// rate observed since the phase started. It is zero until some work
+	// has been done.
+	Remaining time.Duration
+}
+
+// progressReporter turns raw counters from the worker loops into Progress
+// values for the user callback. A nil *progressReporter discards updates,
+// so callers never need to check whether reporting is enabled.
+//
+// Reports may come from several goroutines; the callback is invoked with
+// the mutex held so the user sees one update at a time, in order.
+type progressReporter struct {
+	fn    func(Progress)
+	mu    sync.Mutex
+	phase Phase
+	start time.Time
+	last  uint64
+}
+
+// newProgressReporter returns a reporter for fn, or nil if fn is nil.
+func newProgressReporter(fn func(Progress)) *progressReporter {
+	if fn == nil {
+		return nil
+	}
+	return &progressReporter{fn: fn}
+}
+
+// begin starts timing a new phase.
+func (r *progressReporter) begin(phase Phase) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.phase = phase
+	r.start = time.Now()
+	r.last = 0
+	r.mu.Unlock()
+}
+
+// report delivers an update for the current phase. Updates that would move
+// Done backwards, which can happen when workers race, are dropped.
+func (r *progressReporter) report(pass, slice uint32, done, total uint64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if done < r.last {
+		return
+	}
+	r.last = done
+
+	p := Progress{
+		Phase: r.phase,
+		Pass:  pass,
+		Slice: slice,
+		Done:  done,
+		Total: total,
+	}
+	if total > 0 {
+		p.Fraction = float64(done) / float64(total)
+	}
+	if done > 0 && done < total {
+		elapsed := time.Since(r.start)
+		p.Remaining = time.Duration(float64(elapsed) * float64(total-done) / float64(done))
+	}
+	r.fn(p)
+}
+
+// argon2d adapts the reporter to the internal Argon2d progress callback.
+// It returns nil when reporting is disabled so the fill skips the calls.
+func (r *progressReporter) argon2d() func(pass, slice uint32, done, total uint64) {
+	if r == nil {
+		return nil
+	}
+	return r.report
+}
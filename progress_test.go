@@ -0,0 +1,99 @@
+package randomx
+
+import (
+	"testing"
+	"time"
+)
+
+// Test Phase.String()
+func TestPhaseString(t *testing.T) {
+	tests := []struct {
+		phase Phase
+		want  string
+	}{
+		{PhaseArgon2d, "Argon2d"},
+		{PhaseSuperscalar, "Superscalar"},
+		{PhaseDataset, "Dataset"},
+		{Phase(42), "Phase(42)"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.phase.String(); got != tt.want {
+			t.Errorf("Phase.String() = %v, want %v", got, tt.want)
+		}
+	}
+}
+
+// Test fraction and ETA computation in the reporter
+func TestProgressReporter(t *testing.T) {
+	var got []Progress
+	r := newProgressReporter(func(p Progress) { got = append(got, p) })
+
+	r.begin(PhaseDataset)
+	time.Sleep(10 * time.Millisecond)
+	r.report(0, 0, 25, 100)
+	r.report(0, 0, 10, 100) // stale update from a slower worker
+	r.report(0, 0, 100, 100)
+
+	if len(got) != 2 {
+		t.Fatalf("got %d updates, want 2 (stale update must be dropped)", len(got))
+	}
+	if got[0].Phase != PhaseDataset || got[0].Fraction != 0.25 {
+		t.Errorf("first update = %+v, want Dataset phase at 0.25", got[0])
+	}
+	if got[0].Remaining <= 0 {
+		t.Errorf("first update Remaining = %v, want a positive estimate", got[0].Remaining)
+	}
+	if got[1].Fraction != 1 || got[1].Remaining != 0 {
+		t.Errorf("final update = %+v, want Fraction 1 and no time remaining", got[1])
+	}
+
+	// A nil reporter must be safe to use.
+	var nilReporter *progressReporter
+	nilReporter.begin(PhaseArgon2d)
+	nilReporter.report(0, 0, 1, 2)
+	if nilReporter.argon2d() != nil {
+		t.Error("nil reporter should disable Argon2d progress")
+	}
+}
+
+// Test that light mode initialization reports the cache phases
+func TestConfigProgress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping hasher initialization test in short mode")
+	}
+
+	seen := make(map[Phase]Progress)
+	updates := 0
+	config := Config{
+		Mode:     LightMode,
+		CacheKey: []byte("progress key"),
+		Progress: func(p Progress) {
+			updates++
+			seen[p.Phase] = p
+		},
+	}
+
+	hasher, err := New(config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer hasher.Close()
+
+	for _, phase := range []Phase{PhaseArgon2d, PhaseSuperscalar} {
+		last, ok := seen[phase]
+		if !ok {
+			t.Errorf("no progress reported for %v", phase)
+			continue
+		}
+		if last.Done != last.Total || last.Fraction != 1 {
+			t.Errorf("%v finished at %d/%d (%.2f), want complete", phase, last.Done, last.Total, last.Fraction)
+		}
+	}
+	if _, ok := seen[PhaseDataset]; ok {
+		t.Error("light mode should not report dataset progress")
+	}
+	if updates < 10 {
+		t.Errorf("got %d progress updates, want periodic reporting", updates)
+	}
+}
@@ -0,0 +1,123 @@
+package randomx
+
+import (
+	"context"
+	"fmt"
+)
+
+// Status describes which backing store a Hasher computes hashes from.
+type Status int
+
+const (
+	// StatusClosed means the hasher has been closed and cannot hash.
+	StatusClosed Status = iota
+
+	// StatusCache means hashes are computed from the cache, generating
+	// dataset items on the fly. This is always the case in LightMode.
+	StatusCache
+
+	// StatusPromoting means hashes are computed from the cache while the
+	// dataset is being built in the background (AutoMode only).
+	StatusPromoting
+
+	// StatusDataset means hashes are computed from the full dataset.
+	// This is always the case in FastMode.
+	StatusDataset
+)
+
+// String returns the string representation of the status.
+func (s Status) String() string {
+	switch s {
+	case StatusClosed:
+		return "Closed"
+	case StatusCache:
+		return "Cache"
+	case StatusPromoting:
+		return "Promoting"
+	case StatusDataset:
+		return "Dataset"
+	default:
+		return fmt.Sprintf("Status(%d)", s)
+	}
+}
+
+// Status reports which backing store the hasher currently uses.
+func (h *Hasher) Status() Status {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	switch {
+	case h.closed:
+		return StatusClosed
+	case h.ds != nil:
+		return StatusDataset
+	case h.promotion != nil:
+		return StatusPromoting
+	default:
+		return StatusCache
+	}
+}
+
+// promotion is the dataset being built in the background in AutoMode.
+type promotion struct {
+	cancel context.CancelFunc
+	done   chan struct{} // Closed once the build has finished
+}
+
+// startPromotionLocked starts building the dataset for c in the
+// background. The caller must hold h.mu, or own h exclusively.
+func (h *Hasher) startPromotionLocked(c *cache) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &promotion{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	h.promotion = p
+
+	go h.promote(ctx, p, c)
+}
+
+// promote builds the dataset for c and, unless p has been stopped in the
+// meantime, switches the hasher to it. A failed build leaves the hasher
+// serving from the cache.
+func (h *Hasher) promote(ctx context.Context, p *promotion, c *cache) {
+	defer close(p.done)
+	defer p.cancel()
+
+	ds, err := newDatasetContext(ctx, c, h.largePages(), h.newProgress())
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.promotion != p {
+		// Stopped by a key swap or Close
+		if err == nil {
+			ds.release()
+		}
+		return
+	}
+
+	h.promotion = nil
+	if err == nil {
+		h.ds = ds
+	}
+}
+
+// lockStopPromotion stops any background dataset build, waiting for it to
+// finish, and returns with h.mu held. The build takes h.mu to install its
+// result, so it is stopped with the lock released and the check repeated
+// in case another build was started meanwhile.
+func (h *Hasher) lockStopPromotion() {
+	for {
+		h.mu.Lock()
+		p := h.promotion
+		if p == nil {
+			return
+		}
+		h.promotion = nil
+		h.mu.Unlock()
+
+		p.cancel()
+		<-p.done
+	}
+}
@@ -0,0 +1,118 @@
+package randomx
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that AutoMode serves from the cache at once, switches to the
+// dataset without changing the hashes, and stays on a dataset across a
+// key change
+func TestAutoModePromotion(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping dataset initialization test in short mode")
+	}
+
+	hasher, err := New(Config{Mode: AutoMode, CacheKey: []byte("auto mode key")})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer hasher.Close()
+
+	if got := hasher.Status(); got != StatusPromoting {
+		t.Errorf("Status() after New = %v, want %v", got, StatusPromoting)
+	}
+	if !hasher.IsReady() {
+		t.Error("IsReady() = false while promoting, want true")
+	}
+
+	reference, err := New(Config{Mode: LightMode, CacheKey: []byte("auto mode key")})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer reference.Close()
+
+	input := []byte("auto mode input")
+	want := reference.Hash(input)
+	if got := hasher.Hash(input); got != want {
+		t.Errorf("Hash() from cache = %x, want %x", got, want)
+	}
+
+	deadline := time.Now().Add(30 * time.Minute)
+	for hasher.Status() == StatusPromoting {
+		if time.Now().After(deadline) {
+			t.Fatal("dataset was not built in time")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if got := hasher.Status(); got != StatusDataset {
+		t.Fatalf("Status() after promotion = %v, want %v", got, StatusDataset)
+	}
+	if got := hasher.Hash(input); got != want {
+		t.Errorf("Hash() from dataset = %x, want %x", got, want)
+	}
+
+	// A key change builds the new dataset before swapping
+	if err := hasher.UpdateCacheKey([]byte("auto mode new key")); err != nil {
+		t.Fatalf("UpdateCacheKey() error = %v", err)
+	}
+	if got := hasher.Status(); got != StatusDataset {
+		t.Errorf("Status() after UpdateCacheKey = %v, want %v", got, StatusDataset)
+	}
+	if err := reference.UpdateCacheKey([]byte("auto mode new key")); err != nil {
+		t.Fatalf("UpdateCacheKey() error = %v", err)
+	}
+	want = reference.Hash(input)
+	if got := hasher.Hash(input); got != want {
+		t.Errorf("Hash() after UpdateCacheKey = %x, want %x", got, want)
+	}
+
+	if err := hasher.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := hasher.Status(); got != StatusClosed {
+		t.Errorf("Status() after Close = %v, want %v", got, StatusClosed)
+	}
+}
+
+// Test that Close stops a dataset build in progress
+func TestAutoModeCloseWhilePromoting(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping hasher initialization test in short mode")
+	}
+
+	hasher, err := New(Config{Mode: AutoMode, CacheKey: []byte("auto mode close")})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	start := time.Now()
+	if err := hasher.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Close() took %v, want it to cancel the dataset build", elapsed)
+	}
+	if got := hasher.Status(); got != StatusClosed {
+		t.Errorf("Status() after Close = %v, want %v", got, StatusClosed)
+	}
+}
+
+// Test Status.String()
+func TestStatusString(t *testing.T) {
+	tests := []struct {
+		status Status
+		want   string
+	}{
+		{StatusClosed, "Closed"},
+		{StatusCache, "Cache"},
+		{StatusPromoting, "Promoting"},
+		{StatusDataset, "Dataset"},
+		{Status(9), "Status(9)"},
+	}
+	for _, tt := range tests {
+		if got := tt.status.String(); got != tt.want {
+			t.Errorf("Status(%d).String() = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
@@ -20,9 +20,12 @@
 package randomx
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"sync"
+
+	"github.com/opd-ai/go-randomx/argon2"
+	"github.com/opd-ai/go-randomx/internal"
 )
 
 // Mode represents the RandomX operational mode.
@@ -36,6 +39,14 @@ const (
 	// FastMode pre-computes a 2+ GB dataset for maximum hashing performance.
 	// Recommended for mining and high-throughput applications.
 	FastMode
+
+	// AutoMode starts hashing from the cache like LightMode as soon as the
+	// cache is built, builds the dataset in the background, and switches
+	// to it once it is complete. Hashes are the same either way; only the
+	// speed changes. Use Hasher.Status to see which is in use. Key changes
+	// build the new dataset before swapping, like FastMode, so a promoted
+	// hasher keeps hashing from a dataset.
+	AutoMode
 )
 
 // String returns the string representation of the mode.
@@ -45,56 +56,68 @@ func (m Mode) String() string {
 		return "LightMode"
 	case FastMode:
 		return "FastMode"
+	case AutoMode:
+		return "AutoMode"
 	default:
 		return fmt.Sprintf("Mode(%d)", m)
 	}
 }
 
-// Flags represents CPU feature flags for optimization.
-//
-// Note: Currently unused. Go's crypto/aes automatically uses hardware AES-NI
-// when available. This field is reserved for future optimizations.
-type Flags uint32
-
-const (
-	// FlagDefault uses standard optimizations available on all platforms.
-	FlagDefault Flags = 0
-
-	// FlagAES indicates hardware AES support (AES-NI on x86).
-	// Note: Currently has no effect. crypto/aes uses AES-NI automatically.
-	FlagAES Flags = 1 << 0
-
-	// Future flags can be added here for additional CPU features.
-)
-
 // Config specifies the configuration for a RandomX hasher.
 type Config struct {
 	// Mode determines memory usage and performance characteristics.
 	Mode Mode
 
-	// Flags specifies CPU feature optimizations to enable.
-	//
-	// Note: Currently unused. Reserved for future CPU-specific optimizations.
-	// Go's crypto/aes automatically detects and uses AES-NI when available.
+	// Flags selects optional features and CPU-specific implementations,
+	// like randomx_flags. Start from GetFlags() to use everything the
+	// machine supports. New fails with ErrUnsupportedFlags if a flag
+	// cannot be honoured.
 	Flags Flags
 
 	// CacheKey is the seed used to generate the cache and dataset.
 	// In Monero, this changes every 2048 blocks (~2.8 days).
 	// Must not be nil or empty.
 	CacheKey []byte
+
+	// Progress, if non-nil, is called periodically while the cache and
+	// dataset are built by New, NewContext, UpdateCacheKey and
+	// PrepareNextKey. It may be called from worker goroutines, but never
+	// concurrently with itself. It should return quickly, as
+	// initialization waits for it.
+	Progress func(Progress)
+
+	// AutoSwap makes the hasher switch to a key prepared with
+	// PrepareNextKey as soon as its cache and dataset are ready, instead
+	// of waiting for SwapNextKey or UpdateCacheKey.
+	AutoSwap bool
+
+	// KeyEvents, if non-nil, is called when a key prepared with
+	// PrepareNextKey is ready or fails to build, and whenever the hasher
+	// switches to a new key. It may be called from a background
+	// goroutine, but never concurrently with itself.
+	KeyEvents func(KeyEvent)
 }
 
 // Validate checks if the configuration is valid.
 func (c *Config) Validate() error {
 	if len(c.CacheKey) == 0 {
-		return errors.New("randomx: cache key must not be empty")
+		return ErrEmptyKey
 	}
 
-	if c.Mode != LightMode && c.Mode != FastMode {
-		return fmt.Errorf("randomx: invalid mode: %v", c.Mode)
+	if c.Mode != LightMode && c.Mode != FastMode && c.Mode != AutoMode {
+		return fmt.Errorf("%w: %v", ErrInvalidMode, c.Mode)
 	}
 
-	return nil
+	return checkFlags(c.Flags)
+}
+
+// effectiveMode returns the mode to run in, taking FlagFullMem into
+// account.
+func (c *Config) effectiveMode() Mode {
+	if c.Flags&FlagFullMem != 0 && c.Mode == LightMode {
+		return FastMode
+	}
+	return c.Mode
 }
 
 // Hasher computes RandomX hashes. It is safe for concurrent use.
@@ -104,102 +127,252 @@ type Hasher struct {
 	ds     *dataset
 	closed bool
 	mu     sync.RWMutex // Protects closed flag and cache key updates
+
+	nextMu  sync.Mutex // Protects next
+	next    *nextKey   // Key being prepared by PrepareNextKey, if any
+	swapMu  sync.Mutex // Orders swaps by SwapNextKey and UpdateCacheKey
+	eventMu sync.Mutex // Serializes KeyEvents calls
+
+	progressMu sync.Mutex // Serializes Progress calls from concurrent builds
+
+	promotion *promotion // AutoMode dataset being built, protected by mu
+
+	vms    *hasherVMPool // VMs owned by the hasher, with FlagLargePages or FlagJIT
+	argon2 argon2.Impl   // Argon2 compression selected by FlagArgon2SSSE3 and FlagArgon2AVX2
 }
 
 // New creates a new RandomX hasher with the specified configuration.
 // The returned hasher must be closed with Close() to free resources.
 func New(config Config) (*Hasher, error) {
+	return NewContext(context.Background(), config)
+}
+
+// NewContext is like New but stops initialization as soon as ctx is done.
+// Cache and dataset construction check the context periodically; when it
+// is cancelled, anything built so far is released and the returned error
+// wraps ctx.Err().
+func NewContext(ctx context.Context, config Config) (*Hasher, error) {
 	if err := config.Validate(); err != nil {
 		return nil, err
 	}
+	config.Mode = config.effectiveMode()
 
 	h := &Hasher{
 		config: config,
+		argon2: config.Flags.argon2Impl(),
+	}
+	if h.largePages() || config.Flags&FlagJIT != 0 {
+		h.vms = newHasherVMPool(h.largePages())
 	}
 
 	// Initialize cache
 	var err error
-	h.cache, err = newCache(config.CacheKey)
+	progress := h.newProgress()
+	h.cache, err = newCacheContext(ctx, config.CacheKey, h.largePages(), h.argon2, progress)
 	if err != nil {
 		return nil, fmt.Errorf("randomx: cache initialization: %w", err)
 	}
 
 	// Initialize dataset for fast mode
 	if config.Mode == FastMode {
-		h.ds, err = newDataset(h.cache)
+		h.ds, err = newDatasetContext(ctx, h.cache, h.largePages(), progress)
 		if err != nil {
 			h.cache.release()
 			return nil, fmt.Errorf("randomx: dataset initialization: %w", err)
 		}
 	}
 
+	// Serve from the cache while the dataset is built for auto mode
+	if config.Mode == AutoMode {
+		h.startPromotionLocked(h.cache)
+	}
+
 	return h, nil
 }
 
 // Hash computes the RandomX hash of the input data.
 // This method is safe for concurrent use by multiple goroutines.
+//
+// Hash panics if the hasher is closed. Use HashE when the hasher may be
+// closed concurrently, for example during a key rotation.
 func (h *Hasher) Hash(input []byte) [32]byte {
+	hash, err := h.HashE(input)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+// HashE is like Hash but returns an error instead of panicking.
+// It returns ErrClosed if the hasher has been closed.
+func (h *Hasher) HashE(input []byte) ([32]byte, error) {
+	return h.HashContext(context.Background(), input)
+}
+
+// HashContext is like HashE but stops early when ctx is done, returning
+// ctx.Err(). The context is checked between the VM programs, so a
+// cancelled hash returns within one program's execution.
+func (h *Hasher) HashContext(ctx context.Context, input []byte) ([32]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return [32]byte{}, err
+	}
+	return h.hashSeed(ctx, internal.Blake2b512(input))
+}
+
+// hashSeed computes the RandomX hash from the Blake2b-512 hash of the input.
+func (h *Hasher) hashSeed(ctx context.Context, seed [64]byte) ([32]byte, error) {
+	// Get a VM from the pool
+	vm := h.getVM()
+	defer h.putVM(vm)
+
+	return h.hashWithVM(ctx, vm, seed)
+}
+
+// hashWithVM is hashSeed on a VM owned by the caller, so workers that hash
+// many inputs can keep one VM instead of going through the pool each time.
+// The read lock is held for a single hash only, so a long-running batch
+// does not block UpdateCacheKey between inputs.
+func (h *Hasher) hashWithVM(ctx context.Context, vm *virtualMachine, seed [64]byte) ([32]byte, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	if h.closed {
-		panic("randomx: Hash called on closed hasher")
+		return [32]byte{}, ErrClosed
 	}
 
-	// Get a VM from the pool
-	vm := poolGetVM()
-	defer poolPutVM(vm)
-
 	// Initialize VM with the hasher's dataset or cache
 	vm.init(h.ds, h.cache)
 
 	// Execute the RandomX hash algorithm
-	return vm.run(input)
+	return vm.runSeed(ctx, seed)
 }
 
 // UpdateCacheKey updates the cache key and regenerates the dataset.
-// This is an expensive operation (20-30 seconds for fast mode).
-// Returns nil if the new key matches the current key.
+// This is an expensive operation (20-30 seconds for fast mode), but
+// hashing continues with the old key while the new cache and dataset are
+// built; the hasher only blocks readers for the final swap.
+// Returns nil if the new key matches the current key. If newKey was
+// passed to PrepareNextKey, the prepared cache and dataset are used.
 //
 // On error, the hasher remains in its previous state and can continue
 // to be used with the old cache key.
 func (h *Hasher) UpdateCacheKey(newKey []byte) error {
+	return h.UpdateCacheKeyContext(context.Background(), newKey)
+}
+
+// UpdateCacheKeyContext is like UpdateCacheKey but abandons the rebuild as
+// soon as ctx is done. A cancelled rebuild releases the partially built
+// cache and dataset, returns an error wrapping ctx.Err(), and leaves the
+// hasher using its previous key.
+func (h *Hasher) UpdateCacheKeyContext(ctx context.Context, newKey []byte) error {
 	if len(newKey) == 0 {
-		return errors.New("randomx: cache key must not be empty")
+		return ErrEmptyKey
 	}
 
-	h.mu.Lock()
-	defer h.mu.Unlock()
+	h.mu.RLock()
+	closed, same := h.closed, bytesEqual(h.config.CacheKey, newKey)
+	h.mu.RUnlock()
 
-	if h.closed {
-		return errors.New("randomx: UpdateCacheKey called on closed hasher")
+	if closed {
+		return ErrClosed
 	}
 
 	// Check if key actually changed
-	if bytesEqual(h.config.CacheKey, newKey) {
+	if same {
 		return nil
 	}
 
-	// Create new cache first (don't release old resources yet)
-	var err error
-	newCache, err := newCache(newKey)
+	// Reuse the background build if this key has been prepared
+	h.nextMu.Lock()
+	next := h.next
+	h.nextMu.Unlock()
+	if next != nil && bytesEqual(next.key, newKey) {
+		return h.SwapNextKey(ctx)
+	}
+
+	// Build the new cache and dataset without holding the lock, so hashing
+	// continues with the old key in the meantime.
+	newCache, newDS, err := h.build(ctx, newKey)
 	if err != nil {
 		// Old cache/dataset still intact, hasher remains usable
-		return fmt.Errorf("randomx: cache regeneration: %w", err)
+		return err
 	}
 
-	// Create new dataset for fast mode (if needed)
+	h.swapMu.Lock()
+	defer h.swapMu.Unlock()
+
+	// A key still being prepared is stale once newKey is installed. Drop
+	// it, so that AutoSwap does not switch back to it later.
+	h.nextMu.Lock()
+	next = h.next
+	h.next = nil
+	h.nextMu.Unlock()
+	if next != nil {
+		go h.discard(next)
+	}
+
+	return h.swap(newKey, newCache, newDS)
+}
+
+// build creates the cache, and in fast mode the dataset, for key.
+func (h *Hasher) build(ctx context.Context, key []byte) (*cache, *dataset, error) {
+	progress := h.newProgress()
+	newCache, err := newCacheContext(ctx, key, h.largePages(), h.argon2, progress)
+	if err != nil {
+		return nil, nil, fmt.Errorf("randomx: cache regeneration: %w", err)
+	}
+
+	// Create new dataset for fast and auto mode. An auto mode hasher
+	// that has been promoted stays on the dataset across key changes.
 	var newDS *dataset
-	if h.config.Mode == FastMode {
-		newDS, err = newDataset(newCache)
+	if h.config.Mode != LightMode {
+		newDS, err = newDatasetContext(ctx, newCache, h.largePages(), progress)
 		if err != nil {
-			// Clean up newly created cache, keep old resources intact
+			// Clean up newly created cache
 			newCache.release()
-			return fmt.Errorf("randomx: dataset regeneration: %w", err)
+			return nil, nil, fmt.Errorf("randomx: dataset regeneration: %w", err)
+		}
+	}
+
+	return newCache, newDS, nil
+}
+
+// newProgress returns a progress reporter for one build. Builds for
+// UpdateCacheKey, PrepareNextKey and AutoMode may run at the same time,
+// each with its own reporter, so they deliver through progressMu to keep
+// Config.Progress from being called concurrently.
+func (h *Hasher) newProgress() *progressReporter {
+	if h.config.Progress == nil {
+		return nil
+	}
+	return newProgressReporter(func(p Progress) {
+		h.progressMu.Lock()
+		defer h.progressMu.Unlock()
+		h.config.Progress(p)
+	})
+}
+
+// largePages reports whether the hasher backs its memory with huge pages.
+func (h *Hasher) largePages() bool {
+	return h.config.Flags.largePages()
+}
+
+// swap installs a freshly built cache and dataset for key and releases
+// the old ones. It waits for in-flight hashes to finish, and releases the
+// new resources instead if the hasher has been closed in the meantime.
+func (h *Hasher) swap(key []byte, newCache *cache, newDS *dataset) error {
+	// The old cache must outlive any dataset still being built from it
+	h.lockStopPromotion()
+
+	if h.closed {
+		h.mu.Unlock()
+		if newDS != nil {
+			newDS.release()
 		}
+		newCache.release()
+		return ErrClosed
 	}
 
-	// Success! Now safely release old resources and swap in new ones
 	if h.ds != nil {
 		h.ds.release()
 	}
@@ -211,22 +384,40 @@ func (h *Hasher) UpdateCacheKey(newKey []byte) error {
 	h.ds = newDS
 
 	// Update stored key
-	h.config.CacheKey = append([]byte(nil), newKey...)
+	h.config.CacheKey = append([]byte(nil), key...)
+	h.mu.Unlock()
 
+	h.emit(KeyEvent{Kind: KeySwapped, Key: key})
 	return nil
 }
 
 // Close releases all resources held by the hasher.
-// After Close, the hasher must not be used.
+// After Close, the hasher must not be used; HashE, HashContext and
+// UpdateCacheKey return ErrClosed. Closing an already closed hasher
+// also returns ErrClosed.
 func (h *Hasher) Close() error {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-
 	if h.closed {
-		return nil
+		h.mu.Unlock()
+		return ErrClosed
 	}
-
 	h.closed = true
+	h.mu.Unlock()
+
+	// Background builds are stopped without holding the lock, as they
+	// take it to install or discard their results. Closed is already
+	// set, so nothing else touches the cache or dataset meanwhile.
+	h.nextMu.Lock()
+	next := h.next
+	h.next = nil
+	h.nextMu.Unlock()
+	if next != nil {
+		h.discard(next)
+	}
+
+	// The AutoMode dataset build may still read the cache
+	h.lockStopPromotion()
+	defer h.mu.Unlock()
 
 	if h.ds != nil {
 		h.ds.release()
@@ -238,10 +429,16 @@ func (h *Hasher) Close() error {
 		h.cache = nil
 	}
 
+	if h.vms != nil {
+		h.vms.close()
+	}
+
 	return nil
 }
 
-// IsReady returns true if the hasher is ready to compute hashes.
+// IsReady returns true if the hasher is ready to compute hashes. In
+// AutoMode that is the case before the dataset is complete; use Status to
+// find out whether hashes are served from the cache or the dataset.
 func (h *Hasher) IsReady() bool {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -0,0 +1,40 @@
+package randomx
+
+import "sync/atomic"
+
+// refCount is the reference count shared by Cache and Dataset. An object
+// starts with one reference held by its creator; the resources are freed
+// when the count drops to zero.
+type refCount struct {
+	n atomic.Int64
+}
+
+// init sets the count to one reference for the creator.
+func (r *refCount) init() {
+	r.n.Store(1)
+}
+
+// retain adds a reference. It reports false if the object has already
+// been freed, in which case no reference is taken.
+func (r *refCount) retain() bool {
+	for {
+		n := r.n.Load()
+		if n <= 0 {
+			return false
+		}
+		if r.n.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// release drops a reference and reports whether it was the last one.
+// Like a negative sync.WaitGroup counter, releasing more references than
+// were taken is a programming error and panics.
+func (r *refCount) release(what string) bool {
+	n := r.n.Add(-1)
+	if n < 0 {
+		panic("randomx: " + what + " released more times than retained")
+	}
+	return n == 0
+}
@@ -0,0 +1,70 @@
+package randomx
+
+import (
+	"errors"
+	"testing"
+)
+
+// Test reference counting on a small stand-in dataset
+func TestDatasetRefCount(t *testing.T) {
+	d := &Dataset{ds: &dataset{data: make([]byte, 64)}}
+	d.refs.init()
+
+	if err := d.Retain(); err != nil {
+		t.Fatalf("Retain() error = %v", err)
+	}
+
+	d.Release()
+	if d.ds.data == nil {
+		t.Fatal("dataset freed while a reference is still held")
+	}
+
+	d.Release()
+	if d.ds.data != nil {
+		t.Fatal("dataset not freed after the last reference was released")
+	}
+
+	if err := d.Retain(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Retain() after free error = %v, want ErrClosed", err)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Release() of a freed dataset should panic")
+		}
+	}()
+	d.Release()
+}
+
+// Test that a VM keeps its dataset alive until it is closed
+func TestVMDatasetReference(t *testing.T) {
+	d := &Dataset{ds: &dataset{data: make([]byte, 64)}}
+	d.refs.init()
+
+	vm, err := NewVM(nil, d, FlagDefault)
+	if err != nil {
+		t.Fatalf("NewVM() error = %v", err)
+	}
+
+	d.Release()
+	if d.ds.data == nil {
+		t.Fatal("dataset freed while a VM still uses it")
+	}
+
+	if err := vm.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if d.ds.data != nil {
+		t.Error("dataset not freed after the VM was closed")
+	}
+	if err := vm.Close(); !errors.Is(err, ErrClosed) {
+		t.Errorf("second Close() error = %v, want ErrClosed", err)
+	}
+
+	if _, err := NewVM(nil, nil, FlagDefault); err == nil {
+		t.Error("NewVM(nil, nil) should fail")
+	}
+	if _, err := NewVM(nil, d, FlagDefault); !errors.Is(err, ErrClosed) {
+		t.Errorf("NewVM() with a freed dataset error = %v, want ErrClosed", err)
+	}
+}
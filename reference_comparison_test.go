@@ -152,8 +152,8 @@ func validateSuperscalarPrograms(t *testing.T) {
 		t.Error("Program has no instructions")
 	}
 
-	if len(prog.instructions) > 60 {
-		t.Errorf("Program has too many instructions: %d (max 60)", len(prog.instructions))
+	if len(prog.instructions) > superscalarMaxSize {
+		t.Errorf("Program has too many instructions: %d (max %d)", len(prog.instructions), superscalarMaxSize)
 	}
 
 	if prog.addressReg > 7 {
@@ -0,0 +1,152 @@
+package randomx
+
+import "math"
+
+// roundingMode is an IEEE 754 rounding mode, as held by the RandomX fprc
+// register. The values are those of the spec, which are also the x86
+// MXCSR rounding control bits.
+type roundingMode uint8
+
+const (
+	roundNearest roundingMode = iota // to nearest, ties to even
+	roundDown                        // toward negative infinity
+	roundUp                          // toward positive infinity
+	roundZero                        // toward zero
+)
+
+// The float operations below give the correctly rounded result of an
+// IEEE 754 double operation in any rounding mode, without changing the
+// hardware rounding mode. Each computes the result rounded to nearest,
+// works out the sign of the rounding error exactly, and steps one unit
+// in the last place if the mode rounds the other way. The explicit
+// float64 conversions stop the compiler from fusing a multiplication
+// with a later addition on architectures with FMA instructions, so the
+// results are the same everywhere.
+
+// fpAdd returns a + b rounded in mode.
+func fpAdd(a, b float64, mode roundingMode) float64 {
+	r := float64(a + b)
+	if mode == roundNearest || math.IsNaN(r) {
+		return r
+	}
+	if math.IsInf(r, 0) {
+		if math.IsInf(a, 0) || math.IsInf(b, 0) {
+			return r
+		}
+		return roundOverflow(r, mode)
+	}
+	if r == 0 {
+		// A zero sum is exact. It is -0 when rounding down unless both
+		// operands are +0.
+		if mode == roundDown && (math.Signbit(a) || math.Signbit(b) || a != 0 || b != 0) {
+			return math.Copysign(0, -1)
+		}
+		return r
+	}
+
+	// Knuth's TwoSum gives the exact error of the rounded sum.
+	bb := float64(r - a)
+	err := float64(a-float64(r-bb)) + float64(b-bb)
+	return roundDirected(r, sign(err), mode)
+}
+
+// fpSub returns a - b rounded in mode.
+func fpSub(a, b float64, mode roundingMode) float64 {
+	return fpAdd(a, -b, mode)
+}
+
+// fpMul returns a * b rounded in mode.
+func fpMul(a, b float64, mode roundingMode) float64 {
+	r := float64(a * b)
+	if mode == roundNearest || math.IsNaN(r) || a == 0 || b == 0 || math.IsInf(a, 0) || math.IsInf(b, 0) {
+		return r
+	}
+	if math.IsInf(r, 0) {
+		return roundOverflow(r, mode)
+	}
+
+	// Scale the operands to [0.5, 1) so the error term of their
+	// product cannot underflow, and scale r the same way; both scalings
+	// are exact. hi - rs is exact because hi and rs are within a factor
+	// of two, or rs is zero.
+	ma, ea := math.Frexp(a)
+	mb, eb := math.Frexp(b)
+	hi := float64(ma * mb)
+	lo := math.FMA(ma, mb, -hi)
+	rs := math.Ldexp(r, -(ea + eb))
+	return roundDirected(r, sign(float64(hi-rs)+lo), mode)
+}
+
+// fpDiv returns a / b rounded in mode.
+func fpDiv(a, b float64, mode roundingMode) float64 {
+	r := float64(a / b)
+	if mode == roundNearest || math.IsNaN(r) || a == 0 || b == 0 || math.IsInf(a, 0) || math.IsInf(b, 0) {
+		return r
+	}
+	if math.IsInf(r, 0) {
+		return roundOverflow(r, mode)
+	}
+
+	// With the operands scaled as in fpMul, the remainder ma - rs*mb is
+	// exact, and its sign times the sign of b is the sign of the error.
+	ma, ea := math.Frexp(a)
+	mb, eb := math.Frexp(b)
+	rs := math.Ldexp(r, -(ea - eb))
+	rem := math.FMA(-rs, mb, ma)
+	s := sign(rem)
+	if b < 0 {
+		s = -s
+	}
+	return roundDirected(r, s, mode)
+}
+
+// fpSqrt returns the square root of a rounded in mode.
+func fpSqrt(a float64, mode roundingMode) float64 {
+	r := math.Sqrt(a)
+	if mode == roundNearest || math.IsNaN(r) || a == 0 || math.IsInf(a, 0) {
+		return r
+	}
+
+	// Scale a by an even power of two to [0.5, 2) so the remainder
+	// m - rs*rs is exact.
+	m, e := math.Frexp(a)
+	if e&1 != 0 {
+		m *= 2
+		e--
+	}
+	rs := math.Ldexp(r, -e/2)
+	return roundDirected(r, sign(math.FMA(-rs, rs, m)), mode)
+}
+
+// roundDirected adjusts r, the result of an operation rounded to nearest,
+// to mode, given the sign of the exact result minus r.
+func roundDirected(r float64, errSign int, mode roundingMode) float64 {
+	switch {
+	case errSign > 0 && (mode == roundUp || mode == roundZero && r < 0):
+		return math.Nextafter(r, math.Inf(1))
+	case errSign < 0 && (mode == roundDown || mode == roundZero && r > 0):
+		return math.Nextafter(r, math.Inf(-1))
+	}
+	return r
+}
+
+// roundOverflow returns the result of an operation that overflowed to r
+// when rounded to nearest: the largest finite value of the same sign
+// unless mode rounds away from zero in that direction.
+func roundOverflow(r float64, mode roundingMode) float64 {
+	if mode == roundZero || (mode == roundDown) == (r > 0) {
+		return math.Copysign(math.MaxFloat64, r)
+	}
+	return r
+}
+
+// sign returns -1, 0 or 1 for the sign of x.
+func sign(x float64) int {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,223 @@
+package randomx
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+// modes lists the rounding modes in fprc order with their math/big
+// equivalents.
+var modes = []struct {
+	mode roundingMode
+	big  big.RoundingMode
+}{
+	{roundNearest, big.ToNearestEven},
+	{roundDown, big.ToNegativeInf},
+	{roundUp, big.ToPositiveInf},
+	{roundZero, big.ToZero},
+}
+
+// Test each operation against results worked out by hand, in all four
+// modes: [nearest, down, up, zero]
+func TestRoundingVectors(t *testing.T) {
+	const (
+		one      = 0x3FF0000000000000
+		oneUlp   = 0x3FF0000000000001 // 1 + 2^-52
+		twoUlp   = 0x3FF0000000000002 // 1 + 2^-51
+		belowOne = 0x3FEFFFFFFFFFFFFF // 1 - 2^-53
+		max      = 0x7FEFFFFFFFFFFFFF
+		inf      = 0x7FF0000000000000
+		negZero  = 0x8000000000000000
+		tiny     = 0x0000000000000001 // 2^-1074
+	)
+	f := math.Float64frombits
+	tests := []struct {
+		name string
+		op   func(roundingMode) float64
+		want [4]uint64
+	}{
+		// Exact results do not depend on the mode.
+		{"1.5+0.25", func(m roundingMode) float64 { return fpAdd(1.5, 0.25, m) },
+			[4]uint64{0x3FFC000000000000, 0x3FFC000000000000, 0x3FFC000000000000, 0x3FFC000000000000}},
+		// 1 + 2^-53 is halfway between 1 and 1 + 2^-52.
+		{"1+2^-53", func(m roundingMode) float64 { return fpAdd(1, 0x1p-53, m) },
+			[4]uint64{one, one, oneUlp, one}},
+		{"-1-2^-53", func(m roundingMode) float64 { return fpSub(-1, 0x1p-53, m) },
+			[4]uint64{1<<63 | one, 1<<63 | oneUlp, 1<<63 | one, 1<<63 | one}},
+		// 1 - 2^-54 is halfway between 1 - 2^-53 and 1.
+		{"1-2^-54", func(m roundingMode) float64 { return fpSub(1, 0x1p-54, m) },
+			[4]uint64{one, belowOne, one, belowOne}},
+		// An exact zero sum is -0 only when rounding down.
+		{"1-1", func(m roundingMode) float64 { return fpSub(1, 1, m) },
+			[4]uint64{0, negZero, 0, 0}},
+		{"0+0", func(m roundingMode) float64 { return fpAdd(0, 0, m) },
+			[4]uint64{0, 0, 0, 0}},
+		{"max+max", func(m roundingMode) float64 { return fpAdd(math.MaxFloat64, math.MaxFloat64, m) },
+			[4]uint64{inf, max, inf, max}},
+		// (1 + 2^-52)^2 = 1 + 2^-51 + 2^-104
+		{"(1+2^-52)^2", func(m roundingMode) float64 { return fpMul(f(oneUlp), f(oneUlp), m) },
+			[4]uint64{twoUlp, twoUlp, twoUlp + 1, twoUlp}},
+		{"-(1+2^-52)^2", func(m roundingMode) float64 { return fpMul(-f(oneUlp), f(oneUlp), m) },
+			[4]uint64{1<<63 | twoUlp, 1<<63 | twoUlp + 1, 1<<63 | twoUlp, 1<<63 | twoUlp}},
+		{"-max*2", func(m roundingMode) float64 { return fpMul(-math.MaxFloat64, 2, m) },
+			[4]uint64{1<<63 | inf, 1<<63 | inf, 1<<63 | max, 1<<63 | max}},
+		// Half the smallest subnormal is a tie between 0 and 2^-1074.
+		{"2^-1074*0.5", func(m roundingMode) float64 { return fpMul(f(tiny), 0.5, m) },
+			[4]uint64{0, 0, tiny, 0}},
+		{"1/3", func(m roundingMode) float64 { return fpDiv(1, 3, m) },
+			[4]uint64{0x3FD5555555555555, 0x3FD5555555555555, 0x3FD5555555555556, 0x3FD5555555555555}},
+		{"-1/3", func(m roundingMode) float64 { return fpDiv(-1, 3, m) },
+			[4]uint64{0xBFD5555555555555, 0xBFD5555555555556, 0xBFD5555555555555, 0xBFD5555555555555}},
+		{"2/-3", func(m roundingMode) float64 { return fpDiv(2, -3, m) },
+			[4]uint64{0xBFE5555555555555, 0xBFE5555555555556, 0xBFE5555555555555, 0xBFE5555555555555}},
+		{"1/0", func(m roundingMode) float64 { return fpDiv(1, 0, m) },
+			[4]uint64{inf, inf, inf, inf}},
+		{"2^-1074/3", func(m roundingMode) float64 { return fpDiv(f(tiny), 3, m) },
+			[4]uint64{0, 0, tiny, 0}},
+		// sqrt(2) = 1.41421356237309504880..., just below the nearest
+		// double 0x3FF6A09E667F3BCD.
+		{"sqrt(2)", func(m roundingMode) float64 { return fpSqrt(2, m) },
+			[4]uint64{0x3FF6A09E667F3BCD, 0x3FF6A09E667F3BCC, 0x3FF6A09E667F3BCD, 0x3FF6A09E667F3BCC}},
+		{"sqrt(4)", func(m roundingMode) float64 { return fpSqrt(4, m) },
+			[4]uint64{0x4000000000000000, 0x4000000000000000, 0x4000000000000000, 0x4000000000000000}},
+		{"sqrt(2^-1074)", func(m roundingMode) float64 { return fpSqrt(f(tiny), m) },
+			[4]uint64{0x1E60000000000000, 0x1E60000000000000, 0x1E60000000000000, 0x1E60000000000000}},
+		{"sqrt(3*2^-1074)", func(m roundingMode) float64 { return fpSqrt(f(3), m) },
+			[4]uint64{0x1E6BB67AE8584CAA, 0x1E6BB67AE8584CAA, 0x1E6BB67AE8584CAB, 0x1E6BB67AE8584CAA}},
+	}
+	for _, tt := range tests {
+		for i, m := range modes {
+			if got := math.Float64bits(tt.op(m.mode)); got != tt.want[i] {
+				t.Errorf("%s in mode %d = %#016x, want %#016x", tt.name, m.mode, got, tt.want[i])
+			}
+		}
+	}
+}
+
+// randomFloat returns a random double with an exponent in [-limit, limit].
+func randomFloat(rng *rand.Rand, limit int) float64 {
+	f := math.Ldexp(1+rng.Float64(), rng.Intn(2*limit+1)-limit)
+	if rng.Intn(2) == 0 {
+		f = -f
+	}
+	return f
+}
+
+// Test the operations against math/big on random operands, including
+// results that overflow or are subnormal
+func TestRoundingMatchesBig(t *testing.T) {
+	n := 20000
+	if testing.Short() {
+		n = 2000
+	}
+	rng := rand.New(rand.NewSource(1))
+
+	ops := []struct {
+		name string
+		fp   func(a, b float64, m roundingMode) float64
+		big  func(z, x, y *big.Float) *big.Float
+	}{
+		{"add", fpAdd, (*big.Float).Add},
+		{"sub", fpSub, (*big.Float).Sub},
+		{"mul", fpMul, (*big.Float).Mul},
+		{"div", fpDiv, (*big.Float).Quo},
+		{"sqrt", func(a, _ float64, m roundingMode) float64 { return fpSqrt(math.Abs(a), m) },
+			func(z, x, _ *big.Float) *big.Float { return z.Sqrt(new(big.Float).Abs(x)) }},
+	}
+	for i := 0; i < n; i++ {
+		// Mostly small exponents, so additions round, and sometimes
+		// the whole range, so results overflow and underflow.
+		limit := 60
+		if i%4 == 0 {
+			limit = 1023
+		}
+		a, b := randomFloat(rng, limit), randomFloat(rng, limit)
+		if i%8 == 1 {
+			// Subnormal operands
+			a = math.Float64frombits(rng.Uint64() & (1<<52 - 1))
+		}
+
+		for _, op := range ops {
+			for _, m := range modes {
+				got := op.fp(a, b, m.mode)
+				want, ok := bigResult(op.big, a, b, m.big)
+				if !ok {
+					continue
+				}
+				if math.Float64bits(got) != math.Float64bits(want) {
+					t.Fatalf("%s(%v, %v) in mode %d = %v (%#x), want %v (%#x)",
+						op.name, a, b, m.mode, got, math.Float64bits(got), want, math.Float64bits(want))
+				}
+			}
+		}
+	}
+}
+
+// bigResult computes op(a, b) with math/big and rounds it to a double in
+// mode, including the narrower precision of subnormals and overflow to
+// infinity or the largest double. It returns false for results it cannot
+// give: zeros, whose sign is set by IEEE 754 rules, and results below the
+// smallest subnormal.
+func bigResult(op func(z, x, y *big.Float) *big.Float, a, b float64, mode big.RoundingMode) (float64, bool) {
+	// Sums and products of doubles are exact at this precision. The
+	// quotient and square root are not, but they cannot be close enough
+	// to a tie for rounding twice to change the result.
+	z := new(big.Float).SetPrec(2200).SetMode(mode)
+	op(z, big.NewFloat(a), big.NewFloat(b))
+	if z.Sign() == 0 {
+		return 0, false
+	}
+
+	// A double has 53 bits of precision down to 2^-1022 and fewer below.
+	prec := 53
+	if exp := z.MantExp(nil); exp < -1021 {
+		prec = exp + 1074
+		if prec <= 0 {
+			return 0, false
+		}
+	}
+	// Sqrt resets the mode.
+	z.SetMode(mode).SetPrec(uint(prec))
+	f, _ := z.Float64()
+	if math.IsInf(f, 0) && (mode == big.ToZero || mode == big.ToNegativeInf && f > 0 || mode == big.ToPositiveInf && f < 0) {
+		return math.Copysign(math.MaxFloat64, f), true
+	}
+	return f, true
+}
+
+// Test that CFROUND takes the mode from the rotated source register and
+// that later float instructions round in it
+func TestCFROUND(t *testing.T) {
+	cfround := opcodeOf(t, instrCFROUND)
+	fmul := opcodeOf(t, instrFMUL_R)
+
+	for _, imm := range []uint32{10, 10 + 64} {
+		vm := &virtualMachine{mem: make([]byte, scratchpadL3Size)}
+		vm.reg[3] = uint64(roundUp)<<10 | 1<<9 | 1<<12
+		vm.regE[0][0] = math.Float64frombits(0x3FF0000000000001)
+		vm.regA[1][0] = math.Float64frombits(0x3FF0000000000001)
+
+		p := nopProgram(t, map[int]instruction{
+			0: {opcode: cfround, src: 3, imm: imm},
+			1: {opcode: fmul, dst: 0, src: 1},
+		})
+		p.execute(vm)
+
+		if vm.fprc != roundUp {
+			t.Errorf("imm %d: fprc = %d, want %d", imm, vm.fprc, roundUp)
+		}
+		// (1 + 2^-52)^2 rounded up
+		if got, want := math.Float64bits(vm.regE[0][0]), uint64(0x3FF0000000000003); got != want {
+			t.Errorf("imm %d: e0 = %#x, want %#x", imm, got, want)
+		}
+	}
+
+	// Each hash starts rounding to nearest.
+	vm := &virtualMachine{fprc: roundZero}
+	vm.resetRegisters()
+	if vm.fprc != roundNearest {
+		t.Errorf("fprc after resetRegisters = %d, want %d", vm.fprc, roundNearest)
+	}
+}
@@ -208,7 +208,7 @@ func TestSuperscalarExecution_AddRS(t *testing.T) {
 	
 	prog := &superscalarProgram{
 		instructions: []superscalarInstruction{
-			{opcode: ssIADD_RS, dst: 0, src: 1, mod: 2}, // r0 += r1 << 2
+			{opcode: ssIADD_RS, dst: 0, src: 1, mod: 2 << 2}, // r0 += r1 << 2, shift in mod bits 2-3
 		},
 	}
 	
@@ -223,23 +223,20 @@ func TestSuperscalarExecution_AddRS(t *testing.T) {
 // TestReciprocal verifies the reciprocal function.
 func TestReciprocal(t *testing.T) {
 	tests := []struct {
-		divisor uint32
-		// We can't test exact values without C++ reference,
-		// but we can test that function runs without panic
+		divisor  uint32
+		expected uint64 // floor(2^(63+bits) / divisor)
 	}{
-		{divisor: 2},
-		{divisor: 12345},
-		{divisor: 3},
-		{divisor: 0x7FFFFFFF},
+		{divisor: 3, expected: 0xAAAAAAAAAAAAAAAA},          // 2^65 / 3
+		{divisor: 5, expected: 0xCCCCCCCCCCCCCCCC},          // 2^66 / 5
+		{divisor: 7, expected: 0x9249249249249249},          // 2^66 / 7
+		{divisor: 0x7FFFFFFF, expected: 0x8000000100000002}, // 2^63 + 2^32 + 2 + 2^-30...
+		{divisor: 0xFFFFFFFF, expected: 0x8000000080000000}, // 2^63 + 2^31 + 2^-1...
 	}
 	
 	for _, tt := range tests {
-		// Just verify it doesn't panic and returns something
-		rcp := reciprocal(tt.divisor)
-		
-		// For most divisors > 1, reciprocal should produce a value
-		// (some edge cases with large divisors may return 0 due to shift overflow)
-		_ = rcp
+		if rcp := reciprocal(tt.divisor); rcp != tt.expected {
+			t.Errorf("reciprocal(%d) = %#x, expected %#x", tt.divisor, rcp, tt.expected)
+		}
 	}
 }
 
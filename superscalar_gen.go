@@ -18,20 +18,32 @@ const (
 	portP015 executionPort = portP0 | portP1 | portP5
 )
 
+// Generator limits (from superscalar.cpp)
+const (
+	cycleMapSize      = superscalarLatency + 4
+	lookForwardCycles = 4   // cycles to wait for a ready operand
+	maxThrowawayCount = 256 // instructions thrown away in a row before giving up on a buffer
+
+	// registerNeedsDisplacement cannot be the destination of IADD_RS,
+	// which compiles to lea.
+	registerNeedsDisplacement = 5
+)
+
 // registerInfo tracks register state during program generation
 type registerInfo struct {
-	latency   int  // Cycle when this register will be ready
-	lastOpGroup int  // Last operation group that wrote to this register (for dependency tracking)
+	latency     int // Cycle when this register will be ready
+	lastOpGroup int // Group of the last operation that wrote to this register
+	lastOpPar   int // Its parameter: source register, -1 for a constant, or random
 }
 
 // macroOp represents a macro-operation (one or more micro-ops)
 type macroOp struct {
 	name      string
-	size      int   // Code size in bytes
-	latency   int   // Execution latency in cycles
+	size      int // Code size in bytes
+	latency   int // Execution latency in cycles
 	uop1      executionPort
 	uop2      executionPort
-	dependent bool  // Whether this op depends on the previous op
+	dependent bool // Whether this op depends on the previous op
 }
 
 // isSimple returns true if this is a single micro-op
@@ -47,22 +59,22 @@ func (m *macroOp) isEliminated() bool {
 // Macro-operations for different instruction types
 var (
 	// 3-byte instructions
-	macroOpAddRR  = macroOp{"add r,r", 3, 1, portP015, portNull, false}
-	macroOpSubRR  = macroOp{"sub r,r", 3, 1, portP015, portNull, false}
-	macroOpXorRR  = macroOp{"xor r,r", 3, 1, portP015, portNull, false}
-	macroOpImulR  = macroOp{"imul r", 3, 4, portP1, portP5, false}
-	macroOpMulR   = macroOp{"mul r", 3, 4, portP1, portP5, false}
-	macroOpMovRR  = macroOp{"mov r,r", 3, 0, portNull, portNull, false}
-	
+	macroOpAddRR = macroOp{"add r,r", 3, 1, portP015, portNull, false}
+	macroOpSubRR = macroOp{"sub r,r", 3, 1, portP015, portNull, false}
+	macroOpXorRR = macroOp{"xor r,r", 3, 1, portP015, portNull, false}
+	macroOpImulR = macroOp{"imul r", 3, 4, portP1, portP5, false}
+	macroOpMulR  = macroOp{"mul r", 3, 4, portP1, portP5, false}
+	macroOpMovRR = macroOp{"mov r,r", 3, 0, portNull, portNull, false}
+
 	// 4-byte instructions
 	macroOpLeaSIB = macroOp{"lea r,r+r*s", 4, 1, portP01, portNull, false}
 	macroOpImulRR = macroOp{"imul r,r", 4, 3, portP1, portNull, false}
 	macroOpRorRI  = macroOp{"ror r,i", 4, 1, portP05, portNull, false}
-	
+
 	// 7-byte instructions (can be padded to 8 or 9 bytes)
 	macroOpAddRI = macroOp{"add r,i", 7, 1, portP015, portNull, false}
 	macroOpXorRI = macroOp{"xor r,i", 7, 1, portP015, portNull, false}
-	
+
 	// 10-byte instructions
 	macroOpMovRI64 = macroOp{"mov rax,i64", 10, 1, portP015, portNull, false}
 )
@@ -72,374 +84,475 @@ type superscalarInstrInfo struct {
 	name      string
 	instrType uint8
 	ops       []macroOp
-	latency   int
-	resultOp  int  // Which macro-op produces the result
-	dstOp     int  // Which macro-op needs the destination register
-	srcOp     int  // Which macro-op needs the source register
+	resultOp  int // Which macro-op produces the result
+	dstOp     int // Which macro-op needs the destination register
+	srcOp     int // Which macro-op needs the source register, or -1
 }
 
-// Instruction information for each superscalar instruction type
-var superscalarInstrInfos = []superscalarInstrInfo{
-	// ISUB_R
-	{
-		name:      "ISUB_R",
-		instrType: ssISUB_R,
-		ops:       []macroOp{macroOpSubRR},
-		latency:   1,
-		resultOp:  0,
-		dstOp:     0,
-		srcOp:     0,
-	},
-	// IXOR_R
-	{
-		name:      "IXOR_R",
-		instrType: ssIXOR_R,
-		ops:       []macroOp{macroOpXorRR},
-		latency:   1,
-		resultOp:  0,
-		dstOp:     0,
-		srcOp:     0,
-	},
-	// IADD_RS
-	{
-		name:      "IADD_RS",
-		instrType: ssIADD_RS,
-		ops:       []macroOp{macroOpLeaSIB},
-		latency:   1,
-		resultOp:  0,
-		dstOp:     0,
-		srcOp:     0,
-	},
-	// IMUL_R
-	{
-		name:      "IMUL_R",
-		instrType: ssIMUL_R,
-		ops:       []macroOp{macroOpImulRR},
-		latency:   3,
-		resultOp:  0,
-		dstOp:     0,
-		srcOp:     0,
-	},
-	// IROR_C
-	{
-		name:      "IROR_C",
-		instrType: ssIROR_C,
-		ops:       []macroOp{macroOpRorRI},
-		latency:   1,
-		resultOp:  0,
-		dstOp:     0,
-		srcOp:     -1, // No source register
-	},
-	// IADD_C7/C8/C9
-	{
-		name:      "IADD_C",
-		instrType: ssIADD_C7,
-		ops:       []macroOp{macroOpAddRI},
-		latency:   1,
-		resultOp:  0,
-		dstOp:     0,
-		srcOp:     -1,
-	},
-	// IXOR_C7/C8/C9
-	{
-		name:      "IXOR_C",
-		instrType: ssIXOR_C7,
-		ops:       []macroOp{macroOpXorRI},
-		latency:   1,
-		resultOp:  0,
-		dstOp:     0,
-		srcOp:     -1,
-	},
-	// IMULH_R
-	{
-		name:      "IMULH_R",
-		instrType: ssIMULH_R,
-		ops:       []macroOp{macroOpMovRR, macroOpMulR, macroOpMovRR},
-		latency:   3,
-		resultOp:  2,
-		dstOp:     0,
-		srcOp:     1,
-	},
-	// ISMULH_R
-	{
-		name:      "ISMULH_R",
-		instrType: ssISMULH_R,
-		ops:       []macroOp{macroOpMovRR, macroOpImulR, macroOpMovRR},
-		latency:   3,
-		resultOp:  2,
-		dstOp:     0,
-		srcOp:     1,
-	},
-	// IMUL_RCP
-	{
-		name:      "IMUL_RCP",
-		instrType: ssIMUL_RCP,
-		ops:       []macroOp{macroOpMovRI64, macroOp{name: "imul r,r (dependent)", size: 4, latency: 3, uop1: portP1, uop2: portNull, dependent: true}},
-		latency:   4,
-		resultOp:  1,
-		dstOp:     1,
-		srcOp:     -1,
-	},
+// Instruction information for each superscalar instruction type, indexed
+// by type
+var superscalarInstrInfos = [ssCount]superscalarInstrInfo{
+	ssISUB_R:   {"ISUB_R", ssISUB_R, []macroOp{macroOpSubRR}, 0, 0, 0},
+	ssIXOR_R:   {"IXOR_R", ssIXOR_R, []macroOp{macroOpXorRR}, 0, 0, 0},
+	ssIADD_RS:  {"IADD_RS", ssIADD_RS, []macroOp{macroOpLeaSIB}, 0, 0, 0},
+	ssIMUL_R:   {"IMUL_R", ssIMUL_R, []macroOp{macroOpImulRR}, 0, 0, 0},
+	ssIROR_C:   {"IROR_C", ssIROR_C, []macroOp{macroOpRorRI}, 0, 0, -1},
+	ssIADD_C7:  {"IADD_C7", ssIADD_C7, []macroOp{macroOpAddRI}, 0, 0, -1},
+	ssIXOR_C7:  {"IXOR_C7", ssIXOR_C7, []macroOp{macroOpXorRI}, 0, 0, -1},
+	ssIADD_C8:  {"IADD_C8", ssIADD_C8, []macroOp{macroOpAddRI}, 0, 0, -1},
+	ssIXOR_C8:  {"IXOR_C8", ssIXOR_C8, []macroOp{macroOpXorRI}, 0, 0, -1},
+	ssIADD_C9:  {"IADD_C9", ssIADD_C9, []macroOp{macroOpAddRI}, 0, 0, -1},
+	ssIXOR_C9:  {"IXOR_C9", ssIXOR_C9, []macroOp{macroOpXorRI}, 0, 0, -1},
+	ssIMULH_R:  {"IMULH_R", ssIMULH_R, []macroOp{macroOpMovRR, macroOpMulR, macroOpMovRR}, 1, 0, 1},
+	ssISMULH_R: {"ISMULH_R", ssISMULH_R, []macroOp{macroOpMovRR, macroOpImulR, macroOpMovRR}, 1, 0, 1},
+	ssIMUL_RCP: {"IMUL_RCP", ssIMUL_RCP, []macroOp{macroOpMovRI64, {"imul r,r", 4, 3, portP1, portNull, true}}, 1, 1, -1},
 }
 
-// generateSuperscalarProgram generates a random superscalar program using Blake2Generator.
-// This is the main entry point that orchestrates the full algorithm.
-// It implements the RandomX SuperscalarHash program generation algorithm with proper
-// CPU scheduling simulation and dependency tracking.
-func generateSuperscalarProgram(gen *blake2Generator) *superscalarProgram {
-	prog := &superscalarProgram{
-		instructions: make([]superscalarInstruction, 0, superscalarMaxSize),
+// nopInstrInfo has no macro-ops. It is the instruction before the first
+// and after an abandoned decode buffer.
+var nopInstrInfo = superscalarInstrInfo{name: "NOP", instrType: 0xFF, srcOp: -1}
+
+// decodeBuffer is one way of splitting a 16-byte decode window into 3 or 4
+// x86 instructions of the given sizes. Slots of 8 or 9 bytes hold 7-byte
+// instructions padded with a nop.
+type decodeBuffer struct {
+	name   string
+	index  int
+	counts []int
+}
+
+var (
+	decodeBuffer484  = &decodeBuffer{"4,8,4", 0, []int{4, 8, 4}}
+	decodeBuffer7333 = &decodeBuffer{"7,3,3,3", 1, []int{7, 3, 3, 3}}
+	decodeBuffer3733 = &decodeBuffer{"3,7,3,3", 2, []int{3, 7, 3, 3}}
+	decodeBuffer493  = &decodeBuffer{"4,9,3", 3, []int{4, 9, 3}}
+	decodeBuffer4444 = &decodeBuffer{"4,4,4,4", 4, []int{4, 4, 4, 4}}
+	decodeBuffer3310 = &decodeBuffer{"3,3,10", 5, []int{3, 3, 10}}
+
+	decodeBuffers = [4]*decodeBuffer{decodeBuffer484, decodeBuffer7333, decodeBuffer3733, decodeBuffer493}
+)
+
+// fetchNextBuffer selects the decode buffer after the one holding the
+// last instruction of type instrType.
+func fetchNextBuffer(instrType uint8, cycle, mulCount int, gen *blake2Generator) *decodeBuffer {
+	// The 128-bit multiplication decodes to 2 uops, and Intel CPUs decode
+	// at most 4 uops per cycle, so it is followed by a 3-3-10 buffer.
+	if instrType == ssIMULH_R || instrType == ssISMULH_R {
+		return decodeBuffer3310
 	}
-	
-	// Track register state during generation
-	var registers [8]registerInfo
-	
-	// Execution port state (tracks cycle availability)
-	var portBusy [3]int // P0, P1, P5
-	
-	// Current CPU cycle
-	cycle := 0
-	
-	// Current operation group for dependency tracking
-	opGroup := 0
-	
-	// Generate instructions until we reach target latency
-	for cycle < superscalarLatency {
-		// Try to issue as many instructions as possible in this cycle
-		issued := false
-		
-		// Select instruction type based on current state
-		instrIdx := selectInstructionType(gen, cycle, &registers, portBusy[:])
-		if instrIdx >= 0 && instrIdx < len(superscalarInstrInfos) {
-			info := &superscalarInstrInfos[instrIdx]
-			
-			// Check if we can generate this instruction
-			if canGenerateInstruction(info, gen, cycle, &registers, portBusy[:]) {
-				instr := generateInstructionForType(info, gen, cycle, &registers, opGroup)
-				if instr != nil {
-					// Add to program
-					prog.instructions = append(prog.instructions, *instr)
-					
-					// Schedule execution of macro-ops
-					scheduleInstruction(info, &registers, portBusy[:], &cycle, opGroup, instr)
-					
-					opGroup++
-					issued = true
-				}
-			}
-		}
-		
-		// Advance cycle if nothing was issued
-		if !issued {
-			cycle++
-		}
-		
-		// Safety check: prevent infinite loop
-		if len(prog.instructions) >= superscalarMaxSize || cycle > superscalarLatency*2 {
-			break
+
+	// Saturate the multiplication port while there are fewer
+	// multiplications than cycles.
+	if mulCount < cycle+1 {
+		return decodeBuffer4444
+	}
+
+	// The buffer after IMUL_RCP begins with a 4-byte multiplication slot.
+	if instrType == ssIMUL_RCP {
+		if gen.getByte()&1 != 0 {
+			return decodeBuffer484
 		}
+		return decodeBuffer493
 	}
-	
-	// Select address register (register with highest latency = most mixing)
-	prog.addressReg = selectAddressRegister(&registers)
-	
-	return prog
+
+	return decodeBuffers[gen.getByte()&3]
 }
 
-// selectInstructionType selects which instruction type to generate based on
-// current CPU state and available execution ports.
-func selectInstructionType(gen *blake2Generator, cycle int, registers *[8]registerInfo, portBusy []int) int {
-	// Get random byte to select instruction type
-	instrByte := gen.getByte()
-	
-	// Use weighted selection based on instruction frequency
-	// This matches the C++ reference distribution
-	switch instrByte % 28 {
-	case 0, 1, 2, 3:
-		return 0 // ISUB_R (common)
-	case 4, 5, 6, 7:
-		return 1 // IXOR_R (common)
-	case 8, 9, 10:
-		return 2 // IADD_RS (fairly common)
-	case 11, 12:
-		return 3 // IMUL_R (less common)
-	case 13, 14:
-		return 4 // IROR_C
-	case 15, 16:
-		return 5 // IADD_C
-	case 17, 18:
-		return 6 // IXOR_C
-	case 19:
-		return 7 // IMULH_R (expensive, rare)
-	case 20:
-		return 8 // ISMULH_R (expensive, rare)
-	case 21, 22, 23, 24, 25, 26, 27:
-		return 9 // IMUL_RCP (fairly common)
-	default:
-		return 1 // Default to IXOR_R
-	}
+// Instruction types that fit each slot size
+var (
+	slot3  = [2]uint8{ssISUB_R, ssIXOR_R}
+	slot3L = [4]uint8{ssISUB_R, ssIXOR_R, ssIMULH_R, ssISMULH_R}
+	slot4  = [2]uint8{ssIROR_C, ssIADD_RS}
+	slot7  = [2]uint8{ssIXOR_C7, ssIADD_C7}
+	slot8  = [2]uint8{ssIXOR_C8, ssIADD_C8}
+	slot9  = [2]uint8{ssIXOR_C9, ssIADD_C9}
+)
+
+// ssGenInstruction is an instruction being generated, with the operation
+// group used to avoid sequences that could be optimized away.
+type ssGenInstruction struct {
+	info       *superscalarInstrInfo
+	src, dst   int
+	mod        uint8
+	imm32      uint32
+	opGroup    int
+	opGroupPar int
+	canReuse   bool // dst may equal src
+	parIsSrc   bool // opGroupPar is the source register
 }
 
-// canGenerateInstruction checks if an instruction can be generated given current CPU state.
-func canGenerateInstruction(info *superscalarInstrInfo, gen *blake2Generator, cycle int, 
-	registers *[8]registerInfo, portBusy []int) bool {
-	
-	// Always allow simple instructions
-	if len(info.ops) == 1 && info.ops[0].isSimple() {
-		return true
-	}
-	
-	// Check if execution ports will be available
-	for _, op := range info.ops {
-		if op.isEliminated() {
-			continue
+// createForSlot creates an instruction whose first macro-op fits a slot
+// of slotSize bytes in buffer fetchType.
+func (s *ssGenInstruction) createForSlot(gen *blake2Generator, slotSize, fetchType int, isLast bool) {
+	switch slotSize {
+	case 3:
+		// The last slot may also hold a high multiplication.
+		if isLast {
+			s.create(slot3L[gen.getByte()&3], gen)
+		} else {
+			s.create(slot3[gen.getByte()&1], gen)
 		}
-		
-		// Check port availability (simplified check)
-		if op.uop1&portP0 != 0 && portBusy[0] > cycle {
-			return false
+	case 4:
+		// The first 3 slots of the 4-4-4-4 buffer are multiplications.
+		if fetchType == decodeBuffer4444.index && !isLast {
+			s.create(ssIMUL_R, gen)
+		} else {
+			s.create(slot4[gen.getByte()&1], gen)
 		}
-		if op.uop1&portP1 != 0 && portBusy[1] > cycle {
-			return false
+	case 7:
+		s.create(slot7[gen.getByte()&1], gen)
+	case 8:
+		s.create(slot8[gen.getByte()&1], gen)
+	case 9:
+		s.create(slot9[gen.getByte()&1], gen)
+	case 10:
+		s.create(ssIMUL_RCP, gen)
+	}
+}
+
+// create resets s to a new instruction of type typ and generates its
+// mod and immediate.
+func (s *ssGenInstruction) create(typ uint8, gen *blake2Generator) {
+	*s = ssGenInstruction{info: &superscalarInstrInfos[typ], src: -1, dst: -1}
+
+	switch typ {
+	case ssISUB_R:
+		s.opGroup = ssIADD_RS
+		s.parIsSrc = true
+
+	case ssIXOR_R, ssIMUL_R:
+		s.opGroup = int(typ)
+		s.parIsSrc = true
+
+	case ssIADD_RS:
+		s.mod = gen.getByte()
+		s.opGroup = ssIADD_RS
+		s.parIsSrc = true
+
+	case ssIROR_C:
+		for s.imm32 == 0 {
+			s.imm32 = uint32(gen.getByte() & 63)
 		}
-		if op.uop1&portP5 != 0 && portBusy[2] > cycle {
-			return false
+		s.opGroup = ssIROR_C
+		s.opGroupPar = -1
+
+	case ssIADD_C7, ssIADD_C8, ssIADD_C9:
+		s.imm32 = gen.getUint32()
+		s.opGroup = ssIADD_C7
+		s.opGroupPar = -1
+
+	case ssIXOR_C7, ssIXOR_C8, ssIXOR_C9:
+		s.imm32 = gen.getUint32()
+		s.opGroup = ssIXOR_C7
+		s.opGroupPar = -1
+
+	case ssIMULH_R, ssISMULH_R:
+		s.canReuse = true
+		s.opGroup = int(typ)
+		s.opGroupPar = int(int32(gen.getUint32()))
+
+	case ssIMUL_RCP:
+		s.imm32 = gen.getUint32()
+		for isZeroOrPowerOf2(s.imm32) {
+			s.imm32 = gen.getUint32()
 		}
+		s.opGroup = ssIMUL_RCP
+		s.opGroupPar = -1
 	}
-	
-	return true
 }
 
-// generateInstructionForType generates a specific instruction with proper operands.
-func generateInstructionForType(info *superscalarInstrInfo, gen *blake2Generator, 
-	cycle int, registers *[8]registerInfo, opGroup int) *superscalarInstruction {
-	
-	instr := &superscalarInstruction{
-		opcode: info.instrType,
+// selectDestination selects a destination register that is ready at
+// cycle. It cannot be the source unless the instruction allows it, cannot
+// be multiplied twice in a row unless allowChainedMul is set, cannot
+// repeat the last operation applied to it with the same parameter, and
+// cannot be r5 for IADD_RS.
+func (s *ssGenInstruction) selectDestination(cycle int, allowChainedMul bool, registers *[8]registerInfo, gen *blake2Generator) bool {
+	var available []int
+	for i := range registers {
+		ri := &registers[i]
+		if ri.latency <= cycle &&
+			(s.canReuse || i != s.src) &&
+			(allowChainedMul || s.opGroup != ssIMUL_R || ri.lastOpGroup != ssIMUL_R) &&
+			(ri.lastOpGroup != s.opGroup || ri.lastOpPar != s.opGroupPar) &&
+			(s.info.instrType != ssIADD_RS || i != registerNeedsDisplacement) {
+			available = append(available, i)
+		}
 	}
-	
-	// Select destination register
-	instr.dst = selectRegister(gen, registers, cycle, opGroup, info.dstOp >= 0)
-	
-	// Select source register (if needed)
-	if info.srcOp >= 0 {
-		instr.src = selectRegister(gen, registers, cycle, opGroup, true)
-		
-		// Ensure src != dst for most instructions
-		if instr.src == instr.dst && info.instrType != ssIMUL_RCP {
-			instr.src = (instr.src + 1) & 7
+	return selectRegister(available, gen, &s.dst)
+}
+
+// selectSource selects a source register that is ready at cycle.
+func (s *ssGenInstruction) selectSource(cycle int, registers *[8]registerInfo, gen *blake2Generator) bool {
+	var available []int
+	for i := range registers {
+		if registers[i].latency <= cycle {
+			available = append(available, i)
 		}
 	}
-	
-	// Generate immediate value if needed
-	if info.instrType >= ssIROR_C {
-		instr.imm32 = gen.getUint32()
-		
-		// Special handling for IMUL_RCP
-		if info.instrType == ssIMUL_RCP {
-			// Ensure non-zero divisor
-			if instr.imm32 == 0 {
-				instr.imm32 = 1
-			}
+
+	// If only 2 registers are ready for IADD_RS and one is r5, it must be
+	// the source because it cannot be the destination.
+	if len(available) == 2 && s.info.instrType == ssIADD_RS &&
+		(available[0] == registerNeedsDisplacement || available[1] == registerNeedsDisplacement) {
+		s.src = registerNeedsDisplacement
+		s.opGroupPar = registerNeedsDisplacement
+		return true
+	}
+
+	if selectRegister(available, gen, &s.src) {
+		if s.parIsSrc {
+			s.opGroupPar = s.src
 		}
+		return true
 	}
-	
-	// Generate mod field for IADD_RS
-	if info.instrType == ssIADD_RS {
-		instr.mod = gen.getByte()
+	return false
+}
+
+// toInstr returns the finished instruction. Instructions without a source
+// register use the destination.
+func (s *ssGenInstruction) toInstr() superscalarInstruction {
+	src := s.src
+	if src < 0 {
+		src = s.dst
+	}
+	return superscalarInstruction{
+		opcode: s.info.instrType,
+		dst:    uint8(s.dst),
+		src:    uint8(src),
+		mod:    s.mod,
+		imm32:  s.imm32,
 	}
-	
-	return instr
 }
 
-// selectRegister selects a register based on dependency and latency information.
-func selectRegister(gen *blake2Generator, registers *[8]registerInfo, 
-	cycle int, opGroup int, needsValue bool) uint8 {
-	
-	// Simple register selection with basic dependency awareness
-	attempts := 0
-	for attempts < 8 {
-		reg := gen.getByte() & 7
-		
-		// If we need the value, prefer registers that are ready
-		if needsValue && registers[reg].latency > cycle {
-			attempts++
-			continue
-		}
-		
-		return reg
+// selectRegister sets *reg to a random register from available. It
+// returns false if there is none.
+func selectRegister(available []int, gen *blake2Generator, reg *int) bool {
+	switch len(available) {
+	case 0:
+		return false
+	case 1:
+		*reg = available[0]
+	default:
+		*reg = available[gen.getUint32()%uint32(len(available))]
 	}
-	
-	// Fallback: return any register
-	return gen.getByte() & 7
+	return true
 }
 
-// scheduleInstruction updates CPU state after scheduling an instruction.
-func scheduleInstruction(info *superscalarInstrInfo, registers *[8]registerInfo, 
-	portBusy []int, cycle *int, opGroup int, instr *superscalarInstruction) {
-	
-	// Calculate when the instruction completes
-	completionCycle := *cycle + info.latency
-	
-	// Update destination register latency
-	registers[instr.dst].latency = completionCycle
-	registers[instr.dst].lastOpGroup = opGroup
-	
-	// Update port busy times (simplified scheduling)
-	for _, op := range info.ops {
-		if op.isEliminated() {
-			continue
-		}
-		
-		// Mark ports as busy
-		if op.uop1&portP0 != 0 {
-			portBusy[0] = max(portBusy[0], *cycle+op.latency)
-		}
-		if op.uop1&portP1 != 0 {
-			portBusy[1] = max(portBusy[1], *cycle+op.latency)
+// scheduleUop returns the first cycle from cycle on when a port of uop is
+// free, or -1. Ports are tried in the order P5, P0, P1 so that P1, the
+// only multiplication port, is kept for multiplications. If commit is set,
+// the port is marked busy.
+func scheduleUop(uop executionPort, portBusy *[cycleMapSize][3]executionPort, cycle int, commit bool) int {
+	for ; cycle < cycleMapSize; cycle++ {
+		for _, p := range [...]struct {
+			port  executionPort
+			index int
+		}{{portP5, 2}, {portP0, 0}, {portP1, 1}} {
+			if uop&p.port != 0 && portBusy[cycle][p.index] == portNull {
+				if commit {
+					portBusy[cycle][p.index] = uop
+				}
+				return cycle
+			}
 		}
-		if op.uop1&portP5 != 0 {
-			portBusy[2] = max(portBusy[2], *cycle+op.latency)
+	}
+	return -1
+}
+
+// scheduleMacroOp returns the first cycle from cycle on when mop can
+// execute, or -1. A dependent macro-op cannot start before depCycle, and
+// both uops of a 2-uop macro-op must execute in the same cycle.
+func scheduleMacroOp(mop *macroOp, portBusy *[cycleMapSize][3]executionPort, cycle, depCycle int, commit bool) int {
+	if mop.dependent && depCycle > cycle {
+		cycle = depCycle
+	}
+
+	// Moves are eliminated and need no execution unit.
+	if mop.isEliminated() {
+		return cycle
+	}
+	if mop.isSimple() {
+		return scheduleUop(mop.uop1, portBusy, cycle, commit)
+	}
+
+	for ; cycle < cycleMapSize; cycle++ {
+		cycle1 := scheduleUop(mop.uop1, portBusy, cycle, false)
+		cycle2 := scheduleUop(mop.uop2, portBusy, cycle, false)
+		if cycle1 >= 0 && cycle1 == cycle2 {
+			if commit {
+				scheduleUop(mop.uop1, portBusy, cycle1, true)
+				scheduleUop(mop.uop2, portBusy, cycle2, true)
+			}
+			return cycle1
 		}
-		
-		// Handle second micro-op if present
-		if op.uop2 != portNull {
-			if op.uop2&portP0 != 0 {
-				portBusy[0] = max(portBusy[0], *cycle+op.latency)
+	}
+	return -1
+}
+
+// isMultiplication reports whether typ executes on the multiplication port.
+func isMultiplication(typ uint8) bool {
+	return typ == ssIMUL_R || typ == ssIMULH_R || typ == ssISMULH_R || typ == ssIMUL_RCP
+}
+
+// generateSuperscalarProgram generates a random superscalar program using Blake2Generator.
+// This is the main entry point that orchestrates the full algorithm.
+// Each decode cycle decodes 16 bytes of x86 code, and instructions are
+// generated until an execution port is saturated, the latency is reached
+// or the program is full.
+func generateSuperscalarProgram(gen *blake2Generator) *superscalarProgram {
+	prog := &superscalarProgram{
+		instructions: make([]superscalarInstruction, 0, superscalarMaxSize),
+	}
+
+	var portBusy [cycleMapSize][3]executionPort
+	var registers [8]registerInfo
+	for i := range registers {
+		registers[i].lastOpGroup = -1
+		registers[i].lastOpPar = -1
+	}
+
+	current := ssGenInstruction{info: &nopInstrInfo}
+	macroOpIndex := 0
+	cycle := 0
+	depCycle := 0
+	portsSaturated := false
+	mulCount := 0
+	throwAwayCount := 0
+
+	for decodeCycle := 0; decodeCycle < superscalarLatency && !portsSaturated && len(prog.instructions) < superscalarMaxSize; decodeCycle++ {
+		buffer := fetchNextBuffer(current.info.instrType, decodeCycle, mulCount, gen)
+
+		// Fill all instruction slots in the decode buffer.
+		for bufferIndex := 0; bufferIndex < len(buffer.counts); {
+			topCycle := cycle
+
+			// Once all macro-ops of the current instruction are issued,
+			// create one whose first macro-op fits the slot.
+			if macroOpIndex >= len(current.info.ops) {
+				if portsSaturated || len(prog.instructions) >= superscalarMaxSize {
+					break
+				}
+				current.createForSlot(gen, buffer.counts[bufferIndex], buffer.index, bufferIndex+1 == len(buffer.counts))
+				macroOpIndex = 0
+			}
+			mop := &current.info.ops[macroOpIndex]
+
+			// The earliest cycle when the macro-op can execute
+			scheduleCycle := scheduleMacroOp(mop, &portBusy, cycle, depCycle, false)
+			if scheduleCycle < 0 {
+				portsSaturated = true
+				break
+			}
+
+			// Find operands that are ready when the macro-op executes,
+			// looking a few cycles forward. If there are none, throw the
+			// instruction away and try another, or abandon the buffer.
+			abandon := false
+			thrown := false
+			if macroOpIndex == current.info.srcOp {
+				forward := 0
+				for ; forward < lookForwardCycles && !current.selectSource(scheduleCycle, &registers, gen); forward++ {
+					scheduleCycle++
+					cycle++
+				}
+				if forward == lookForwardCycles {
+					if throwAwayCount < maxThrowawayCount {
+						thrown = true
+					} else {
+						abandon = true
+					}
+				}
 			}
-			if op.uop2&portP1 != 0 {
-				portBusy[1] = max(portBusy[1], *cycle+op.latency)
+			if !thrown && !abandon && macroOpIndex == current.info.dstOp {
+				forward := 0
+				for ; forward < lookForwardCycles && !current.selectDestination(scheduleCycle, throwAwayCount > 0, &registers, gen); forward++ {
+					scheduleCycle++
+					cycle++
+				}
+				if forward == lookForwardCycles {
+					if throwAwayCount < maxThrowawayCount {
+						thrown = true
+					} else {
+						abandon = true
+					}
+				}
+			}
+			if thrown {
+				throwAwayCount++
+				macroOpIndex = len(current.info.ops)
+				continue
+			}
+			if abandon {
+				current = ssGenInstruction{info: &nopInstrInfo}
+				break
 			}
-			if op.uop2&portP5 != 0 {
-				portBusy[2] = max(portBusy[2], *cycle+op.latency)
+			throwAwayCount = 0
+
+			// Schedule the macro-op now that its operands are known.
+			scheduleCycle = scheduleMacroOp(mop, &portBusy, scheduleCycle, scheduleCycle, true)
+			if scheduleCycle < 0 {
+				portsSaturated = true
+				break
+			}
+			depCycle = scheduleCycle + mop.latency
+
+			if macroOpIndex == current.info.resultOp {
+				ri := &registers[current.dst]
+				ri.latency = depCycle
+				ri.lastOpGroup = current.opGroup
+				ri.lastOpPar = current.opGroupPar
+			}
+			bufferIndex++
+			macroOpIndex++
+
+			if scheduleCycle >= superscalarLatency {
+				portsSaturated = true
+			}
+			cycle = topCycle
+
+			// Add the instruction once all its macro-ops are issued.
+			if macroOpIndex >= len(current.info.ops) {
+				prog.instructions = append(prog.instructions, current.toInstr())
+				if isMultiplication(current.info.instrType) {
+					mulCount++
+				}
 			}
 		}
+		cycle++
 	}
-	
-	// Advance cycle for next instruction
-	*cycle += 1
+
+	prog.addressReg = selectAddressRegister(prog)
+
+	return prog
 }
 
-// selectAddressRegister selects which register determines the next cache address.
-// The register with the highest latency is selected (most mixed).
-func selectAddressRegister(registers *[8]registerInfo) uint8 {
+// selectAddressRegister selects which register determines the next cache
+// address: the one with the highest latency on an ASIC that executes
+// every instruction in 1 cycle with unlimited parallelism. Ties go to
+// the lowest register.
+func selectAddressRegister(prog *superscalarProgram) uint8 {
+	var latencies [8]int
+	for i := range prog.instructions {
+		instr := &prog.instructions[i]
+		latDst := latencies[instr.dst] + 1
+		latSrc := 0
+		if instr.dst != instr.src {
+			latSrc = latencies[instr.src] + 1
+		}
+		if latSrc > latDst {
+			latDst = latSrc
+		}
+		latencies[instr.dst] = latDst
+	}
+
 	maxLatency := 0
 	addressReg := uint8(0)
-	
-	for i := 0; i < 8; i++ {
-		if registers[i].latency > maxLatency {
-			maxLatency = registers[i].latency
+	for i, lat := range latencies {
+		if lat > maxLatency {
+			maxLatency = lat
 			addressReg = uint8(i)
 		}
 	}
-	
-	return addressReg
-}
 
-// max returns the maximum of two integers.
-func max(a, b int) int {
-	if a > b {
-		return a
-	}
-	return b
+	return addressReg
 }
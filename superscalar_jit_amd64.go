@@ -0,0 +1,201 @@
+//go:build unix
+
+package randomx
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// superscalarCall runs the dataset item function at code for each item
+// from start up to end, reading the cache at cache and writing the items
+// to out. It is implemented in jit_amd64.s.
+//
+//go:noescape
+func superscalarCall(code, cache, out *byte, start, end uint64)
+
+// superscalarCode is the native code of a cache's superscalar programs,
+// like the code the reference implementation's generateSuperscalarCode
+// produces. It computes whole dataset items: the eight programs with the
+// cache reads between them.
+type superscalarCode struct {
+	code []byte // read-only executable mapping
+}
+
+// compileSuperscalar compiles programs into a dataset item function that
+// gives the same items as generateItem with the interpreter. The code is
+// written once and then mapped read-only and executable.
+//
+// The programs must be in the form cache.generatePrograms leaves them:
+// the imm32 of every IMUL_RCP is an index into reciprocals, not a divisor.
+func compileSuperscalar(programs []*superscalarProgram, reciprocals []uint64) (*superscalarCode, error) {
+	for _, prog := range programs {
+		for i := range prog.instructions {
+			instr := &prog.instructions[i]
+			if instr.opcode == ssIMUL_RCP && instr.imm32 >= uint32(len(reciprocals)) {
+				return nil, fmt.Errorf("randomx: IMUL_RCP reciprocal index %d out of range", instr.imm32)
+			}
+		}
+	}
+
+	var buf []byte
+	a := (*jitAssembler)(&buf)
+	a.superscalarItem(programs, reciprocals)
+
+	pageSize := os.Getpagesize()
+	size := (len(buf) + pageSize - 1) &^ (pageSize - 1)
+	code, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		return nil, fmt.Errorf("randomx: map superscalar code: %w", err)
+	}
+	copy(code, buf)
+	if err := unix.Mprotect(code, unix.PROT_READ|unix.PROT_EXEC); err != nil {
+		unix.Munmap(code)
+		return nil, fmt.Errorf("randomx: protect superscalar code: %w", err)
+	}
+
+	s := &superscalarCode{code: code}
+	runtime.SetFinalizer(s, (*superscalarCode).release)
+	return s, nil
+}
+
+// release unmaps the code.
+func (s *superscalarCode) release() error {
+	if s.code == nil {
+		return nil
+	}
+	runtime.SetFinalizer(s, nil)
+	err := unix.Munmap(s.code)
+	s.code = nil
+	return err
+}
+
+// run fills dst with the len(dst)/64 dataset items starting at item
+// start, computed from the cache memory in data.
+func (s *superscalarCode) run(data []byte, start uint64, dst []byte) {
+	count := uint64(len(dst)) / 64
+	if count == 0 {
+		return
+	}
+	superscalarCall(&s.code[0], &data[0], &dst[0], start, start+count)
+}
+
+// rd8 emits an instruction with a register operand and the memory
+// operand [base+disp]. base must not be rsp, rbp, r12 or r13.
+func (a *jitAssembler) rd8(w bool, opcode []byte, reg, base byte, disp int8) {
+	a.op(0, w, opcode, reg, 0, base)
+	a.emit(0x40|reg&7<<3|base&7, byte(disp))
+}
+
+// superscalarItem emits the dataset item function. It is called with the
+// item number in rbx, the cache in rsi and the output in rdi, which it
+// leaves unchanged; it keeps the registers in R8-R15 and uses rax, rcx
+// and rdx as scratch. Each step mirrors generateItem.
+func (a *jitAssembler) superscalarItem(programs []*superscalarProgram, reciprocals []uint64) {
+	const (
+		superscalarMul0 = 6364136223846793005
+		cacheMask       = cacheItems - 1
+	)
+	adds := [8]uint64{
+		0,
+		9298411001130361340,
+		12065312585734608966,
+		9306329213124626780,
+		5281919268842080866,
+		10536153434571861004,
+		3398623926847679864,
+		9549104520008361294,
+	}
+
+	// r0 = (itemNumber + 1) * superscalarMul0, r[i] = r0 ^ adds[i]
+	a.mov(rax, rbx)
+	a.rr(0, true, []byte{0x83}, 0, rax) // add rax, 1
+	a.emit(1)
+	a.movImm64(gpr(0), superscalarMul0)
+	a.rr(0, true, []byte{0x0F, 0xAF}, gpr(0), rax)
+	for i := uint8(1); i < 8; i++ {
+		a.movImm64(gpr(i), adds[i])
+		a.rr(0, true, []byte{0x33}, gpr(i), gpr(0))
+	}
+
+	// The first cache address comes from the item number, the others
+	// from the address register of the previous program.
+	registerValue := byte(rbx)
+	for _, prog := range programs {
+		// rcx = &cache[(registerValue & cacheMask) * 64]
+		a.mov(rcx, registerValue)
+		a.rr(0, false, []byte{0x81}, 4, rcx) // and ecx, cacheMask
+		a.imm32(cacheMask)
+		a.rr(0, true, []byte{0xC1}, 4, rcx) // shl rcx, 6
+		a.emit(6)
+		a.rr(0, true, []byte{0x03}, rcx, rsi)
+
+		for i := range prog.instructions {
+			a.superscalarInstruction(&prog.instructions[i], reciprocals)
+		}
+
+		for r := uint8(0); r < 8; r++ {
+			a.rd8(true, []byte{0x33}, gpr(r), rcx, int8(8*r))
+		}
+		registerValue = gpr(prog.addressReg)
+	}
+
+	for r := uint8(0); r < 8; r++ {
+		a.rd8(true, []byte{0x89}, gpr(r), rdi, int8(8*r))
+	}
+	a.emit(0xC3)
+}
+
+// superscalarInstruction compiles one instruction. Each case mirrors the
+// same case of executeSuperscalar.
+func (a *jitAssembler) superscalarInstruction(instr *superscalarInstruction, reciprocals []uint64) {
+	dst, src := gpr(instr.dst), gpr(instr.src)
+
+	switch instr.opcode {
+	case ssISUB_R:
+		a.rr(0, true, []byte{0x2B}, dst, src)
+
+	case ssIXOR_R:
+		a.rr(0, true, []byte{0x33}, dst, src)
+
+	case ssIADD_RS:
+		a.mov(rax, src)
+		if shift := instr.getModShift(); shift != 0 {
+			a.rr(0, true, []byte{0xC1}, 4, rax) // shl rax, shift
+			a.emit(shift)
+		}
+		a.rr(0, true, []byte{0x03}, dst, rax)
+
+	case ssIMUL_R:
+		a.rr(0, true, []byte{0x0F, 0xAF}, dst, src)
+
+	case ssIROR_C:
+		a.rr(0, true, []byte{0xC1}, 1, dst) // ror dst, imm
+		a.emit(byte(instr.imm32 & 63))
+
+	case ssIADD_C7, ssIADD_C8, ssIADD_C9:
+		// The immediate is sign-extended, as signExtend2sCompl does.
+		a.rr(0, true, []byte{0x81}, 0, dst)
+		a.imm32(instr.imm32)
+
+	case ssIXOR_C7, ssIXOR_C8, ssIXOR_C9:
+		a.rr(0, true, []byte{0x81}, 6, dst)
+		a.imm32(instr.imm32)
+
+	case ssIMULH_R, ssISMULH_R:
+		ext := byte(4) // mul
+		if instr.opcode == ssISMULH_R {
+			ext = 5 // imul
+		}
+		a.mov(rax, dst)
+		a.rr(0, true, []byte{0xF7}, ext, src)
+		a.mov(dst, rdx)
+
+	case ssIMUL_RCP:
+		a.movImm64(rax, reciprocals[instr.imm32])
+		a.rr(0, true, []byte{0x0F, 0xAF}, dst, rax)
+	}
+}
@@ -0,0 +1,167 @@
+//go:build unix
+
+package randomx
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+// fakeCache returns a cache with pseudo-random memory instead of the
+// Argon2d fill, and programs generated from key and compiled.
+func fakeCache(t testing.TB, key string) *cache {
+	t.Helper()
+	c := &cache{key: []byte(key), data: make([]byte, cacheSize)}
+	x := uint64(0x9E3779B97F4A7C15)
+	for i := 0; i < len(c.data); i += 8 {
+		x ^= x << 13
+		x ^= x >> 7
+		x ^= x << 17
+		binary.LittleEndian.PutUint64(c.data[i:], x)
+	}
+	if err := c.generatePrograms(context.Background(), nil); err != nil {
+		t.Fatalf("generatePrograms() error = %v", err)
+	}
+	if c.superscalar == nil {
+		t.Fatal("generatePrograms() did not compile the programs")
+	}
+	return c
+}
+
+// interpreted returns a copy of c without the compiled programs.
+func interpreted(c *cache) *cache {
+	i := *c
+	i.superscalar = nil
+	return &i
+}
+
+// Test that compiled superscalar programs give the interpreter's items
+func TestSuperscalarJITMatchesInterpreter(t *testing.T) {
+	c := fakeCache(t, "superscalar jit")
+	defer c.releaseSuperscalar()
+	interp := interpreted(c)
+
+	var ds dataset
+	items := []uint64{0, 1, datasetItems - 1}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		items = append(items, rng.Uint64()%datasetItems)
+	}
+
+	for _, item := range items {
+		got, want := make([]byte, 64), make([]byte, 64)
+		generateItem(c, item, got)
+		generateItem(interp, item, want)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("item %d = %x, want %x", item, got, want)
+		}
+	}
+
+	// Light mode goes through computeDatasetItem.
+	vm := &virtualMachine{c: c}
+	got, want := make([]byte, 64), make([]byte, 64)
+	vm.computeDatasetItem(12345, got)
+	generateItem(interp, 12345, want)
+	if !bytes.Equal(got, want) {
+		t.Errorf("computeDatasetItem() = %x, want %x", got, want)
+	}
+
+	// A range across chunk boundaries runs the compiled code a chunk at
+	// a time.
+	const start, count = 1000, 2*datasetChunkItems + 100
+	rangeItems := make([]byte, count*64)
+	if err := ds.generateRange(context.Background(), c, start, rangeItems, nil); err != nil {
+		t.Fatalf("generateRange() error = %v", err)
+	}
+	for n := uint64(0); n < count; n++ {
+		generateItem(interp, start+n, want)
+		if !bytes.Equal(rangeItems[n*64:n*64+64], want) {
+			t.Fatalf("range item %d differs from the interpreter", start+n)
+		}
+	}
+}
+
+// Test every superscalar instruction, including forms the generator does
+// not produce, on random programs
+func TestSuperscalarJITInstructions(t *testing.T) {
+	c := fakeCache(t, "superscalar jit instructions")
+	defer c.releaseSuperscalar()
+
+	rng := rand.New(rand.NewSource(2))
+	for n := 0; n < 20; n++ {
+		c.reciprocals = []uint64{rng.Uint64(), rng.Uint64()}
+		for p := range c.programs {
+			prog := &superscalarProgram{addressReg: uint8(rng.Intn(8))}
+			for i := 0; i < 100; i++ {
+				instr := superscalarInstruction{
+					opcode: uint8(rng.Intn(ssCount)),
+					dst:    uint8(rng.Intn(8)),
+					src:    uint8(rng.Intn(8)),
+					mod:    uint8(rng.Intn(256)),
+					imm32:  rng.Uint32(),
+				}
+				if instr.opcode == ssIMUL_RCP {
+					// An index into the reciprocals, as generatePrograms leaves it
+					instr.imm32 = uint32(rng.Intn(len(c.reciprocals)))
+				}
+				prog.instructions = append(prog.instructions, instr)
+			}
+			c.programs[p] = prog
+		}
+
+		c.releaseSuperscalar()
+		code, err := compileSuperscalar(c.programs, c.reciprocals)
+		if err != nil {
+			t.Fatalf("compileSuperscalar() error = %v", err)
+		}
+		c.superscalar = code
+		interp := interpreted(c)
+
+		for i := 0; i < 50; i++ {
+			item := rng.Uint64() % datasetItems
+			got, want := make([]byte, 64), make([]byte, 64)
+			generateItem(c, item, got)
+			generateItem(interp, item, want)
+			if !bytes.Equal(got, want) {
+				t.Fatalf("program set %d, item %d = %x, want %x", n, item, got, want)
+			}
+		}
+	}
+}
+
+// Test that an IMUL_RCP whose imm32 is not an index into the reciprocals
+// is rejected rather than compiled
+func TestSuperscalarJITReciprocalIndex(t *testing.T) {
+	prog := &superscalarProgram{instructions: []superscalarInstruction{{opcode: ssIMUL_RCP, imm32: 2}}}
+	if code, err := compileSuperscalar([]*superscalarProgram{prog}, []uint64{1, 2}); err == nil {
+		code.release()
+		t.Error("compileSuperscalar() with an out of range reciprocal index should fail")
+	}
+}
+
+func benchmarkDatasetItems(b *testing.B, compiled bool) {
+	c := fakeCache(b, "superscalar benchmark")
+	defer c.releaseSuperscalar()
+	if !compiled {
+		c = interpreted(c)
+	}
+
+	var ds dataset
+	dst := make([]byte, datasetChunkItems*64)
+	b.SetBytes(int64(len(dst)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ds.generateRange(context.Background(), c, uint64(i)*datasetChunkItems, dst, nil)
+	}
+}
+
+func BenchmarkDatasetItemsInterpreter(b *testing.B) {
+	benchmarkDatasetItems(b, false)
+}
+
+func BenchmarkDatasetItemsJIT(b *testing.B) {
+	benchmarkDatasetItems(b, true)
+}
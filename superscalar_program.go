@@ -34,15 +34,16 @@ type superscalarInstruction struct {
 	imm32  uint32 // 32-bit immediate value
 }
 
-// getModShift extracts the shift amount from the mod field for IADD_RS instruction.
+// getModShift extracts the shift amount from the mod field for IADD_RS
+// instruction: bits 2-3, as for the program instructions.
 func (i *superscalarInstruction) getModShift() uint8 {
-	return i.mod % 4
+	return (i.mod >> 2) % 4
 }
 
 // superscalarProgram represents a sequence of superscalar instructions
 // that compute a dataset item from cache data.
 type superscalarProgram struct {
-	instructions []superscalarInstruction // Instruction sequence (3-60 instructions)
+	instructions []superscalarInstruction // Instruction sequence (at most superscalarMaxSize)
 	addressReg   uint8                    // Register that determines next cache address (0-7)
 }
 
@@ -51,9 +52,11 @@ func (p *superscalarProgram) size() int {
 	return len(p.instructions)
 }
 
-// reciprocal computes a fast reciprocal approximation for IMUL_RCP instruction.
-// This matches the randomx_reciprocal function from the C++ reference.
-// divisor must not be 0.
+// reciprocal computes the fixed-point reciprocal for the IMUL_RCP
+// instructions: floor(2^(63+n) / divisor), where n is the bit length of
+// divisor. This matches the randomx_reciprocal function from the C++
+// reference, which computes it one bit at a time.
+// divisor must not be 0 or a power of two.
 func reciprocal(divisor uint32) uint64 {
 	if divisor == 0 {
 		divisor = 1 // Avoid division by zero
@@ -63,8 +66,9 @@ func reciprocal(divisor uint32) uint64 {
 	q := p2exp63 / uint64(divisor)
 	r := p2exp63 % uint64(divisor)
 	
-	// Count leading zeros to determine shift
-	shift := uint32(64 - bits.LeadingZeros32(divisor))
+	// q < 2^(64-shift) and r < divisor < 2^shift, so neither shift
+	// overflows
+	shift := uint(bits.Len32(divisor))
 	
 	return (q << shift) + ((r << shift) / uint64(divisor))
 }
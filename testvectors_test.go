@@ -206,6 +206,16 @@ func TestOfficialVectors(t *testing.T) {
 	t.Logf("Description: %s", suite.Description)
 	t.Logf("Running %d test vectors", len(suite.Vectors))
 
+	// Consecutive vectors with the same mode and key share a hasher, so
+	// each fast mode dataset is built once.
+	var hasher *Hasher
+	var hasherMode, hasherKey string
+	defer func() {
+		if hasher != nil {
+			hasher.Close()
+		}
+	}()
+
 	for _, tv := range suite.Vectors {
 		t.Run(tv.Name, func(t *testing.T) {
 			// Parse mode
@@ -215,16 +225,21 @@ func TestOfficialVectors(t *testing.T) {
 			}
 
 			// Create hasher
-			config := Config{
-				Mode:     mode,
-				CacheKey: []byte(tv.Key),
-			}
-
-			hasher, err := New(config)
-			if err != nil {
-				t.Fatalf("New() failed: %v", err)
+			if hasher == nil || tv.Mode != hasherMode || tv.Key != hasherKey {
+				if hasher != nil {
+					hasher.Close()
+					hasher = nil
+				}
+				config := Config{
+					Mode:     mode,
+					CacheKey: []byte(tv.Key),
+				}
+				hasher, err = New(config)
+				if err != nil {
+					t.Fatalf("New() failed: %v", err)
+				}
+				hasherMode, hasherKey = tv.Mode, tv.Key
 			}
-			defer hasher.Close()
 
 			// Get input
 			input, err := tv.GetInput()
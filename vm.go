@@ -1,38 +1,87 @@
 package randomx
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"math"
 
 	"github.com/opd-ai/go-randomx/internal"
+	"github.com/opd-ai/go-randomx/internal/aesround"
 )
 
 // vmConfig holds configuration data parsed from AesGenerator4R output.
 type vmConfig struct {
-	readReg0 uint8    // Register for spAddr0 XOR
-	readReg1 uint8    // Register for spAddr1 XOR
-	readReg2 uint8    // Register for mx XOR
-	readReg3 uint8    // Register for mx XOR
-	eMask    [4]uint64 // Masks for E registers
+	readReg0      uint8     // Register for spAddr0 XOR
+	readReg1      uint8     // Register for spAddr1 XOR
+	readReg2      uint8     // Register for mx XOR
+	readReg3      uint8     // Register for mx XOR
+	eMask         [2]uint64 // Exponent masks for the low and high halves of E registers
+	datasetOffset uint64    // Byte offset added to dataset addresses
 }
 
 // virtualMachine implements the RandomX virtual machine.
 type virtualMachine struct {
-	reg  [8]uint64 // Integer register file (r0-r7)
-	regF [4]float64 // Floating-point register file (f0-f3)
-	regE [4]float64 // E register file (e0-e3)
-	mem  []byte     // Scratchpad memory (2 MB)
-	ds   *dataset   // Dataset reference (fast mode)
-	c    *cache     // Cache reference (light mode)
-	ma   uint64     // Memory address register
-	mx   uint64     // Memory multiplier
+	reg  [8]uint64     // Integer register file (r0-r7)
+	regF [4][2]float64 // Floating-point register file (f0-f3), low and high halves
+	regE [4][2]float64 // E register file (e0-e3)
+	regA [4][2]float64 // A register file (a0-a3), read-only, set by the configuration
+	mem  []byte        // Scratchpad memory (2 MB)
+	aes  aesround.Impl // AES rounds for the generators and scratchpad hash
+	ds   *dataset      // Dataset reference (fast mode)
+	c    *cache        // Cache reference (light mode)
+	ma   uint64        // Memory address register
+	mx   uint64        // Memory multiplier
+	fprc roundingMode  // Floating-point rounding mode, set by CFROUND
 
 	// Program generation and configuration
-	gen4     *aesGenerator4R // Generator for programs
-	config   vmConfig        // Current configuration
-	spAddr0  uint32          // Scratchpad address 0
-	spAddr1  uint32          // Scratchpad address 1
+	gen4    *aesGenerator4R // Generator for programs
+	config  vmConfig        // Current configuration
+	spAddr0 uint32          // Scratchpad address 0
+	spAddr1 uint32          // Scratchpad address 1
+
+	// Native code for the current program, if the VM uses FlagJIT. The
+	// compiler is kept across hashes while the VM is pooled. The
+	// compiled code builds the MXCSR value for the rounding mode in
+	// jitMXCSR.
+	jit      *jitCompiler
+	useJIT   bool
+	jitMXCSR uint32
+}
+
+// setJIT selects whether the VM compiles programs to native code, and
+// whether the code mapping is kept W^X. If the compiler cannot be set up,
+// the VM keeps interpreting.
+func (vm *virtualMachine) setJIT(enabled, secure bool) {
+	vm.useJIT = false
+	if !enabled || !jitSupported {
+		return
+	}
+	if vm.jit == nil {
+		c, err := newJITCompiler()
+		if err != nil {
+			return
+		}
+		vm.jit = c
+	}
+	vm.jit.secure = secure
+	vm.useJIT = true
+}
+
+// applyFlags sets vm up to use the AES implementation and the JIT
+// selected by flags, as New and NewVM do.
+func (vm *virtualMachine) applyFlags(flags Flags) {
+	vm.aes = flags.aesImpl()
+	vm.setJIT(flags&FlagJIT != 0, flags&FlagSecure != 0)
+}
+
+// releaseJIT unmaps the VM's compiled code.
+func (vm *virtualMachine) releaseJIT() {
+	if vm.jit != nil {
+		vm.jit.release()
+		vm.jit = nil
+	}
+	vm.useJIT = false
 }
 
 // init initializes the VM with dataset or cache.
@@ -44,34 +93,73 @@ func (vm *virtualMachine) init(ds *dataset, c *cache) {
 
 // reset clears the VM state for reuse.
 func (vm *virtualMachine) reset() {
+	vm.resetRegisters()
+	if vm.mem != nil {
+		for i := range vm.mem {
+			vm.mem[i] = 0
+		}
+	}
+}
+
+// resetRegisters clears the register state but leaves the scratchpad
+// untouched.
+func (vm *virtualMachine) resetRegisters() {
 	for i := range vm.reg {
 		vm.reg[i] = 0
 	}
 	for i := range vm.regF {
-		vm.regF[i] = 0
+		vm.regF[i] = [2]float64{}
 	}
 	for i := range vm.regE {
-		vm.regE[i] = 0
+		vm.regE[i] = [2]float64{}
 	}
-	if vm.mem != nil {
-		for i := range vm.mem {
-			vm.mem[i] = 0
-		}
+	for i := range vm.regA {
+		vm.regA[i] = [2]float64{}
 	}
 	vm.ma = 0
 	vm.mx = 0
+	vm.fprc = roundNearest
 	vm.spAddr0 = 0
 	vm.spAddr1 = 0
 }
 
 // run executes the RandomX algorithm on the input.
-func (vm *virtualMachine) run(input []byte) [32]byte {
+// The context is checked before each of the eight programs, so a cancelled
+// hash stops early and returns ctx.Err().
+func (vm *virtualMachine) run(ctx context.Context, input []byte) ([32]byte, error) {
 	traceSeparator("RandomX Hash Computation")
 	traceLog("Input: %q (length=%d bytes)", string(input), len(input))
-	
+
+	return vm.runSeed(ctx, internal.Blake2b512(input))
+}
+
+// runSeed is run with the Blake2b-512 hash of the input already computed,
+// so callers can absorb the input incrementally.
+func (vm *virtualMachine) runSeed(ctx context.Context, seed [64]byte) ([32]byte, error) {
 	// Initialize VM state from input
-	vm.initialize(input)
+	if err := vm.initializeSeed(seed); err != nil {
+		return [32]byte{}, err
+	}
+
+	if err := vm.execute(ctx); err != nil {
+		return [32]byte{}, err
+	}
+
+	// Finalize hash
+	finalHash, err := vm.finalize()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	traceBytes("Final hash", finalHash[:])
+	traceSeparator("End of Hash Computation")
+	
+	return finalHash, nil
+}
 
+// execute runs the programs of one hash on an initialized VM, leaving the
+// final register state for finalize. It returns ctx.Err() if the context
+// is done before a program starts.
+func (vm *virtualMachine) execute(ctx context.Context) error {
 	// RandomX algorithm: 8 programs, each executed 2048 times
 	const (
 		programCount      = 8
@@ -79,10 +167,23 @@ func (vm *virtualMachine) run(input []byte) [32]byte {
 	)
 
 	for progNum := 0; progNum < programCount; progNum++ {
-		traceSubsection(fmt.Sprintf("Program %d/%d", progNum+1, programCount))
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// The trace messages are only formatted when tracing, so
+		// hashing does not allocate for them
+		if debugEnabled {
+			traceSubsection(fmt.Sprintf("Program %d/%d", progNum+1, programCount))
+		}
 		
 		// Generate new program from AesGenerator4R
 		prog := vm.generateProgram()
+		if vm.useJIT {
+			if err := vm.jit.compile(prog); err != nil {
+				return err
+			}
+		}
 		
 		// Log first few instructions for debugging
 		if debugEnabled && len(prog.instructions) >= 5 {
@@ -94,42 +195,53 @@ func (vm *virtualMachine) run(input []byte) [32]byte {
 			}
 		}
 
+		// Each program starts with zero integer registers and the
+		// scratchpad addresses from the configuration's mx and ma.
+		for i := range vm.reg {
+			vm.reg[i] = 0
+		}
+		vm.spAddr0 = uint32(vm.mx)
+		vm.spAddr1 = uint32(vm.ma)
+
 		// Execute this program 2048 times
 		for iter := 0; iter < programIterations; iter++ {
 			vm.executeIteration(prog)
 		}
 
 		// Log register state after program execution
-		traceRegisters(fmt.Sprintf("Registers after program %d", progNum+1), vm.reg)
+		if debugEnabled {
+			traceRegisters(fmt.Sprintf("Registers after program %d", progNum+1), vm.reg)
+		}
 
 		// Update generator state for next program
-		// Hash the register file and use as new generator state
-		regData := vm.serializeRegisters()
-		newState := internal.Blake2b512(regData)
-		vm.gen4.setState(newState[:])
+		// Hash the register file and use as new generator state; the
+		// last program's registers go to finalize instead
+		if progNum < programCount-1 {
+			newState := internal.Blake2b512(vm.serializeRegisters())
+			vm.gen4.setState(newState[:])
+		}
 	}
 
-	// Finalize hash
-	finalHash := vm.finalize()
-	traceBytes("Final hash", finalHash[:])
-	traceSeparator("End of Hash Computation")
-	
-	return finalHash
+	return nil
 }
 
 // initialize sets up the VM state from input data using the RandomX algorithm.
-func (vm *virtualMachine) initialize(input []byte) {
-	traceSubsection("VM Initialization")
-	
+func (vm *virtualMachine) initialize(input []byte) error {
 	// Step 1: Hash input to get initial state
-	hash := internal.Blake2b512(input)
+	return vm.initializeSeed(internal.Blake2b512(input))
+}
+
+// initializeSeed sets up the VM state from the Blake2b-512 hash of the input.
+func (vm *virtualMachine) initializeSeed(hash [64]byte) error {
+	traceSubsection("VM Initialization")
 	traceBytes("Initial Blake2b-512 hash", hash[:])
 
 	// Step 2: Create AesGenerator1R from hash
 	gen1, err := newAesGenerator1R(hash[:])
 	if err != nil {
-		panic("failed to create AesGenerator1R: " + err.Error())
+		return fmt.Errorf("randomx: create AesGenerator1R: %w", err)
 	}
+	gen1.aes = vm.aes
 
 	// Step 3: Fill scratchpad (2 MB) from generator
 	// Ensure mem is allocated
@@ -144,47 +256,101 @@ func (vm *virtualMachine) initialize(input []byte) {
 	}
 
 	// Step 4: Create AesGenerator4R from gen1 state for program generation
+	if err := vm.initProgramGenerator(gen1); err != nil {
+		return err
+	}
+
+	// Each hash starts rounding to nearest; CFROUND changes the mode
+	// for the rest of the hash, across programs.
+	vm.fprc = roundNearest
+	
+	traceLog("VM initialization complete")
+	return nil
+}
+
+// initProgramGenerator seeds the program generator from the final state of
+// the generator that filled the scratchpad.
+func (vm *virtualMachine) initProgramGenerator(gen1 *aesGenerator1R) error {
 	gen4, err := newAesGenerator4R(gen1.state[:])
 	if err != nil {
-		panic("failed to create AesGenerator4R: " + err.Error())
+		return fmt.Errorf("randomx: create AesGenerator4R: %w", err)
 	}
+	gen4.aes = vm.aes
 	vm.gen4 = gen4
-	
-	traceLog("VM initialization complete")
+	return nil
+}
+
+// hashAndFill finishes the current hash and initializes the VM for the
+// next one in a single pass over the scratchpad: each 64-byte line is
+// absorbed into the scratchpad hash and then overwritten with the fill for
+// nextSeed. The result is the same as finalize followed by initializeSeed
+// on a reset VM, but the 2 MB scratchpad is only walked once.
+func (vm *virtualMachine) hashAndFill(nextSeed [64]byte) ([32]byte, error) {
+	hasher, err := newAesHash1R()
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("randomx: create AesHash1R: %w", err)
+	}
+	gen1, err := newAesGenerator1R(nextSeed[:])
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("randomx: create AesGenerator1R: %w", err)
+	}
+	hasher.aes, gen1.aes = vm.aes, vm.aes
+
+	hasher.reset()
+	for offset := 0; offset < len(vm.mem); offset += 64 {
+		line := vm.mem[offset : offset+64]
+		hasher.absorb(line)
+		gen1.getBytes(line)
+	}
+
+	finalHash := vm.finalizeRegisters(hasher.sum())
+
+	vm.resetRegisters()
+	if err := vm.initProgramGenerator(gen1); err != nil {
+		return [32]byte{}, err
+	}
+	return finalHash, nil
 }
 
-// parseConfiguration parses 128 bytes of configuration data from AesGenerator4R.
-// This sets up the VM's configuration according to RandomX spec Table 4.5.1.
+// parseConfiguration parses the 128 bytes of configuration data that
+// precede each program, as 16 little-endian words (RandomX spec section
+// 4.5):
+//
+//	words 0-7    a0-a3, low half first, as small positive floats
+//	word 8       ma, aligned to a dataset cache line
+//	word 10      mx
+//	word 12      readReg0-3, one bit each
+//	word 13      datasetOffset
+//	words 14-15  exponent masks for the halves of the E registers
+//
+// Words 9 and 11 are not used.
 func (vm *virtualMachine) parseConfiguration(data []byte) {
 	if len(data) < 128 {
 		panic("configuration data must be at least 128 bytes")
 	}
+	word := func(i int) uint64 {
+		return binary.LittleEndian.Uint64(data[i*8:])
+	}
 
-	// Parse readReg values (which registers to use for address calculations)
-	// RandomX spec: take individual bytes and mask with 7 to get register index (0-7)
-	// BUG FIX: Was incorrectly reading uint32 values, should read individual bytes
-	vm.config.readReg0 = data[0] & 7
-	vm.config.readReg1 = data[1] & 7
-	vm.config.readReg2 = data[2] & 7
-	vm.config.readReg3 = data[3] & 7
-
-	// Parse E register masks (used for floating-point operations)
-	// BUG FIX: E-masks are consecutive uint64 values starting at byte 8, not byte 16 with stride 16
-	// Layout: bytes 0-7 (readReg + padding), bytes 8-39 (4 E-masks), bytes 40-127 (other config)
-	const defaultEMask = uint64(0x3FFFFFFFFFFFFFFF) // Default mask to prevent infinity/NaN
-	
-	for i := 0; i < 4; i++ {
-		offset := 8 + i*8 // E masks start at byte 8, each is 8 bytes
-		mask := binary.LittleEndian.Uint64(data[offset : offset+8])
-		
-		// RandomX spec: if bit 62 (sign bit of exponent) is 0, use default mask
-		// This ensures E registers contain valid floating-point values
-		if (mask & (1 << 62)) == 0 {
-			vm.config.eMask[i] = defaultEMask
-		} else {
-			vm.config.eMask[i] = mask
-		}
+	for i := range vm.regA {
+		vm.regA[i][0] = math.Float64frombits(smallPositiveFloatBits(word(2 * i)))
+		vm.regA[i][1] = math.Float64frombits(smallPositiveFloatBits(word(2*i + 1)))
 	}
+
+	vm.ma = word(8) & cacheLineAlignMask
+	vm.mx = word(10)
+
+	// Each address register is picked from a pair by one bit.
+	readRegs := word(12)
+	vm.config.readReg0 = 0 + uint8(readRegs&1)
+	vm.config.readReg1 = 2 + uint8(readRegs>>1&1)
+	vm.config.readReg2 = 4 + uint8(readRegs>>2&1)
+	vm.config.readReg3 = 6 + uint8(readRegs>>3&1)
+
+	vm.config.datasetOffset = word(13) % (datasetExtraItems + 1) * cacheLineSize
+
+	vm.config.eMask[0] = floatMask(word(14))
+	vm.config.eMask[1] = floatMask(word(15))
 }
 
 // generateProgram creates a RandomX program from AesGenerator4R output.
@@ -204,6 +370,7 @@ func (vm *virtualMachine) generateProgram() *program {
 	for i := 0; i < programLength; i++ {
 		p.instructions[i] = decodeInstruction(programData[i*8 : i*8+8])
 	}
+	p.setBranchTargets()
 
 	return p
 }
@@ -212,12 +379,12 @@ func (vm *virtualMachine) generateProgram() *program {
 // This implements the 12-step process per RandomX spec Section 4.6.2.
 func (vm *virtualMachine) executeIteration(prog *program) {
 	// Step 1: Update scratchpad addresses with register values
-	vm.spAddr0 ^= uint32(vm.reg[vm.config.readReg0])
-	vm.spAddr1 ^= uint32(vm.reg[vm.config.readReg1])
-
-	// Align to 64-byte cache lines
-	vm.spAddr0 &= 0x1FFFC0 // Mask to align to 64-byte boundary in scratchpad
-	vm.spAddr1 &= 0x1FFFC0
+	// spAddr0 takes the low half of spMix and spAddr1 the high half
+	spMix := vm.reg[vm.config.readReg0] ^ vm.reg[vm.config.readReg1]
+	vm.spAddr0 ^= uint32(spMix)
+	vm.spAddr0 &= scratchpadL3LineMask
+	vm.spAddr1 ^= uint32(spMix >> 32)
+	vm.spAddr1 &= scratchpadL3LineMask
 
 	// Step 2: Read 64 bytes from Scratchpad[spAddr0] and XOR with r0-r7
 	for i := 0; i < 8; i++ {
@@ -225,31 +392,28 @@ func (vm *virtualMachine) executeIteration(prog *program) {
 	}
 
 	// Step 3: Read 64 bytes from Scratchpad[spAddr1] to initialize f0-f3 and e0-e3
+	// Each 8 bytes hold two signed 32-bit integers, converted to the
+	// halves of a register; the E registers are then masked into range.
 	for i := 0; i < 4; i++ {
-		// Load f registers (first 32 bytes) - apply float mask
-		fVal := vm.readMemory(vm.spAddr1 + uint32(i*8))
-		vm.regF[i] = maskFloat(math.Float64frombits(fVal))
-
-		// Load e registers (next 32 bytes) - apply eMask from configuration
-		eVal := vm.readMemory(vm.spAddr1 + 32 + uint32(i*8))
-		// Apply eMask to limit exponent range
-		eValMasked := eVal & vm.config.eMask[i]
-		vm.regE[i] = maskFloat(math.Float64frombits(eValMasked))
+		vm.regF[i] = vm.readMemoryFloat(vm.spAddr1 + uint32(i*8))
+		vm.regE[i] = vm.maskRegisterE(vm.readMemoryFloat(vm.spAddr1 + 32 + uint32(i*8)))
 	}
 
 	// Step 4: Execute all 256 instructions in the program
-	for i := 0; i < programLength; i++ {
-		vm.executeInstruction(&prog.instructions[i])
+	if vm.useJIT {
+		vm.jit.run(vm)
+	} else {
+		prog.execute(vm)
 	}
 
-	// Step 5: XOR mx with readReg2 and readReg3
-	vm.mx ^= vm.reg[vm.config.readReg2]
-	vm.mx ^= vm.reg[vm.config.readReg3]
+	// Step 5: XOR mx with readReg2 and readReg3, aligned to an item
+	vm.mx ^= vm.reg[vm.config.readReg2] ^ vm.reg[vm.config.readReg3]
+	vm.mx &= cacheLineAlignMask
 
-	// Step 6-7: Read dataset item and XOR with registers
+	// Step 6-7: Read the dataset item at ma and XOR with registers
 	vm.mixDataset()
 
-	// Step 8: Swap mx and ma
+	// Step 8: Swap mx and ma, so the item at mx is read next time
 	vm.mx, vm.ma = vm.ma, vm.mx
 
 	// Step 9: Write r0-r7 to Scratchpad[spAddr1]
@@ -259,54 +423,61 @@ func (vm *virtualMachine) executeIteration(prog *program) {
 
 	// Step 10: XOR f0-f3 with e0-e3
 	for i := 0; i < 4; i++ {
-		vm.regF[i] += vm.regE[i]
+		for j := 0; j < 2; j++ {
+			vm.regF[i][j] = uint64ToFloat(floatToUint64(vm.regF[i][j]) ^ floatToUint64(vm.regE[i][j]))
+		}
 	}
 
-	// Step 11: Write f0-f3 to Scratchpad[spAddr0]
+	// Step 11: Write f0-f3 (16 bytes each) to Scratchpad[spAddr0]
 	for i := 0; i < 4; i++ {
-		vm.writeMemory(vm.spAddr0+uint32(i*8), floatToUint64(vm.regF[i]))
+		vm.writeMemory(vm.spAddr0+uint32(i*16), floatToUint64(vm.regF[i][0]))
+		vm.writeMemory(vm.spAddr0+uint32(i*16+8), floatToUint64(vm.regF[i][1]))
 	}
 
-	// Step 12: Update spAddr0 (this happens automatically on next iteration)
+	// Step 12: Clear the scratchpad addresses; the next iteration
+	// derives them from the registers alone
+	vm.spAddr0 = 0
+	vm.spAddr1 = 0
 }
 
-// serializeRegisters serializes the register file for hashing.
+// serializeRegisters serializes the register file for hashing, in the
+// layout of the reference RegisterFile: r0-r7, then f0-f3, e0-e3 and
+// a0-a3 with the low half of each register first, 256 bytes in all.
 // This is used to update the generator state between programs.
 func (vm *virtualMachine) serializeRegisters() []byte {
-	// Serialize: r0-r7 (64 bytes) + f0-f3 (32 bytes) + e0-e3 (32 bytes) = 128 bytes
-	data := make([]byte, 128)
+	data := make([]byte, 256)
 
 	// Integer registers
 	for i := 0; i < 8; i++ {
 		binary.LittleEndian.PutUint64(data[i*8:], vm.reg[i])
 	}
 
-	// Floating-point registers
-	for i := 0; i < 4; i++ {
-		binary.LittleEndian.PutUint64(data[64+i*8:], floatToUint64(vm.regF[i]))
-	}
-
-	// E registers
-	for i := 0; i < 4; i++ {
-		binary.LittleEndian.PutUint64(data[96+i*8:], floatToUint64(vm.regE[i]))
+	// Floating-point register groups
+	for g, group := range [3]*[4][2]float64{&vm.regF, &vm.regE, &vm.regA} {
+		for i := range group {
+			for j := range group[i] {
+				binary.LittleEndian.PutUint64(data[64+g*64+i*16+j*8:], floatToUint64(group[i][j]))
+			}
+		}
 	}
 
 	return data
 }
 
-// mixDataset mixes dataset items into the register file.
+// mixDataset XORs the dataset item at datasetOffset + ma into r0-r7. In
+// light mode the item is computed from the cache. The reference
+// implementation prefetches the item at datasetOffset + mx at this point,
+// which the swap that follows makes the next item read; Go has no
+// prefetch instruction, so it is only read then.
 func (vm *virtualMachine) mixDataset() {
-	// Use mx to select dataset item
 	var itemData [64]byte
+	index := (vm.config.datasetOffset + vm.ma) / cacheLineSize
 
 	if vm.ds != nil {
 		// Fast mode: read from dataset
-		index := vm.mx % datasetItems
 		copy(itemData[:], vm.ds.getItem(index))
 	} else if vm.c != nil {
 		// Light mode: compute dataset item on-demand from cache
-		// BUG FIX: Was incorrectly returning raw cache item instead of computing dataset item
-		index := vm.mx % datasetItems
 		vm.computeDatasetItem(index, itemData[:])
 	} else {
 		return
@@ -317,140 +488,58 @@ func (vm *virtualMachine) mixDataset() {
 		val := binary.LittleEndian.Uint64(itemData[i*8 : i*8+8])
 		vm.reg[i] ^= val
 	}
-
-	// Update ma for next iteration
-	vm.ma = vm.mx
 }
 
 // computeDatasetItem generates a single dataset item on-demand from the cache.
-// This is used in light mode and implements dataset item generation using superscalar programs.
+// This is used in light mode, with the same generator that builds the dataset.
 func (vm *virtualMachine) computeDatasetItem(itemNumber uint64, output []byte) {
-	// Superscalar constants (from RandomX C++ reference)
-	const (
-		superscalarMul0 = 6364136223846793005
-		superscalarAdd1 = 9298411001130361340
-		superscalarAdd2 = 12065312585734608966
-		superscalarAdd3 = 9306329213124626780
-		superscalarAdd4 = 5281919268842080866
-		superscalarAdd5 = 10536153434571861004
-		superscalarAdd6 = 3398623926847679864
-		superscalarAdd7 = 9549104520008361294
-	)
-	
-	// Initialize register file with specific constants based on item number
-	var registers [8]uint64
-	registerValue := itemNumber
-	registers[0] = (itemNumber + 1) * superscalarMul0
-	registers[1] = registers[0] ^ superscalarAdd1
-	registers[2] = registers[0] ^ superscalarAdd2
-	registers[3] = registers[0] ^ superscalarAdd3
-	registers[4] = registers[0] ^ superscalarAdd4
-	registers[5] = registers[0] ^ superscalarAdd5
-	registers[6] = registers[0] ^ superscalarAdd6
-	registers[7] = registers[0] ^ superscalarAdd7
-	
-	// Execute 8 superscalar programs (one per cache access)
-	for i := 0; i < cacheAccesses; i++ {
-		// Get cache block based on current register value
-		// Mask to cache line size (64 bytes per item)
-		const mask = cacheItems - 1
-		cacheIndex := uint32(registerValue & mask)
-		mixBlock := vm.c.getItem(cacheIndex)
-		
-		// Execute the superscalar program on the register file
-		prog := vm.c.programs[i]
-		executeSuperscalar(&registers, prog, vm.c.reciprocals)
-		
-		// XOR cache block into registers
-		for r := 0; r < 8; r++ {
-			val := binary.LittleEndian.Uint64(mixBlock[r*8 : r*8+8])
-			registers[r] ^= val
-		}
-		
-		// Next cache address is determined by the address register
-		registerValue = registers[prog.addressReg]
-	}
-	
-	// Output is the final register state (64 bytes)
-	for r := 0; r < 8; r++ {
-		binary.LittleEndian.PutUint64(output[r*8:r*8+8], registers[r])
-	}
+	generateItem(vm.c, itemNumber, output)
 }
 
 // finalize produces the final hash output using the RandomX finalization algorithm.
-func (vm *virtualMachine) finalize() [32]byte {
+func (vm *virtualMachine) finalize() ([32]byte, error) {
 	// Step 1: Hash the scratchpad with AesHash1R
 	hasher, err := newAesHash1R()
 	if err != nil {
-		panic("failed to create AesHash1R: " + err.Error())
+		return [32]byte{}, fmt.Errorf("randomx: create AesHash1R: %w", err)
 	}
-	scratchpadHash := hasher.hash(vm.mem)
+	hasher.aes = vm.aes
+	return vm.finalizeRegisters(hasher.hash(vm.mem)), nil
+}
 
+// finalizeRegisters produces the final hash from the scratchpad hash and
+// the register file.
+func (vm *virtualMachine) finalizeRegisters(scratchpadHash [64]byte) [32]byte {
 	// Step 2: Serialize register file (256 bytes)
-	// Include integer registers, floating-point registers, and E registers
-	regData := make([]byte, 256)
-
-	// Integer registers (r0-r7): 64 bytes
-	for i := 0; i < 8; i++ {
-		binary.LittleEndian.PutUint64(regData[i*8:], vm.reg[i])
-	}
+	regData := vm.serializeRegisters()
 
-	// Floating-point registers (f0-f3): 32 bytes
-	for i := 0; i < 4; i++ {
-		binary.LittleEndian.PutUint64(regData[64+i*8:], floatToUint64(vm.regF[i]))
-	}
+	// Step 3: The scratchpad hash replaces a0-a3, the last 64 bytes
+	copy(regData[192:], scratchpadHash[:])
 
-	// E registers (e0-e3): 32 bytes
-	for i := 0; i < 4; i++ {
-		binary.LittleEndian.PutUint64(regData[96+i*8:], floatToUint64(vm.regE[i]))
-	}
-
-	// Add ma and mx: 16 bytes
-	binary.LittleEndian.PutUint64(regData[128:], vm.ma)
-	binary.LittleEndian.PutUint64(regData[136:], vm.mx)
-
-	// Pad remaining bytes to 256
-	// (rest is left as zeros)
-
-	// Step 3: Concatenate scratchpad hash (64 bytes) + register file (256 bytes)
-	combined := make([]byte, 320)
-	copy(combined[0:64], scratchpadHash[:])
-	copy(combined[64:], regData)
-
-	// Step 4: Final Blake2b-256 hash
-	return internal.Blake2b256(combined)
+	// Step 4: Final Blake2b-256 hash of the register file
+	return internal.Blake2b256(regData)
 }
 
 // executeInstruction executes a single VM instruction using the full RandomX instruction set.
-func (vm *virtualMachine) executeInstruction(instr *instruction) {
+// It reports whether the instruction is a CBRANCH that was taken.
+func (vm *virtualMachine) executeInstruction(instr *instruction) bool {
 	// Use the full instruction executor from instructions.go
-	vm.executeInstructionFull(instr)
+	return vm.executeInstructionFull(instr)
 }
 
 // getMemoryAddress computes memory address for load/store operations.
-// The mod field determines which scratchpad level (L1/L2/L3) is accessed.
+// The instruction and its mod field determine the base register and which
+// scratchpad level (L1/L2/L3) is accessed, as memoryOperand describes.
 func (vm *virtualMachine) getMemoryAddress(instr *instruction) uint32 {
-	// Calculate base address from src register + immediate
-	addr := vm.reg[instr.src] + uint64(instr.imm)
-	
-	// Determine scratchpad level based on mod % 4
-	// mod % 4 == 0: L3 (full 2 MB)
-	// mod % 4 == 1: L2 (256 KB)
-	// mod % 4 == 2: L1 (16 KB)
-	// mod % 4 == 3: L2 (256 KB)
-	switch instr.mod % 4 {
-	case 0:
-		// L3 level - full scratchpad
-		return uint32(addr & scratchpadL3Mask)
-	case 1, 3:
-		// L2 level - 256 KB
-		return uint32(addr & scratchpadL2Mask)
-	case 2:
-		// L1 level - 16 KB
-		return uint32(addr & scratchpadL1Mask)
-	default:
-		return uint32(addr & scratchpadL3Mask)
+	reg, mask := memoryOperand(instr)
+
+	// Only the low bits survive the mask, so the sign extension of the
+	// immediate does not matter.
+	addr := instr.imm
+	if reg >= 0 {
+		addr += uint32(vm.reg[reg])
 	}
+	return addr & mask
 }
 
 // readMemory reads a 64-bit value from scratchpad memory.
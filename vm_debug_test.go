@@ -1,6 +1,7 @@
 package randomx
 
 import (
+	"context"
 	"encoding/hex"
 	"testing"
 
@@ -59,7 +60,9 @@ func TestProgramGeneration_FirstProgram(t *testing.T) {
 	vm := &virtualMachine{
 		mem: make([]byte, scratchpadL3Size),
 	}
-	vm.initialize(input)
+	if err := vm.initialize(input); err != nil {
+		t.Fatalf("initialize() error = %v", err)
+	}
 
 	// Generate first program
 	prog := vm.generateProgram()
@@ -86,7 +89,9 @@ func TestIterationExecution_FirstIteration(t *testing.T) {
 	vm := &virtualMachine{
 		mem: make([]byte, scratchpadL3Size),
 	}
-	vm.initialize(input)
+	if err := vm.initialize(input); err != nil {
+		t.Fatalf("initialize() error = %v", err)
+	}
 
 	// Capture scratchpad state before execution
 	scratchpadBefore := make([]byte, 64)
@@ -127,7 +132,9 @@ func TestFinalization_Components(t *testing.T) {
 	vm := &virtualMachine{
 		mem: make([]byte, scratchpadL3Size),
 	}
-	vm.initialize(input)
+	if err := vm.initialize(input); err != nil {
+		t.Fatalf("initialize() error = %v", err)
+	}
 
 	// Set some register values for testing
 	for i := 0; i < 8; i++ {
@@ -197,7 +204,10 @@ func TestFullExecution_WithDebug(t *testing.T) {
 	t.Logf("Cache item 0 (first 32 bytes): %s", hex.EncodeToString(cacheItem0[:32]))
 
 	// Run hash
-	hash := vm.run(input)
+	hash, err := vm.run(context.Background(), input)
+	if err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
 
 	t.Logf("Result: %s", hex.EncodeToString(hash[:]))
 	t.Logf("Expected: 639183aae1bf4c9a35884cb46b09cad9175f04efd7684e7262a0ac1c2f0b4e3f")
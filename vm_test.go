@@ -0,0 +1,112 @@
+package randomx
+
+import "testing"
+
+// Test the register state after the configuration step of the first
+// program for the inputs of the official test cases. The configuration
+// depends only on the input, through Blake2b-512, AesGenerator1R and
+// AesGenerator4R, which are checked against known answers on their own;
+// the official hashes check these values end to end.
+func TestConfigurationVectors(t *testing.T) {
+	tests := []struct {
+		input         string
+		a             [4][2]uint64
+		ma, mx        uint64
+		readRegs      [4]uint8
+		datasetOffset uint64
+		eMask         [2]uint64
+	}{
+		{
+			input: "This is a test",
+			a: [4][2]uint64{
+				{0x418e4a297ebfc304, 0x4019c856c26708a9},
+				{0x40cd8725df13238a, 0x41e807a5dc7740b5},
+				{0x4176971a789beed7, 0x417112c274f91d68},
+				{0x414e441747df76c6, 0x40bd229eeedd8e98},
+			},
+			ma:            0x738ddb40,
+			mx:            0x41ca2f248a8a6230,
+			readRegs:      [4]uint8{0, 3, 5, 7},
+			datasetOffset: 0xa35540,
+			eMask:         [2]uint64{0x3c000000001e145f, 0x3a0000000011d432},
+		},
+		{
+			input: "Lorem ipsum dolor sit amet",
+			a: [4][2]uint64{
+				{0x417df958dcd53e9d, 0x401fea293bcdaac0},
+				{0x404d791d228bc76c, 0x4109dbb57e6b7993},
+				{0x41372207dabc5336, 0x40cb61a46357b7bd},
+				{0x416789c92a49e7f4, 0x410b230e5827c906},
+			},
+			ma:            0x53c5b600,
+			mx:            0x42603488fa78ebcb,
+			readRegs:      [4]uint8{0, 3, 5, 6},
+			datasetOffset: 0x1881c40,
+			eMask:         [2]uint64{0x3000000000264a50, 0x3f00000000154186},
+		},
+		{
+			input: "sed do eiusmod tempor incididunt ut labore et dolore magna aliqua\n",
+			a: [4][2]uint64{
+				{0x417dbed4f320e239, 0x41dec30f44012603},
+				{0x40f73520403d9aec, 0x409afb99a82e8ca8},
+				{0x41b4922e9839aeac, 0x4039fbadfd5fbb3d},
+				{0x407a5ca3914fb461, 0x41ea9f7c0b320ba2},
+			},
+			ma:            0x26544280,
+			mx:            0x87885663995b60d0,
+			readRegs:      [4]uint8{0, 2, 5, 7},
+			datasetOffset: 0xc0b4c0,
+			eMask:         [2]uint64{0x3e000000001c690a, 0x360000000014b0cb},
+		},
+	}
+
+	for _, tt := range tests {
+		vm := &virtualMachine{}
+		if err := vm.initialize([]byte(tt.input)); err != nil {
+			t.Fatalf("initialize(%q) error = %v", tt.input, err)
+		}
+		vm.generateProgram()
+
+		for i := range vm.regA {
+			for j := range vm.regA[i] {
+				if got := floatToUint64(vm.regA[i][j]); got != tt.a[i][j] {
+					t.Errorf("%q: a%d[%d] = %#016x, want %#016x", tt.input, i, j, got, tt.a[i][j])
+				}
+			}
+		}
+		if vm.ma != tt.ma || vm.mx != tt.mx {
+			t.Errorf("%q: ma, mx = %#x, %#x, want %#x, %#x", tt.input, vm.ma, vm.mx, tt.ma, tt.mx)
+		}
+		readRegs := [4]uint8{vm.config.readReg0, vm.config.readReg1, vm.config.readReg2, vm.config.readReg3}
+		if readRegs != tt.readRegs {
+			t.Errorf("%q: readRegs = %v, want %v", tt.input, readRegs, tt.readRegs)
+		}
+		if vm.config.datasetOffset != tt.datasetOffset {
+			t.Errorf("%q: datasetOffset = %#x, want %#x", tt.input, vm.config.datasetOffset, tt.datasetOffset)
+		}
+		if vm.config.eMask != tt.eMask {
+			t.Errorf("%q: eMask = %#x, want %#x", tt.input, vm.config.eMask, tt.eMask)
+		}
+	}
+}
+
+// Test that float registers are loaded from memory as a pair of int32
+// values, low half first
+func TestReadMemoryFloat(t *testing.T) {
+	vm := &virtualMachine{mem: make([]byte, scratchpadL3Size)}
+	vm.writeMemory(0x40, 0x80000000FFFFFFFF)
+	vm.writeMemory(0x48, 0x7FFFFFFF00000000)
+
+	tests := []struct {
+		addr uint32
+		want [2]float64
+	}{
+		{0x40, [2]float64{-1, -2147483648}},
+		{0x48, [2]float64{0, 2147483647}},
+	}
+	for _, tt := range tests {
+		if got := vm.readMemoryFloat(tt.addr); got != tt.want {
+			t.Errorf("readMemoryFloat(%#x) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package randomx
 
 import (
+	"context"
 	"encoding/binary"
 	"testing"
 
@@ -27,7 +28,9 @@ func TestVMRegisterInitialization(t *testing.T) {
 	}
 
 	// Initialize VM - this should NOT set registers from hash
-	vm.initialize(input)
+	if err := vm.initialize(input); err != nil {
+		t.Fatalf("initialize() error = %v", err)
+	}
 
 	t.Logf("=== Register State After VM Initialization ===")
 	t.Logf("Registers should be filled from scratchpad, NOT from Blake2b hash")
@@ -84,7 +87,9 @@ func TestFirstIterationTrace(t *testing.T) {
 	}
 
 	// Initialize VM
-	vm.initialize(input)
+	if err := vm.initialize(input); err != nil {
+		t.Fatalf("initialize() error = %v", err)
+	}
 
 	// Generate first program
 	prog := vm.generateProgram()
@@ -167,7 +172,9 @@ func TestFinalizationTrace(t *testing.T) {
 	}
 
 	// Run full algorithm
-	vm.run(input)
+	if _, err := vm.run(context.Background(), input); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
 
 	// Note: finalize() is called at the end of run(), we can't trace it separately
 	t.Log("✓ Full algorithm executed")
@@ -195,8 +202,8 @@ func TestVMConfigurationParsing(t *testing.T) {
 	t.Logf("readReg3 = %d (register for mx XOR)", vm.config.readReg3)
 	t.Logf("")
 	t.Logf("E-register masks:")
-	for i := 0; i < 4; i++ {
-		t.Logf("  eMask[%d] = 0x%016x", i, vm.config.eMask[i])
+	for i, mask := range vm.config.eMask {
+		t.Logf("  eMask[%d] = 0x%016x", i, mask)
 	}
 
 	// Verify readReg values are in valid range
@@ -216,8 +223,8 @@ func TestVMConfigurationParsing(t *testing.T) {
 
 // TestEMaskDefault validates that eMask has proper default values
 func TestEMaskDefault(t *testing.T) {
-	// According to RandomX spec, eMask default should allow normal FP range
-	// Default mask: 0x3FFFFFFFFFFFFFFF (limits exponent to prevent infinity)
+	// According to RandomX spec, eMask keeps E registers positive and
+	// finite: the sign is clear and exponent bits 8-9 (0x300) are set
 	
 	input := []byte("This is a test")
 	hash := internal.Blake2b512(input)
@@ -232,8 +239,7 @@ func TestEMaskDefault(t *testing.T) {
 	vm.parseConfiguration(configData)
 
 	t.Logf("=== E-Mask Configuration ===")
-	for i := 0; i < 4; i++ {
-		mask := vm.config.eMask[i]
+	for i, mask := range vm.config.eMask {
 		t.Logf("eMask[%d] = 0x%016x", i, mask)
 		
 		// Check if mask is reasonable (should be non-zero and limit exponent)
@@ -241,12 +247,10 @@ func TestEMaskDefault(t *testing.T) {
 			t.Errorf("eMask[%d] is zero - this will zero out e%d register!", i, i)
 		}
 		
-		// Check if mask has reasonable bit pattern
-		// Bit 63 (sign bit) and bits 0-51 (mantissa) should be set
-		// Bits 52-62 (exponent) should be partially masked
-		signBit := (mask >> 63) & 1
-		if signBit == 0 {
-			t.Logf("  Warning: eMask[%d] clears sign bit", i)
+		// Check the fixed bits: no sign, exponent bits 8-9 set and
+		// bit 10 and mantissa bits 22-51 clear
+		if mask>>52 & 0xF0F != 0x300 || mask&(mantissaMask&^(1<<22-1)) != 0 {
+			t.Errorf("eMask[%d] = 0x%016x has the wrong fixed bits", i, mask)
 		}
 	}
 }